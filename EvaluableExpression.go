@@ -1,18 +1,20 @@
 package govaluate
 
 import (
-	"errors"
-	"fmt"
+	"context"
 )
 
 const isoDateFormat string = "2006-01-02T15:04:05.999999999Z0700"
-const shortCircuitHolder int = -1
 
 var DUMMY_PARAMETERS = MapParameters(map[string]interface{}{})
 
 /*
 	EvaluableExpression represents a set of ExpressionTokens which, taken together,
 	are an expression that can be evaluated down into a single value.
+
+	Once parsed, an expression is never changed by evaluating it, so it may be evaluated by any number of goroutines at once,
+	as long as the functions and parameters it's given are safe to use that way too.
+	Changing [QueryDateFormat] or [ChecksTypes] while it's being evaluated isn't safe.
 */
 type EvaluableExpression struct {
 
@@ -34,7 +36,9 @@ type EvaluableExpression struct {
 
 	tokens           []ExpressionToken
 	evaluationStages *evaluationStage
+	program          *evaluationProgram
 	inputExpression  string
+	limits           Limits
 }
 
 /*
@@ -52,66 +56,86 @@ func NewEvaluableExpression(expression string) (*EvaluableExpression, error) {
 	This is useful in cases where you may be generating an expression automatically, or using some other parser (e.g., to parse from a query language)
 */
 func NewEvaluableExpressionFromTokens(tokens []ExpressionToken) (*EvaluableExpression, error) {
+	return buildEvaluableExpression(tokens, Limits{})
+}
 
-	var ret *EvaluableExpression
-	var err error
-
-	ret = new(EvaluableExpression)
-	ret.QueryDateFormat = isoDateFormat
+/*
+	Similar to [NewEvaluableExpression], except enables the use of user-defined functions.
+	Functions passed into this will be available to the expression.
+*/
+func NewEvaluableExpressionWithFunctions(expression string, functions map[string]ExpressionFunction) (*EvaluableExpression, error) {
 
-	err = checkBalance(tokens)
-	if err != nil {
-		return nil, err
+	definitions := make(map[string]FunctionDefinition, len(functions))
+	for name, function := range functions {
+		definitions[name] = FunctionDefinition{Function: function}
 	}
+	return NewEvaluableExpressionWithDefinitions(expression, definitions)
+}
 
-	err = checkExpressionSyntax(tokens)
-	if err != nil {
-		return nil, err
-	}
+/*
+	Similar to [NewEvaluableExpressionWithFunctions], except that each function is described by a definition,
+	which tells the library what it may assume about that function (such as whether or not it's pure).
+*/
+func NewEvaluableExpressionWithDefinitions(expression string, definitions map[string]FunctionDefinition) (*EvaluableExpression, error) {
+	return NewEvaluableExpressionWithLimits(expression, definitions, Limits{})
+}
 
-	ret.tokens, err = optimizeTokens(tokens)
+/*
+	Similar to [NewEvaluableExpressionWithDefinitions], except that the expression must stay within the given [limits].
+	If it's too large to parse, this returns a *LimitError. If it goes over a limit while it's being evaluated, so does `Eval`.
+*/
+func NewEvaluableExpressionWithLimits(expression string, definitions map[string]FunctionDefinition, limits Limits) (*EvaluableExpression, error) {
+	return parseEvaluableExpression(expression, definitions, nil, limits)
+}
+
+/*
+	Parses the given [expression], expanding any of the given [macros] that it uses.
+	[macros] may be nil.
+*/
+func parseEvaluableExpression(expression string, definitions map[string]FunctionDefinition, macros *Macros, limits Limits) (*EvaluableExpression, error) {
+
+	tokens, err := parseTokens(expression, definitions, macros, limits)
 	if err != nil {
-		return nil, err
+		return nil, locateError(err, expression)
 	}
 
-	ret.evaluationStages, err = planStages(ret.tokens)
+	ret, err := buildEvaluableExpression(tokens, limits)
 	if err != nil {
-		return nil, err
+		return nil, locateError(err, expression)
 	}
 
-	ret.ChecksTypes = true
+	ret.inputExpression = expression
 	return ret, nil
 }
 
 /*
-	Similar to [NewEvaluableExpression], except enables the use of user-defined functions.
-	Functions passed into this will be available to the expression.
+	Checks, plans and compiles the given [tokens], which must already be within the token limits of [limits].
 */
-func NewEvaluableExpressionWithFunctions(expression string, functions map[string]ExpressionFunction) (*EvaluableExpression, error) {
+func buildEvaluableExpression(tokens []ExpressionToken, limits Limits) (*EvaluableExpression, error) {
 
 	var ret *EvaluableExpression
 	var err error
 
 	ret = new(EvaluableExpression)
 	ret.QueryDateFormat = isoDateFormat
-	ret.inputExpression = expression
+	ret.limits = limits
 
-	ret.tokens, err = parseTokens(expression, functions)
+	err = checkExpressionSyntax(tokens)
 	if err != nil {
 		return nil, err
 	}
 
-	err = checkBalance(ret.tokens)
+	err = checkBalance(tokens)
 	if err != nil {
 		return nil, err
 	}
 
-	err = checkExpressionSyntax(ret.tokens)
+	err = checkFunctionCalls(tokens)
 	if err != nil {
 		return nil, err
 	}
 
-	ret.tokens, err = optimizeTokens(ret.tokens)
+	ret.tokens, err = optimizeTokens(tokens)
 	if err != nil {
 		return nil, err
 	}
@@ -121,6 +145,12 @@ func NewEvaluableExpressionWithFunctions(expression string, functions map[string
 		return nil, err
 	}
 
+	err = limits.checkStageDepth(ret.evaluationStages)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.program = compileStages(ret.evaluationStages)
 	ret.ChecksTypes = true
 	return ret, nil
 }
@@ -149,37 +179,54 @@ func (this EvaluableExpression) Evaluate(parameters map[string]interface{}) (int
 	e.g., if the expression is "foo + 1" and parameters contains "foo" = 2, this will return 3.0
 */
 func (this EvaluableExpression) Eval(parameters Parameters) (interface{}, error) {
+	return this.EvalContext(context.Background(), parameters)
+}
+
+/*
+	Same as `Eval`, but stops as soon as possible once the given [ctx] is done, returning `ctx.Err()`.
+	The context is checked before every stage, and regularly while a fused kernel works through its arrays.
+	It's also given to every function which was defined with a `ContextExpressionFunction` or an `EvaluationExpressionFunction`.
+*/
+func (this EvaluableExpression) EvalContext(ctx context.Context, parameters Parameters) (interface{}, error) {
+	return this.evalWithUsage(ctx, parameters, &evaluationUsage{limits: this.limits})
+}
 
-	if this.evaluationStages == nil {
+/*
+	Same as `EvalContext`, but counts the resources used against the given [usage], which may be shared with other evaluations.
+*/
+func (this EvaluableExpression) evalWithUsage(ctx context.Context, parameters Parameters, usage *evaluationUsage) (interface{}, error) {
+
+	if this.program == nil {
 		return nil, nil
 	}
 
-	if parameters != nil {
-		parameters = &sanitizedParameters{parameters}
-	} else {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// without any parameters or a context to carry, there's nothing to wrap.
+	switch {
+	case parameters != nil:
+		parameters = &sanitizedParameters{orig: parameters, context: ctx}
+	case ctx != context.Background():
+		parameters = &sanitizedParameters{orig: DUMMY_PARAMETERS, context: ctx}
+	default:
 		parameters = DUMMY_PARAMETERS
 	}
 
-	return this.evaluateStage(this.evaluationStages, parameters)
+	return this.runProgram(ctx, this.program, parameters, usage)
 }
 
-func (this EvaluableExpression) evaluateStage(stage *evaluationStage, parameters Parameters) (interface{}, error) {
-
-	var left, right interface{}
-	var err error
-
-	if stage.leftStage != nil {
-		left, err = this.evaluateStage(stage.leftStage, parameters)
-		if err != nil {
-			return nil, err
-		}
-	}
+/*
+	Type checks the already-evaluated [left] and [right] values for the given [stage], then runs its operator.
+*/
+func (this EvaluableExpression) applyStage(stage *evaluationStage, left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 
-	if right != shortCircuitHolder && stage.rightStage != nil {
-		right, err = this.evaluateStage(stage.rightStage, parameters)
-		if err != nil {
-			return nil, err
-		}
+	// null operands are handled before their types are checked, since null is accepted wherever a value is.
+	result, handled, err := applyNull(stage, left, right, parameters)
+	if handled {
+		return result, err
 	}
 
 	if this.ChecksTypes {
@@ -197,8 +244,7 @@ func (this EvaluableExpression) evaluateStage(stage *evaluationStage, parameters
 		} else {
 			// special case where the type check needs to know both sides to determine if the operator can handle it
 			if !stage.typeCheck(left, right) {
-				errorMsg := fmt.Sprintf(stage.typeErrorFormat, left, stage.symbol.String())
-				return nil, errors.New(errorMsg)
+				return nil, newTypeError(stage.typeErrorFormat, left, stage.symbol.String())
 			}
 		}
 	}
@@ -216,8 +262,7 @@ func typeCheck(check stageTypeCheck, value interface{}, symbol OperatorSymbol, f
 		return nil
 	}
 
-	errorMsg := fmt.Sprintf(format, value, symbol.String())
-	return errors.New(errorMsg)
+	return newTypeError(format, value, symbol.String())
 }
 
 /*
@@ -230,14 +275,20 @@ func (this EvaluableExpression) Tokens() []ExpressionToken {
 
 /*
 	Returns the original expression used to create this EvaluableExpression.
+	Expressions which weren't parsed from a string (such as those made from tokens) are rendered by `Format` instead.
 */
 func (this EvaluableExpression) String() string {
 
+	if this.inputExpression == "" {
+		formatted, _ := this.Format()
+		return formatted
+	}
 	return this.inputExpression
 }
 
 /*
 	Returns an array representing the variables contained in this EvaluableExpression.
+	A variable appears once for every time it's used, and parameters used through accessors aren't included; see `Variables`.
 */
 func (this EvaluableExpression) Vars() []string {
 	var varlist []string
@@ -66,6 +66,9 @@ func (this EvaluableExpression) findNextSQLString(stream *tokenStream, transacti
 			ret = "OR"
 		}
 
+	case NULL:
+		ret = "NULL"
+
 	case BOOLEAN:
 		if token.Value.(bool) {
 			ret = "1"
@@ -82,14 +85,25 @@ func (this EvaluableExpression) findNextSQLString(stream *tokenStream, transacti
 	case COMPARATOR:
 		switch comparatorSymbols[token.Value.(string)] {
 
+		// SQL only finds nulls with IS.
 		case EQ:
 			ret = "="
+			if stream.hasNext() && stream.tokens[stream.index].Kind == NULL {
+				ret = "IS"
+			}
 		case NEQ:
 			ret = "<>"
+			if stream.hasNext() && stream.tokens[stream.index].Kind == NULL {
+				ret = "IS NOT"
+			}
 		case REQ:
 			ret = "RLIKE"
 		case NREQ:
 			ret = "NOT RLIKE"
+		case IS:
+			ret = "IS"
+		case IS_NOT:
+			ret = "IS NOT"
 		default:
 			ret = fmt.Sprintf("%s", token.Value.(string))
 		}
@@ -6,4 +6,20 @@ package govaluate
 type ExpressionToken struct {
 	Kind  TokenKind
 	Value interface{}
+
+	// for FUNCTION tokens, the name the function was called by, whether or not it's pure,
+	// and the arguments it accepts, if they're known.
+	functionName string
+	pure         bool
+	signature    *functionSignature
+
+	// the part of the expression that this token was read from. Empty if it wasn't read from an expression string.
+	span Span
+}
+
+/*
+	Returns the part of the expression that this token was read from, which isn't valid if it wasn't read from an expression string.
+*/
+func (this ExpressionToken) Span() Span {
+	return this.span
 }
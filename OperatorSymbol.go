@@ -19,6 +19,8 @@ const (
 	REQ
 	NREQ
 	IN
+	IS
+	IS_NOT
 
 	AND
 	OR
@@ -91,6 +93,10 @@ func findOperatorPrecedenceForSymbol(symbol OperatorSymbol) operatorPrecedence {
 	case NREQ:
 		fallthrough
 	case IN:
+		fallthrough
+	case IS:
+		fallthrough
+	case IS_NOT:
 		return comparatorPrecedence
 	case AND:
 		return logicalAndPrecedence
@@ -147,15 +153,17 @@ func findOperatorPrecedenceForSymbol(symbol OperatorSymbol) operatorPrecedence {
 	Also used during evaluation to determine exactly which comparator is being used.
 */
 var comparatorSymbols = map[string]OperatorSymbol{
-	"==": EQ,
-	"!=": NEQ,
-	">":  GT,
-	">=": GTE,
-	"<":  LT,
-	"<=": LTE,
-	"=~": REQ,
-	"!~": NREQ,
-	"in": IN,
+	"==":     EQ,
+	"!=":     NEQ,
+	">":      GT,
+	">=":     GTE,
+	"<":      LT,
+	"<=":     LTE,
+	"=~":     REQ,
+	"!~":     NREQ,
+	"in":     IN,
+	"is":     IS,
+	"is not": IS_NOT,
 }
 
 var logicalSymbols = map[string]OperatorSymbol{
@@ -270,6 +278,10 @@ func (this OperatorSymbol) String() string {
 		return "||"
 	case IN:
 		return "in"
+	case IS:
+		return "is"
+	case IS_NOT:
+		return "is not"
 	case BITWISE_AND:
 		return "&"
 	case BITWISE_OR:
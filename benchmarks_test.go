@@ -249,3 +249,50 @@ func BenchmarkNestedAccessors(bench *testing.B) {
 		expression.Evaluate(fooFailureParameters)
 	}
 }
+
+/*
+  Benchmarks a typical band-math expression over a tile-sized array, which is computed by a fused kernel.
+*/
+func BenchmarkArrayExpression(bench *testing.B) {
+
+	expression, _ := NewEvaluableExpression("(nir - red) / (nir + red) > 0.3 ? (nir - red) / (nir + red) : 0")
+	parameters := makeBandParameters(256 * 256)
+
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		expression.Eval(parameters)
+	}
+}
+
+/*
+  The same expression as BenchmarkArrayExpression, evaluated one whole array at a time for comparison.
+*/
+func BenchmarkArrayExpressionUnfused(bench *testing.B) {
+
+	expression, _ := NewEvaluableExpression("(nir - red) / (nir + red) > 0.3 ? (nir - red) / (nir + red) : 0")
+	parameters := makeBandParameters(256 * 256)
+	removeKernels(expression.evaluationStages)
+	expression.program = compileStages(expression.evaluationStages)
+
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		expression.Eval(parameters)
+	}
+}
+
+func makeBandParameters(size int) MapParameters {
+
+	nir := make([]float32, size)
+	red := make([]float32, size)
+
+	for i := 0; i < size; i++ {
+		nir[i] = float32(i%251) + 1
+		red[i] = float32(i%127) + 1
+	}
+
+	return MapParameters(map[string]interface{}{
+		"nir":    nir,
+		"red":    red,
+		"nodata": float32(-9999),
+	})
+}
@@ -0,0 +1,298 @@
+package govaluate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	A function declared in the expression language, like `def scale(x, lo, hi) = (x - lo) / (hi - lo)`.
+	Its body is an ordinary expression, which is evaluated with each parameter set to the matching argument.
+*/
+type declaredFunction struct {
+	name       string
+	parameters []string
+	body       *EvaluableExpression
+	limits     Limits
+}
+
+/*
+	The call to a declared function that's currently being evaluated, carried by the context of the evaluation.
+*/
+type declaredCall struct {
+
+	// the number of declared functions which are being called, one inside the other.
+	depth int
+
+	// the resources used by the whole evaluation, which the call shares.
+	usage *evaluationUsage
+}
+
+type declaredCallKey struct{}
+
+/*
+	The parameters of a single call to a declared function: its arguments, and the "nodata" parameter of whatever called it.
+*/
+type declaredParameters struct {
+	function  *declaredFunction
+	arguments []interface{}
+	caller    Parameters
+}
+
+/*
+	Parses a function declaration, like `def scale(x, lo, hi) = (x - lo) / (hi - lo)`, and returns the function's name and definition.
+	The body may call any of the given [definitions], and the function itself. It may only use its own parameters, and "nodata",
+	which is taken from whatever expression calls it.
+	Arrays are passed to the body as they are, so the function works on arrays just like the operators in its body.
+
+	The function can be added to the definitions of any other expression. It's pure if every function its body calls is pure.
+*/
+func ParseFunction(source string, definitions map[string]FunctionDefinition) (string, FunctionDefinition, error) {
+	return ParseFunctionWithLimits(source, definitions, Limits{})
+}
+
+/*
+	Similar to [ParseFunction], except that the body must stay within the given [limits].
+	[MaxCallDepth] limits how deeply the function may call itself, or other declared functions.
+*/
+func ParseFunctionWithLimits(source string, definitions map[string]FunctionDefinition, limits Limits) (string, FunctionDefinition, error) {
+
+	name, parameters, body, offset, err := splitDeclaration(source)
+	if err != nil {
+		return "", FunctionDefinition{}, err
+	}
+
+	_, found := definitions[name]
+	if found {
+		return "", FunctionDefinition{}, fmt.Errorf("Function '%s' is already defined", name)
+	}
+
+	function := &declaredFunction{
+		name:       name,
+		parameters: parameters,
+		limits:     limits,
+	}
+
+	// any value may be given for any parameter, so only the number of arguments is checked.
+	signature := &functionSignature{minimum: len(parameters), maximum: len(parameters)}
+
+	// the body can refer to the function itself, so it's defined before the body is parsed.
+	bodyDefinitions := make(map[string]FunctionDefinition, len(definitions)+1)
+	for definedName, definition := range definitions {
+		bodyDefinitions[definedName] = definition
+	}
+	bodyDefinitions[name] = FunctionDefinition{declared: function, signature: signature}
+
+	function.body, err = NewEvaluableExpressionWithLimits(body, bodyDefinitions, limits)
+	if err != nil {
+
+		moved, ok := moveParseError(err, source, offset, fmt.Sprintf("Function '%s': ", name))
+		if ok {
+			return "", FunctionDefinition{}, moved
+		}
+		return "", FunctionDefinition{}, fmt.Errorf("Function '%s': %v", name, err)
+	}
+
+	for _, variable := range function.body.Variables() {
+
+		if variable != "nodata" && function.findParameter(variable) < 0 {
+			return "", FunctionDefinition{}, fmt.Errorf("Function '%s' uses '%s', which isn't one of its parameters", name, variable)
+		}
+	}
+
+	pure := true
+	Inspect(function.body.AST(), func(node Node) bool {
+
+		call, ok := node.(*CallNode)
+		if ok && call.Name() != name && !call.Function().Pure {
+			pure = false
+		}
+		return true
+	})
+
+	// calls the function makes to itself weren't known to be pure when the body was first parsed,
+	// so it's parsed again so that they can be remembered like any other pure call.
+	if pure {
+
+		bodyDefinitions[name] = FunctionDefinition{declared: function, signature: signature, Pure: true}
+
+		function.body, err = NewEvaluableExpressionWithLimits(body, bodyDefinitions, limits)
+		if err != nil {
+			return "", FunctionDefinition{}, fmt.Errorf("Function '%s': %v", name, err)
+		}
+	}
+
+	return name, FunctionDefinition{declared: function, signature: signature, Pure: pure}, nil
+}
+
+/*
+	Returns whether or not the given statement [source] is a function declaration, rather than an expression.
+	A variable called "def" can still be used, as long as it isn't followed by a name.
+*/
+func isDeclaration(source string) bool {
+
+	source = strings.TrimLeftFunc(source, unicode.IsSpace)
+	if !strings.HasPrefix(source, "def") {
+		return false
+	}
+
+	rest := []rune(source[len("def"):])
+	if len(rest) == 0 || !unicode.IsSpace(rest[0]) {
+		return false
+	}
+
+	rest = []rune(strings.TrimLeftFunc(string(rest), unicode.IsSpace))
+	return len(rest) > 0 && unicode.IsLetter(rest[0])
+}
+
+/*
+	Splits a declaration like `def name(a, b) = body` into the function's name, its parameters and its body,
+	along with how many characters into the [declaration] the body starts.
+*/
+func splitDeclaration(declaration string) (string, []string, string, int, error) {
+
+	invalid := errors.New("Function declarations must look like 'def name(parameter, ...) = expression'")
+
+	if !isDeclaration(declaration) {
+		return "", nil, "", 0, invalid
+	}
+
+	source := strings.TrimSpace(declaration)[len("def"):]
+
+	open := strings.Index(source, "(")
+	close := strings.Index(source, ")")
+	if open < 0 || close < open {
+		return "", nil, "", 0, invalid
+	}
+
+	name := strings.TrimSpace(source[:open])
+	if !isPlainName(name) {
+		return "", nil, "", 0, fmt.Errorf("Function name '%s' is not a plain name", name)
+	}
+
+	var parameters []string
+	seen := make(map[string]bool)
+
+	if strings.TrimSpace(source[open+1:close]) != "" {
+
+		for _, parameter := range strings.Split(source[open+1:close], ",") {
+
+			parameter = strings.TrimSpace(parameter)
+
+			if !isPlainName(parameter) {
+				return "", nil, "", 0, fmt.Errorf("Parameter '%s' of function '%s' is not a plain name", parameter, name)
+			}
+			if seen[parameter] {
+				return "", nil, "", 0, fmt.Errorf("Function '%s' has more than one parameter called '%s'", name, parameter)
+			}
+
+			seen[parameter] = true
+			parameters = append(parameters, parameter)
+		}
+	}
+
+	body := strings.TrimSpace(source[close+1:])
+	if !strings.HasPrefix(body, "=") || strings.HasPrefix(body, "==") {
+		return "", nil, "", 0, invalid
+	}
+
+	// the body starts just after the '=', which is the first character after the parenthesis that isn't a space.
+	equals := len(declaration) - len(strings.TrimLeftFunc(declaration, unicode.IsSpace)) + len("def") + close + 1
+	equals += len(source[close+1:]) - len(strings.TrimLeftFunc(source[close+1:], unicode.IsSpace))
+
+	return name, parameters, body[1:], utf8.RuneCountInString(declaration[:equals+1]), nil
+}
+
+/*
+	Returns the stage operator which calls this function. Unlike other functions, it's given the parameters of the caller,
+	so that "nodata" and the context of the evaluation can be passed on to the body.
+*/
+func (this *declaredFunction) operator() evaluationOperator {
+
+	return func(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+		var arguments []interface{}
+
+		switch typed := right.(type) {
+		case nil:
+		case []interface{}:
+			arguments = typed
+		default:
+			arguments = []interface{}{typed}
+		}
+
+		return this.call(parameters, arguments)
+	}
+}
+
+func (this *declaredFunction) call(parameters Parameters, arguments []interface{}) (interface{}, error) {
+
+	if len(arguments) != len(this.parameters) {
+		return nil, fmt.Errorf("Function '%s' takes %d arguments, but was given %d", this.name, len(this.parameters), len(arguments))
+	}
+
+	ctx := findContext(parameters)
+
+	call := &declaredCall{depth: 1}
+
+	caller, ok := ctx.Value(declaredCallKey{}).(*declaredCall)
+	if ok {
+		call.depth = caller.depth + 1
+		call.usage = caller.usage
+	} else {
+		call.usage = &evaluationUsage{limits: this.limits}
+	}
+
+	maximum := this.limits.MaxCallDepth
+	if maximum <= 0 {
+		maximum = defaultMaxCallDepth
+	}
+
+	if call.depth > maximum {
+		return nil, &LimitError{Kind: CallDepthLimit, Maximum: int64(maximum)}
+	}
+
+	scope := &declaredParameters{
+		function:  this,
+		arguments: arguments,
+		caller:    parameters,
+	}
+	return this.body.evalWithUsage(context.WithValue(ctx, declaredCallKey{}, call), scope, call.usage)
+}
+
+/*
+	Returns the position of the parameter with the given [name], or -1 if there's no such parameter.
+*/
+func (this *declaredFunction) findParameter(name string) int {
+
+	for i, parameter := range this.parameters {
+		if parameter == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (this *declaredParameters) Get(name string) (interface{}, error) {
+
+	index := this.function.findParameter(name)
+	if index >= 0 {
+		return this.arguments[index], nil
+	}
+
+	if name == "nodata" {
+		return this.caller.Get(name)
+	}
+	return nil, &MissingParameterError{Name: name}
+}
+
+/*
+	Returns a context which makes every declared function called with it share the given [usage].
+*/
+func withDeclaredCalls(ctx context.Context, usage *evaluationUsage) context.Context {
+	return context.WithValue(ctx, declaredCallKey{}, &declaredCall{usage: usage})
+}
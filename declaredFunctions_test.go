@@ -0,0 +1,178 @@
+package govaluate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeclaredFunctions(test *testing.T) {
+
+	scriptTests := []ScriptTest{
+
+		ScriptTest{
+			Name:       "Scalar",
+			Source:     "def scale(x, lo, hi) = (x - lo) / (hi - lo); scale(v, 10, 20)",
+			Parameters: map[string]interface{}{"v": 15},
+			Expected:   float32(0.5),
+		},
+		ScriptTest{
+			Name:       "Array",
+			Source:     "def scale(x, lo, hi) = (x - lo) / (hi - lo)\nscale(band, 0, 4) > 0.5",
+			Parameters: map[string]interface{}{"band": []float32{1, 3}},
+			Expected:   []bool{false, true},
+		},
+		ScriptTest{
+			Name:     "Recursion",
+			Source:   "def fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(5)",
+			Expected: float32(120),
+		},
+		ScriptTest{
+			Name:     "Calling each other",
+			Source:   "def square(x) = x * x; def norm(a, b) = square(a) + square(b); norm(3, 4)",
+			Expected: float32(25),
+		},
+		ScriptTest{
+			Name:     "No parameters",
+			Source:   "def answer() = 42; answer() + 1",
+			Expected: float32(43),
+		},
+		ScriptTest{
+			Name:       "Parameters hide locals",
+			Source:     "x = 100; def inc(x) = x + 1; inc(x) + inc(1)",
+			Parameters: map[string]interface{}{},
+			Expected:   float32(103),
+		},
+		ScriptTest{
+			Name:       "No data",
+			Source:     "def fill(x) = x ?? 0; fill(band)",
+			Parameters: map[string]interface{}{"band": []float32{1, -1}, "nodata": -1},
+			Expected:   []float32{1, 0},
+		},
+		ScriptTest{
+			Name:       "Variable called def",
+			Source:     "def + 1",
+			Parameters: map[string]interface{}{"def": 1},
+			Expected:   float32(2),
+		},
+	}
+
+	for _, scriptTest := range scriptTests {
+
+		script, err := NewScript(scriptTest.Source, nil)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", scriptTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := script.Evaluate(scriptTest.Parameters)
+		if err != nil || !reflect.DeepEqual(result, scriptTest.Expected) {
+			test.Logf("Test '%s' failed", scriptTest.Name)
+			test.Logf("Expected %v, got %v (%v)", scriptTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+}
+
+func TestDeclaredFunctionErrors(test *testing.T) {
+
+	failures := map[string]string{
+		"def f(x) = x + y; f(1)":        "isn't one of its parameters",
+		"def f(x, x) = x; f(1, 2)":      "more than one parameter",
+		"def f(x) x; f(1)":              "must look like",
+		"def f(x) = x +; f(1)":          "Function 'f'",
+		"def f(x) = x; def f(y) = y; 1": "already defined",
+		"def f(x) = x; f = 2":           "which is a function",
+		"def f(1) = 1; f(1)":            "not a plain name",
+	}
+
+	for source, expected := range failures {
+
+		_, err := NewScript(source, nil)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			test.Logf("Expected an error containing '%s' for '%s', got %v", expected, source, err)
+			test.Fail()
+		}
+	}
+
+	// the number of arguments is checked when the call is parsed.
+	_, err := NewScript("def f(a, b) = a + b; f(1)", nil)
+	if err == nil || !strings.Contains(err.Error(), "Function 'f' takes 2 arguments") {
+		test.Logf("Expected an error for the wrong number of arguments, got %v", err)
+		test.Fail()
+	}
+
+	var script *Script
+
+	limits := []Limits{
+		Limits{},
+		Limits{MaxCallDepth: 5},
+	}
+
+	for _, limit := range limits {
+
+		script, _ = NewScriptWithLimits("def forever(n) = forever(n + 1); forever(0)", nil, limit)
+
+		_, err = script.Evaluate(nil)
+		limitErr, ok := err.(*LimitError)
+		if !ok || limitErr.Kind != CallDepthLimit {
+			test.Logf("Expected a call depth limit error with %+v, got %v", limit, err)
+			test.Fail()
+		}
+	}
+
+	// calls inside declared functions count against the script's limits too.
+	script, _ = NewScriptWithLimits("def fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(10)", nil, Limits{MaxFunctionCalls: 5})
+
+	_, err = script.Evaluate(nil)
+	if _, ok := err.(*LimitError); !ok {
+		test.Logf("Expected a function call limit error, got %v", err)
+		test.Fail()
+	}
+}
+
+func TestParseFunction(test *testing.T) {
+
+	impure := map[string]FunctionDefinition{
+		"random": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return float32(4), nil
+			},
+		},
+	}
+
+	name, scale, err := ParseFunction("def scale(x, lo, hi) = (x - lo) / (hi - lo)", impure)
+	if err != nil || name != "scale" || !scale.Pure {
+		test.Fatalf("Expected a pure function called 'scale', got '%s' (%v)", name, err)
+	}
+
+	_, jitter, err := ParseFunction("def jitter(x) = x + random()", impure)
+	if err != nil || jitter.Pure {
+		test.Logf("Expected an impure function (%v)", err)
+		test.Fail()
+	}
+
+	expression, err := NewEvaluableExpressionWithDefinitions("scale(v, 0, 10) * 2", map[string]FunctionDefinition{"scale": scale})
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	result, err := expression.Evaluate(map[string]interface{}{"v": 5})
+	if err != nil || result != float32(1) {
+		test.Logf("Expected 1, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	// the function is built back into expressions from syntax trees.
+	rebuilt, err := NewEvaluableExpressionFromAST(expression.AST())
+	if err != nil {
+		test.Fatalf("Failed to rebuild: %v", err)
+	}
+
+	result, err = rebuilt.Evaluate(map[string]interface{}{"v": 5})
+	if err != nil || result != float32(1) {
+		test.Logf("Expected 1 from the rebuilt expression, got %v (%v)", result, err)
+		test.Fail()
+	}
+}
@@ -0,0 +1,271 @@
+package govaluate
+
+/*
+	Applies the operator of the given [stage] to operands which include null, the way SQL does:
+
+		null + 1, -null, null > 1     null; arithmetic and ordering propagate null
+		null == null, x != null       whether or not the other operand is null, as `is null` and `is not null` test
+		false && null, true || null   false and true, since the other operand decides; otherwise null
+		null ? a : b                  b, as though the condition were false
+		true ? null : b               null, since that's the branch which was selected
+		null ?? x                     x
+
+	Arrays of numbers can't hold null, so their elements are null when they're equal to "nodata" instead.
+	A null combined with an array of numbers gives an array of "nodata", and a null replaced in an array by `??` is "nodata".
+	A null selected by `?` for an array of conditions is "nodata" wherever the condition is true.
+	A number which is equal to "nodata" counts as null too, just as `??` replaces it.
+
+	Returns false if no operand is null (or the operator doesn't treat null specially), so that the operator should be applied as usual.
+*/
+func applyNull(stage *evaluationStage, left interface{}, right interface{}, parameters Parameters) (interface{}, bool, error) {
+
+	switch stage.symbol {
+
+	case EQ, NEQ:
+		if !hasNullOperand(stage, left, right) {
+			return nil, false, nil
+		}
+
+		operand := right
+		if right == nil {
+			operand = left
+		}
+
+		if stage.symbol == EQ {
+			result, err := isNullStage(operand, nil, parameters)
+			return result, true, err
+		}
+		result, err := isNotNullStage(operand, nil, parameters)
+		return result, true, err
+
+	case AND, OR:
+		if left != nil && right != nil {
+			return nil, false, nil
+		}
+
+		// either operand decides the result on its own, if it's false for "&&" or true for "||".
+		decider := stage.symbol == OR
+		if left == decider || right == decider {
+			return decider, true, nil
+		}
+		return nil, true, nil
+
+	case TERNARY_TRUE:
+		if left != nil && right != nil {
+			return nil, false, nil
+		}
+
+		if left == nil {
+			left = false
+		}
+
+		// the ":" which follows needs to know where null was selected, since "nodata" would look like a branch which wasn't.
+		if right == nil && stage.elseFollows {
+			switch condition := left.(type) {
+			case []bool:
+				return nullBranch{taken: condition}, true, nil
+			case bool:
+				if condition {
+					return nullBranch{taken: condition}, true, nil
+				}
+			}
+		}
+
+		if right == nil {
+			noData, err := getNoData(parameters)
+			if err != nil {
+				return nil, true, err
+			}
+			right = noData
+		}
+
+		result, err := stage.operator(left, right, parameters)
+		return result, true, err
+
+	case TERNARY_FALSE, COALESCE:
+		if branch, isBranch := left.(nullBranch); isBranch {
+			result, err := applyNullBranch(branch, right, parameters)
+			return result, true, err
+		}
+
+		if left == nil {
+			return right, true, nil
+		}
+
+		// values other than numbers are never replaced.
+		if !isFloat32(left) {
+			return left, true, nil
+		}
+
+		if right != nil {
+			return nil, false, nil
+		}
+
+		noData, err := getNoData(parameters)
+		if err != nil {
+			return nil, true, err
+		}
+
+		if left == noData {
+			return nil, true, nil
+		}
+
+		result, err := stage.operator(left, noData, parameters)
+		return result, true, err
+	}
+
+	if !propagatesNull(stage.symbol) || !hasNullOperand(stage, left, right) {
+		return nil, false, nil
+	}
+
+	result, err := findNullResult(stage.symbol, left, right, parameters)
+	return result, true, err
+}
+
+/*
+	The result of a "?" which selected null, given to the ":" which follows it.
+	[taken] is the condition of the "?", which is either true, or an array of conditions.
+*/
+type nullBranch struct {
+	taken interface{}
+}
+
+/*
+	Returns the result of a ":" whose "?" selected null. That's null for a single condition,
+	or for an array of conditions, "nodata" wherever the condition was true and the [right] operand everywhere else.
+*/
+func applyNullBranch(branch nullBranch, right interface{}, parameters Parameters) (interface{}, error) {
+
+	taken, isArray := branch.taken.([]bool)
+	if !isArray {
+		return nil, nil
+	}
+
+	noData, err := getNoData(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]float32, len(taken))
+
+	numbers, isNumbers := right.([]float32)
+	number, isNumber := right.(float32)
+
+	if isNumbers && len(numbers) != len(taken) {
+		return nil, &ArrayShapeError{Left: len(taken), Right: len(numbers)}
+	}
+
+	if right != nil && !isNumbers && !isNumber {
+		return nil, newOperandError("ternary else", ret, right)
+	}
+
+	for i := range ret {
+		switch {
+		case taken[i] || right == nil:
+			ret[i] = noData
+		case isNumbers:
+			ret[i] = numbers[i]
+		default:
+			ret[i] = number
+		}
+	}
+	return ret, nil
+}
+
+/*
+	Returns the result of an operator which propagates null, given a null operand.
+	That's null, unless the operator gives numbers and the other operand is an array of them, which makes an array of "nodata" instead.
+*/
+func findNullResult(symbol OperatorSymbol, left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+	switch symbol {
+	case GT, LT, GTE, LTE, REQ, NREQ, IN, INVERT:
+		return nil, nil
+	}
+
+	numbers, found := left.([]float32)
+	if !found {
+		numbers, found = right.([]float32)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	noData, err := getNoData(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]float32, len(numbers))
+	for i := range ret {
+		ret[i] = noData
+	}
+	return ret, nil
+}
+
+/*
+	Returns true if the given [symbol] is for an operator which gives null if any of its operands is null.
+*/
+func propagatesNull(symbol OperatorSymbol) bool {
+
+	switch symbol {
+	case PLUS, MINUS, MULTIPLY, DIVIDE, MODULUS, EXPONENT,
+		BITWISE_AND, BITWISE_OR, BITWISE_XOR, BITWISE_LSHIFT, BITWISE_RSHIFT,
+		NEGATE, INVERT, BITWISE_NOT,
+		GT, LT, GTE, LTE, REQ, NREQ, IN:
+		return true
+	}
+	return false
+}
+
+/*
+	Returns true if either operand of the given [stage] is null. Prefix operators have no left operand, rather than a null one.
+*/
+func hasNullOperand(stage *evaluationStage, left interface{}, right interface{}) bool {
+	return stage.leftStage != nil && left == nil || stage.rightStage != nil && right == nil
+}
+
+/*
+	Tests whether the [left] operand is null, which for numbers means equal to "nodata".
+	Arrays of numbers are tested element by element. Any other value is never null.
+*/
+func isNullStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+	switch typed := left.(type) {
+
+	case nil:
+		return true, nil
+
+	case float32:
+		noData, err := getNoData(parameters)
+		if err != nil {
+			return nil, err
+		}
+		return typed == noData, nil
+
+	case []float32:
+		noData, err := getNoData(parameters)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]bool, len(typed))
+		for i := range typed {
+			ret[i] = typed[i] == noData
+		}
+		return ret, nil
+	}
+
+	return false, nil
+}
+
+func isNotNullStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+	result, err := isNullStage(left, right, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return invertStage(nil, result, parameters)
+}
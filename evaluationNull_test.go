@@ -0,0 +1,234 @@
+package govaluate
+
+import (
+	"reflect"
+	"testing"
+)
+
+type NullTest struct {
+	Name     string
+	Input    string
+	Expected interface{}
+}
+
+func TestNullEvaluation(test *testing.T) {
+
+	parameters := map[string]interface{}{
+		"missing": nil,
+		"x":       float32(2),
+		"xs":      []float32{1, -1, 3},
+		"name":    "foo",
+		"flag":    true,
+		"nodata":  float32(-1),
+	}
+
+	nullTests := []NullTest{
+
+		NullTest{
+			Name:     "Literal",
+			Input:    "NULL",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Arithmetic",
+			Input:    "missing * 2 + x",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Prefix",
+			Input:    "-null",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Concatenation",
+			Input:    "name + missing",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Ordering",
+			Input:    "missing > 1",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Equal to null",
+			Input:    "missing == null",
+			Expected: true,
+		},
+		NullTest{
+			Name:     "Not equal to null",
+			Input:    "null != x",
+			Expected: true,
+		},
+		NullTest{
+			Name:     "Null equals null",
+			Input:    "null == null",
+			Expected: true,
+		},
+		NullTest{
+			Name:     "Is null",
+			Input:    "missing is null && x IS NOT NULL",
+			Expected: true,
+		},
+		NullTest{
+			Name:     "Nodata is null",
+			Input:    "nodata is null",
+			Expected: true,
+		},
+		NullTest{
+			Name:     "String is not null",
+			Input:    "name is null",
+			Expected: false,
+		},
+		NullTest{
+			Name:     "Array is null",
+			Input:    "xs is null",
+			Expected: []bool{false, true, false},
+		},
+		NullTest{
+			Name:     "Array not equal to null",
+			Input:    "xs != null",
+			Expected: []bool{true, false, true},
+		},
+		NullTest{
+			Name:     "Array arithmetic",
+			Input:    "xs + missing",
+			Expected: []float32{-1, -1, -1},
+		},
+		NullTest{
+			Name:     "False and null",
+			Input:    "false && missing",
+			Expected: false,
+		},
+		NullTest{
+			Name:     "True and null",
+			Input:    "flag && missing",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Null or true",
+			Input:    "missing || flag",
+			Expected: true,
+		},
+		NullTest{
+			Name:     "Null or false",
+			Input:    "missing || false",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Null condition",
+			Input:    "missing ? 1 : 2",
+			Expected: float32(2),
+		},
+		NullTest{
+			Name:     "Null true branch",
+			Input:    "true ? null : 1",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Null selected by a parameter",
+			Input:    "flag ? null : x",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Null not selected",
+			Input:    "!flag ? null : x",
+			Expected: float32(2),
+		},
+		NullTest{
+			Name:     "Null true branch without else",
+			Input:    "flag ? null",
+			Expected: float32(-1),
+		},
+		NullTest{
+			Name:     "Null true branch of arrays",
+			Input:    "xs > 0 ? null : 5",
+			Expected: []float32{-1, 5, -1},
+		},
+		NullTest{
+			Name:     "Null true branch with an array else",
+			Input:    "xs > 0 ? null : xs * 2",
+			Expected: []float32{-1, -2, -1},
+		},
+		NullTest{
+			Name:     "Null in both branches of arrays",
+			Input:    "xs > 0 ? null : null",
+			Expected: []float32{-1, -1, -1},
+		},
+		NullTest{
+			Name:     "Null true branch of arrays without else",
+			Input:    "xs > 0 ? null",
+			Expected: []float32{-1, -1, -1},
+		},
+		NullTest{
+			Name:     "Coalesce",
+			Input:    "missing + 1 ?? x",
+			Expected: float32(2),
+		},
+		NullTest{
+			Name:     "Coalesce string",
+			Input:    "missing ?? name",
+			Expected: "foo",
+		},
+		NullTest{
+			Name:     "Coalesce keeps string",
+			Input:    "name ?? 'bar'",
+			Expected: "foo",
+		},
+		NullTest{
+			Name:     "Coalesce with null",
+			Input:    "x ?? null",
+			Expected: float32(2),
+		},
+		NullTest{
+			Name:     "Coalesce nodata with null",
+			Input:    "nodata ?? null",
+			Expected: nil,
+		},
+		NullTest{
+			Name:     "Coalesce array with null",
+			Input:    "xs ?? null",
+			Expected: []float32{1, -1, 3},
+		},
+		NullTest{
+			Name:     "Coalesce array elements",
+			Input:    "xs * missing ?? xs",
+			Expected: []float32{1, -1, 3},
+		},
+		NullTest{
+			Name:     "Escaped name",
+			Input:    "[null]",
+			Expected: "value",
+		},
+	}
+
+	parameters["null"] = "value"
+
+	for _, nullTest := range nullTests {
+
+		expression, err := NewEvaluableExpression(nullTest.Input)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", nullTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := expression.Evaluate(parameters)
+		if err != nil || !reflect.DeepEqual(result, nullTest.Expected) {
+			test.Logf("Test '%s' failed", nullTest.Name)
+			test.Logf("Expected %#v, got %#v (%v)", nullTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+}
+
+func TestNullWithoutTypeChecks(test *testing.T) {
+
+	expression, _ := NewEvaluableExpression("(a + 1) * 2 > 3 && b is null")
+	expression.ChecksTypes = false
+
+	result, err := expression.Evaluate(map[string]interface{}{"a": nil, "b": nil})
+	if err != nil || result != nil {
+		test.Logf("Expected null, got '%v' (%v)", result, err)
+		test.Fail()
+	}
+}
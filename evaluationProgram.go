@@ -0,0 +1,934 @@
+package govaluate
+
+import (
+	"context"
+	"math"
+)
+
+/*
+	The instructions understood by the evaluation machine.
+*/
+type programOpcode uint8
+
+const (
+
+	// pushes a constant onto the stack.
+	opLiteral programOpcode = iota
+
+	// pushes the value of a named parameter onto the stack.
+	opParameter
+
+	// runs a stage's operator over the operands on top of the stack, and pushes the result.
+	opStage
+
+	// pushes a copy of a value further down the stack.
+	opLoad
+
+	// copies the value on top of the stack into a slot further down, without removing it.
+	opStore
+
+	// looks at the left operand of a short-circuiting stage, on top of the stack. If that decides the result on its own,
+	// pushes a stand-in for the right operand and jumps straight to the stage, without computing the right operand.
+	opBranch
+
+	// runs a fused kernel over the leaf values on top of the stack. If the kernel can be used, replaces them with its result and jumps.
+	// Otherwise, execution continues with the stage-by-stage code for the same subtree.
+	opKernel
+
+	// replaces the leaf values of a kernel with the result computed by its stage-by-stage code.
+	opCollapse
+)
+
+type programInstruction struct {
+	opcode programOpcode
+
+	// an index into the literals, parameter names, stages, stack or kernels of the program, depending on the opcode.
+	operand int
+
+	// for opKernel and opCollapse, the position in the stack of the first leaf value.
+	frame int
+
+	// for opKernel, the instruction to continue from once the kernel has computed its result.
+	// for opBranch, the instruction of the stage whose right operand can be skipped.
+	target int
+
+	// for opStage, whether or not the stage takes a left and right operand off the stack.
+	hasLeft, hasRight bool
+
+	// for opParameter, whether a missing parameter is only an error once its value is copied by opLoad.
+	optional bool
+}
+
+/*
+	An evaluationProgram is a flat, compiled form of a planned stage tree.
+	It's run by a non-recursive stack machine, which keeps numbers and bools in typed registers
+	instead of boxing them into an interface{} at every stage.
+*/
+type evaluationProgram struct {
+	instructions []programInstruction
+
+	literals   []programValue
+	parameters []string
+	stages     []*evaluationStage
+
+	// where each parameter is read in the expression, to be given with the error if it's missing.
+	parameterSpans []Span
+	kernels        []*stageKernel
+
+	// the bottom of the stack holds one slot for every shared stage, which keeps its value once it's been computed.
+	slots     int
+	stackSize int
+}
+
+type programValueKind uint8
+
+const (
+	programInterface programValueKind = iota
+	programNumber
+	programBool
+
+	// a parameter which couldn't be read, holding the error. See `opParameter`.
+	programMissing
+)
+
+/*
+	A single register of the evaluation machine.
+	Numbers and bools are held unboxed; anything else is held in [value].
+	Numbers and bools which arrived boxed (literals and parameters) also keep their original box in [value],
+	so that returning them doesn't need another allocation.
+*/
+type programValue struct {
+	kind    programValueKind
+	boolean bool
+	number  float32
+	value   interface{}
+}
+
+func makeProgramValue(value interface{}) programValue {
+
+	switch typed := value.(type) {
+	case float32:
+		return programValue{kind: programNumber, number: typed, value: value}
+	case bool:
+		return programValue{kind: programBool, boolean: typed, value: value}
+	}
+
+	return programValue{value: value}
+}
+
+func (this programValue) box() interface{} {
+
+	if this.value != nil {
+		return this.value
+	}
+
+	switch this.kind {
+	case programNumber:
+		return this.number
+	case programBool:
+		return boolIface(this.boolean)
+	}
+	return this.value
+}
+
+/*
+	Compiles the given planned stage tree into a program.
+	Returns nil if there is nothing to evaluate.
+*/
+func compileStages(root *evaluationStage) *evaluationProgram {
+
+	if root == nil {
+		return nil
+	}
+
+	compiler := new(programCompiler)
+	compiler.program = new(evaluationProgram)
+	compiler.references = countStageReferences(root)
+	compiler.slots = make(map[*evaluationStage]int)
+
+	for stage, count := range compiler.references {
+		if count > 1 && needsSlot(stage) {
+			compiler.program.slots++
+		}
+	}
+
+	compiler.depth = compiler.program.slots
+	compiler.maxDepth = compiler.depth
+	compiler.compileStage(root)
+
+	compiler.program.stackSize = compiler.maxDepth
+	return compiler.program
+}
+
+type programCompiler struct {
+	program *evaluationProgram
+
+	// the number of parents of each stage, and the slot of each shared stage which has already been compiled.
+	references map[*evaluationStage]int
+	slots      map[*evaluationStage]int
+
+	// the number of short-circuiting stages whose right operand is currently being compiled.
+	// Code compiled there might never run, so it can't fill any slots.
+	conditional int
+
+	depth, maxDepth int
+}
+
+func (this *programCompiler) emit(instruction programInstruction, stackChange int) int {
+
+	this.program.instructions = append(this.program.instructions, instruction)
+
+	this.depth += stackChange
+	if this.depth > this.maxDepth {
+		this.maxDepth = this.depth
+	}
+	return len(this.program.instructions) - 1
+}
+
+/*
+	Compiles a stage which may be shared by several parents.
+	The first time, it's computed and kept in its slot. Every time after that, it's copied from that slot.
+	A stage first reached from code which might not run is computed again wherever it's used, until it's reached by code which always runs.
+*/
+func (this *programCompiler) compileStage(stage *evaluationStage) {
+
+	if this.references[stage] <= 1 || !needsSlot(stage) {
+		this.compileUnsharedStage(stage)
+		return
+	}
+
+	slot, found := this.slots[stage]
+	if found {
+		this.emit(programInstruction{opcode: opLoad, operand: slot}, 1)
+		return
+	}
+
+	this.compileUnsharedStage(stage)
+	if this.conditional > 0 {
+		return
+	}
+
+	slot = len(this.slots)
+	this.slots[stage] = slot
+	this.emit(programInstruction{opcode: opStore, operand: slot}, 0)
+}
+
+/*
+	Parameters and literals are cheap enough to read again, so only stages which compute something get a slot.
+*/
+func needsSlot(stage *evaluationStage) bool {
+	return stage.symbol != VALUE && stage.symbol != LITERAL
+}
+
+func (this *programCompiler) compileUnsharedStage(stage *evaluationStage) {
+
+	if stage.kernel != nil {
+		this.compileKernel(stage.kernel)
+		return
+	}
+
+	switch stage.symbol {
+
+	case NOOP:
+		if stage.rightStage == nil {
+			this.compileLiteral(nil)
+			return
+		}
+		this.compileStage(stage.rightStage)
+		return
+
+	case VALUE:
+		if stage.parameterName != "" {
+			this.compileParameter(stage, false)
+			return
+		}
+
+	case LITERAL:
+		// literals never look at their parameters.
+		value, err := stage.operator(nil, nil, nil)
+		if err == nil {
+			this.compileLiteral(value)
+			return
+		}
+	}
+
+	if stage.leftStage != nil {
+		this.compileStage(stage.leftStage)
+	}
+
+	branch := this.compileBranch(stage)
+	if stage.rightStage != nil {
+		this.compileStage(stage.rightStage)
+	}
+
+	this.compileOperator(stage, stage.leftStage != nil, stage.rightStage != nil)
+	this.finishBranch(branch)
+}
+
+func (this *programCompiler) compileLiteral(value interface{}) {
+
+	this.program.literals = append(this.program.literals, makeProgramValue(value))
+	this.emit(programInstruction{opcode: opLiteral, operand: len(this.program.literals) - 1}, 1)
+}
+
+func (this *programCompiler) compileParameter(stage *evaluationStage, optional bool) {
+
+	this.program.parameters = append(this.program.parameters, stage.parameterName)
+	this.program.parameterSpans = append(this.program.parameterSpans, stage.token.span)
+	this.emit(programInstruction{
+		opcode:   opParameter,
+		operand:  len(this.program.parameters) - 1,
+		optional: optional,
+	}, 1)
+}
+
+/*
+	If the given [stage] short-circuits, emits the branch which checks its left operand, to be placed just before the code for its right operand.
+	Returns the index of the branch, or -1 if there isn't one.
+	Everything compiled until the matching `finishBranch` is conditional.
+*/
+func (this *programCompiler) compileBranch(stage *evaluationStage) int {
+
+	if !isBranchingStage(stage) {
+		return -1
+	}
+
+	this.program.stages = append(this.program.stages, stage)
+	this.conditional++
+
+	return this.emit(programInstruction{opcode: opBranch, operand: len(this.program.stages) - 1}, 0)
+}
+
+/*
+	Points the given [branch] at the stage operator which was just compiled.
+*/
+func (this *programCompiler) finishBranch(branch int) {
+
+	if branch < 0 {
+		return
+	}
+
+	this.conditional--
+	this.program.instructions[branch].target = len(this.program.instructions) - 1
+}
+
+/*
+	Returns true if the left operand of the given [stage] might decide its result, so that the right operand needn't be computed.
+*/
+func isBranchingStage(stage *evaluationStage) bool {
+	return stage.leftStage != nil && stage.rightStage != nil && stage.isShortCircuitable()
+}
+
+func (this *programCompiler) compileOperator(stage *evaluationStage, hasLeft bool, hasRight bool) {
+
+	stackChange := 1
+	if hasLeft {
+		stackChange--
+	}
+	if hasRight {
+		stackChange--
+	}
+
+	this.program.stages = append(this.program.stages, stage)
+	this.emit(programInstruction{
+		opcode:   opStage,
+		operand:  len(this.program.stages) - 1,
+		hasLeft:  hasLeft,
+		hasRight: hasRight,
+	}, stackChange)
+}
+
+/*
+	Kernels are compiled as: the code for every leaf, which leaves their values on the stack,
+	then the kernel instruction itself, followed by the stage-by-stage code which copies those same values as it needs them.
+	If the kernel applies, it jumps past the stage-by-stage code.
+*/
+func (this *programCompiler) compileKernel(kernel *stageKernel) {
+
+	frame := this.depth
+
+	// leaves are computed before anything else, even those which only short-circuited operators use.
+	// A missing parameter is only reported if the stage-by-stage code turns out to need it.
+	for i, leaf := range kernel.leaves {
+
+		if kernel.conditional[i] && leaf.symbol == VALUE && leaf.parameterName != "" {
+			this.compileParameter(leaf, true)
+			continue
+		}
+		this.compileStage(leaf)
+	}
+
+	this.program.kernels = append(this.program.kernels, kernel)
+	kernelIndex := this.emit(programInstruction{
+		opcode:  opKernel,
+		operand: len(this.program.kernels) - 1,
+		frame:   frame,
+	}, 0)
+
+	// when every leaf comes before every operator (like "a > b"), the leaves are already on the stack
+	// in exactly the order that the stage-by-stage code would have pushed them, so they don't need to be copied.
+	// Short-circuiting operators might skip some of them, so they always copy.
+	inPlace := kernel.leavesFirst() && !kernel.hasBranchingNodes()
+
+	this.compileKernelNode(kernel, len(kernel.nodes)-1, frame, inPlace)
+
+	if !inPlace {
+		this.emit(programInstruction{opcode: opCollapse, frame: frame}, frame+1-this.depth)
+	}
+	this.program.instructions[kernelIndex].target = len(this.program.instructions)
+}
+
+/*
+	Compiles the stage-by-stage code for a single node of a kernel, and all of its operands.
+	Operators which are shared within the kernel are kept in their slot, just like any other shared stage.
+*/
+func (this *programCompiler) compileKernelNode(kernel *stageKernel, index int, frame int, inPlace bool) {
+
+	node := kernel.nodes[index]
+
+	if node.leaf >= 0 {
+		if !inPlace {
+			this.emit(programInstruction{opcode: opLoad, operand: frame + node.leaf}, 1)
+		}
+		return
+	}
+
+	shared := this.references[node.stage] > 1 && index != len(kernel.nodes)-1
+	if shared {
+
+		slot, found := this.slots[node.stage]
+		if found {
+			this.emit(programInstruction{opcode: opLoad, operand: slot}, 1)
+			return
+		}
+	}
+
+	if node.left >= 0 {
+		this.compileKernelNode(kernel, node.left, frame, inPlace)
+	}
+
+	branch := -1
+	if node.left >= 0 && node.right >= 0 {
+		branch = this.compileBranch(node.stage)
+	}
+	if node.right >= 0 {
+		this.compileKernelNode(kernel, node.right, frame, inPlace)
+	}
+
+	// parenthesis don't do anything, the value they wrap is already on the stack.
+	if node.stage.symbol != NOOP {
+		this.compileOperator(node.stage, node.left >= 0, node.right >= 0)
+	}
+	this.finishBranch(branch)
+
+	if shared && this.conditional == 0 {
+		slot := len(this.slots)
+		this.slots[node.stage] = slot
+		this.emit(programInstruction{opcode: opStore, operand: slot}, 0)
+	}
+}
+
+/*
+	Runs the given [program] with the given [parameters], returning the single value left on the stack.
+	Returns the error of [ctx] if it's done before the program finishes, and a *LimitError if it uses more than [usage] allows.
+*/
+func (this EvaluableExpression) runProgram(ctx context.Context, program *evaluationProgram, parameters Parameters, usage *evaluationUsage) (interface{}, error) {
+
+	var stackBuffer [16]programValue
+	var stack []programValue
+	var noData float32
+	var noDataLoaded bool
+	var err error
+
+	// most expressions are small enough to keep their stack on the goroutine stack.
+	if program.stackSize <= len(stackBuffer) {
+		stack = stackBuffer[:program.stackSize]
+	} else {
+		stack = make([]programValue, program.stackSize)
+	}
+
+	top := program.slots
+	instructions := program.instructions
+
+	// contexts which can never be done (like context.Background) have no channel, and don't need to be checked.
+	done := ctx.Done()
+
+	for pc := 0; pc < len(instructions); pc++ {
+
+		instruction := &instructions[pc]
+
+		switch instruction.opcode {
+
+		case opLiteral:
+			stack[top] = program.literals[instruction.operand]
+			top++
+
+		case opParameter:
+			value, err := parameters.Get(program.parameters[instruction.operand])
+			if err != nil {
+				err = locateMissingParameter(err, program.parameterSpans[instruction.operand])
+				if !instruction.optional {
+					return nil, err
+				}
+
+				stack[top] = programValue{kind: programMissing, value: err}
+				top++
+				continue
+			}
+
+			stack[top] = makeProgramValue(value)
+			top++
+
+		case opLoad:
+			stack[top] = stack[instruction.operand]
+			if stack[top].kind == programMissing {
+				return nil, stack[top].value.(error)
+			}
+			top++
+
+		case opBranch:
+			symbol := program.stages[instruction.operand].symbol
+
+			if !noDataLoaded && (symbol == TERNARY_FALSE || symbol == COALESCE) {
+
+				noData, err = getNoData(parameters)
+				if err != nil {
+					return nil, err
+				}
+				noDataLoaded = true
+			}
+
+			substitute, decided := findShortCircuitOperand(symbol, stack[top-1], noData)
+			if decided {
+				stack[top] = substitute
+				top++
+				pc = instruction.target - 1
+			}
+
+		case opStore:
+			stack[instruction.operand] = stack[top-1]
+
+		case opCollapse:
+			stack[instruction.frame] = stack[top-1]
+			top = instruction.frame + 1
+
+		case opKernel:
+			kernel := program.kernels[instruction.operand]
+
+			if done != nil && isDone(done) {
+				return nil, ctx.Err()
+			}
+
+			// without any array leaves, the kernel would never apply.
+			// nor can it if one of its parameters is missing, since only the stage-by-stage code knows whether it's needed.
+			leaves := stack[instruction.frame:top]
+			if !containsProgramArray(leaves) || containsProgramMissing(leaves) {
+				continue
+			}
+
+			var leafBuffer [8]interface{}
+			var leafValues []interface{}
+
+			if len(kernel.leaves) <= len(leafBuffer) {
+				leafValues = leafBuffer[:len(kernel.leaves)]
+			} else {
+				leafValues = make([]interface{}, len(kernel.leaves))
+			}
+
+			for i := range leafValues {
+				leafValues[i] = stack[instruction.frame+i].box()
+			}
+
+			result, fused, err := kernel.run(ctx, leafValues, parameters, usage)
+			if err != nil {
+				return nil, err
+			}
+
+			if fused {
+				stack[instruction.frame] = programValue{value: result}
+				top = instruction.frame + 1
+				pc = instruction.target - 1
+			}
+
+		case opStage:
+			var left, right programValue
+
+			stage := program.stages[instruction.operand]
+
+			if done != nil && isDone(done) {
+				return nil, ctx.Err()
+			}
+
+			if instruction.hasRight {
+				top--
+				right = stack[top]
+			}
+			if instruction.hasLeft {
+				top--
+				left = stack[top]
+			}
+
+			// numbers and bools which the stage is guaranteed to accept are handled without boxing.
+			if isTypedStage(stage.symbol, left, right) {
+
+				if !noDataLoaded && needsNoData(stage.symbol) {
+
+					noData, err = getNoData(parameters)
+					if err != nil {
+						return nil, err
+					}
+					noDataLoaded = true
+				}
+
+				stack[top] = applyTypedStage(stage.symbol, left, right, noData)
+				top++
+				continue
+			}
+
+			var leftValue, rightValue interface{}
+
+			if instruction.hasLeft {
+				leftValue = left.box()
+			}
+			if instruction.hasRight {
+				rightValue = right.box()
+			}
+
+			// pure calls which were already made with the same arguments aren't made again.
+			key, remembers := makeCallKey(stage, rightValue)
+			if remembers {
+
+				result, found := usage.remembered[key]
+				if found {
+					stack[top] = makeProgramValue(result)
+					top++
+					continue
+				}
+			}
+
+			// arrays are counted before they're computed, except for those returned by functions.
+			if stage.symbol == FUNCTIONAL {
+				err = usage.addCall()
+			} else {
+				length, _ := findArrayLength(left.value)
+				rightLength, _ := findArrayLength(right.value)
+				if rightLength > length {
+					length = rightLength
+				}
+				err = usage.addArray(length, findElementSize(stage.symbol))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			result, err := this.applyStage(stage, leftValue, rightValue, parameters)
+			if err != nil {
+				return nil, locateStageError(err, stage, leftValue, rightValue)
+			}
+
+			if stage.symbol == FUNCTIONAL {
+				err = usage.addArray(findArrayLength(result))
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if remembers {
+				usage.remember(key, result)
+			}
+
+			stack[top] = makeProgramValue(result)
+			top++
+		}
+	}
+
+	return stack[program.slots].box(), nil
+}
+
+/*
+	Identifies a call to a pure function by where it's made, and the arguments it's given.
+*/
+type callKey struct {
+	stage     *evaluationStage
+	count     int
+	arguments [maxRememberedArguments]interface{}
+}
+
+// calls with more arguments than this aren't remembered.
+const maxRememberedArguments = 4
+
+/*
+	Returns the key which the result of calling the function of [stage] with the given [arguments] is remembered by.
+	Returns false if the call shouldn't be remembered, because the function isn't pure or can read parameters,
+	or because an argument is something other than a number, bool or string (such as an array, which would be slow to compare).
+*/
+func makeCallKey(stage *evaluationStage, arguments interface{}) (callKey, bool) {
+
+	if stage.symbol != FUNCTIONAL || !stage.pure {
+		return callKey{}, false
+	}
+
+	// evaluation functions might read parameters which are different every time a declared function calls them.
+	_, evaluation := stage.token.Value.(EvaluationExpressionFunction)
+	if evaluation {
+		return callKey{}, false
+	}
+
+	ret := callKey{stage: stage}
+
+	list, ok := arguments.([]interface{})
+	if !ok {
+		if arguments == nil {
+			return ret, true
+		}
+		list = []interface{}{arguments}
+	}
+
+	if len(list) > maxRememberedArguments {
+		return callKey{}, false
+	}
+
+	for i, argument := range list {
+
+		switch argument.(type) {
+		case float32, bool, string:
+		default:
+			return callKey{}, false
+		}
+		ret.arguments[i] = argument
+	}
+
+	ret.count = len(list)
+	return ret, true
+}
+
+func (this *evaluationUsage) remember(key callKey, result interface{}) {
+
+	if this.remembered == nil {
+		this.remembered = make(map[callKey]interface{})
+	}
+	this.remembered[key] = result
+}
+
+func isDone(done <-chan struct{}) bool {
+
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+func containsProgramArray(values []programValue) bool {
+
+	for _, value := range values {
+		if value.kind == programInterface && value.value != nil {
+			switch value.value.(type) {
+			case []float32, []bool:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsProgramMissing(values []programValue) bool {
+
+	for _, value := range values {
+		if value.kind == programMissing {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Checks whether the [left] operand of a short-circuiting stage decides the result of that stage without its right operand.
+	That's the case for a single value which does (such as `false` for "&&"), or for an array where every element does.
+	If so, returns a stand-in for the right operand, which gives the same result from the stage's operator as the real one would have
+	for every element which was decided.
+*/
+func findShortCircuitOperand(symbol OperatorSymbol, left programValue, noData float32) (programValue, bool) {
+
+	switch symbol {
+
+	case AND, TERNARY_TRUE:
+		decided := false
+
+		switch {
+		case left.kind == programBool:
+			decided = !left.boolean
+		case left.kind == programInterface:
+			values, ok := left.value.([]bool)
+			decided = ok && !containsBool(values, true)
+		}
+
+		if symbol == AND {
+			return programValue{kind: programBool, boolean: false}, decided
+		}
+		return programValue{kind: programNumber}, decided
+
+	case OR:
+		decided := false
+
+		switch {
+		case left.kind == programBool:
+			decided = left.boolean
+		case left.kind == programInterface:
+			values, ok := left.value.([]bool)
+			decided = ok && !containsBool(values, false)
+		}
+		return programValue{kind: programBool, boolean: true}, decided
+
+	case TERNARY_FALSE, COALESCE:
+		decided := false
+
+		switch {
+		case left.kind == programNumber:
+			decided = left.number != noData
+		case left.kind == programInterface:
+			switch value := left.value.(type) {
+			case []float32:
+				decided = !containsNumber(value, noData)
+			case nullBranch:
+				// a null selected by "?" is kept, but an array still needs the right operand where it wasn't selected.
+				_, decided = value.taken.(bool)
+			case nil:
+			default:
+				// values other than numbers (and null) are never replaced.
+				decided = true
+			}
+		}
+		return programValue{kind: programNumber}, decided
+	}
+
+	return programValue{}, false
+}
+
+func containsBool(values []bool, value bool) bool {
+
+	for _, element := range values {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNumber(values []float32, value float32) bool {
+
+	for _, element := range values {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+func needsNoData(symbol OperatorSymbol) bool {
+
+	switch symbol {
+	case TERNARY_TRUE, TERNARY_FALSE, COALESCE:
+		return true
+	}
+	return false
+}
+
+/*
+	Returns true if the operator for [symbol] can be computed directly from the given typed values,
+	and would have accepted the same values (producing the same result) through its stage operator.
+*/
+func isTypedStage(symbol OperatorSymbol, left programValue, right programValue) bool {
+
+	switch symbol {
+	case PLUS, MINUS, MULTIPLY, DIVIDE, MODULUS, EXPONENT,
+		BITWISE_AND, BITWISE_OR, BITWISE_XOR, BITWISE_LSHIFT, BITWISE_RSHIFT,
+		EQ, NEQ, GT, LT, GTE, LTE,
+		TERNARY_FALSE, COALESCE:
+		return left.kind == programNumber && right.kind == programNumber
+
+	case AND, OR:
+		return left.kind == programBool && right.kind == programBool
+
+	case NEGATE, BITWISE_NOT:
+		return right.kind == programNumber
+
+	case INVERT:
+		return right.kind == programBool
+
+	case TERNARY_TRUE:
+		return left.kind == programBool && right.kind == programNumber
+	}
+
+	return false
+}
+
+/*
+	Computes the operator for [symbol] over values which have already been checked by `isTypedStage`,
+	without boxing them. Any operator added here needs a case in `TestOperatorImplementationsAgree`.
+*/
+func applyTypedStage(symbol OperatorSymbol, left programValue, right programValue, noData float32) programValue {
+
+	l := left.number
+	r := right.number
+
+	switch symbol {
+	case PLUS:
+		return programValue{kind: programNumber, number: l + r}
+	case MINUS:
+		return programValue{kind: programNumber, number: l - r}
+	case MULTIPLY:
+		return programValue{kind: programNumber, number: l * r}
+	case DIVIDE:
+		return programValue{kind: programNumber, number: l / r}
+	case MODULUS:
+		return programValue{kind: programNumber, number: float32(math.Mod(float64(l), float64(r)))}
+	case EXPONENT:
+		return programValue{kind: programNumber, number: float32(math.Pow(float64(l), float64(r)))}
+	case BITWISE_AND:
+		return programValue{kind: programNumber, number: float32(int64(l) & int64(r))}
+	case BITWISE_OR:
+		return programValue{kind: programNumber, number: float32(int64(l) | int64(r))}
+	case BITWISE_XOR:
+		return programValue{kind: programNumber, number: float32(int64(l) ^ int64(r))}
+	case BITWISE_LSHIFT:
+		return programValue{kind: programNumber, number: float32(uint64(l) << uint64(r))}
+	case BITWISE_RSHIFT:
+		return programValue{kind: programNumber, number: float32(uint64(l) >> uint64(r))}
+	case EQ:
+		return programValue{kind: programBool, boolean: l == r}
+	case NEQ:
+		return programValue{kind: programBool, boolean: l != r}
+	case GT:
+		return programValue{kind: programBool, boolean: l > r}
+	case LT:
+		return programValue{kind: programBool, boolean: l < r}
+	case GTE:
+		return programValue{kind: programBool, boolean: l >= r}
+	case LTE:
+		return programValue{kind: programBool, boolean: l <= r}
+	case AND:
+		return programValue{kind: programBool, boolean: left.boolean && right.boolean}
+	case OR:
+		return programValue{kind: programBool, boolean: left.boolean || right.boolean}
+	case NEGATE:
+		return programValue{kind: programNumber, number: -r}
+	case INVERT:
+		return programValue{kind: programBool, boolean: !right.boolean}
+	case BITWISE_NOT:
+		return programValue{kind: programNumber, number: float32(^int64(r))}
+	case TERNARY_TRUE:
+		if left.boolean {
+			return right
+		}
+		return programValue{kind: programNumber, number: noData}
+	case TERNARY_FALSE, COALESCE:
+		if l == noData {
+			return right
+		}
+		return left
+	}
+
+	return programValue{}
+}
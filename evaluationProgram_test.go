@@ -0,0 +1,311 @@
+package govaluate
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+/*
+	Tests that compiled programs produce the same results, and the same errors, as applying every stage of the planned tree in turn.
+*/
+func TestProgramEquivalence(test *testing.T) {
+
+	functions := map[string]ExpressionFunction{
+		"sum": func(arguments ...interface{}) (interface{}, error) {
+
+			var ret float32
+			for _, argument := range arguments {
+				ret += argument.(float32)
+			}
+			return ret, nil
+		},
+	}
+
+	parameters := map[string]interface{}{
+		"a":      1,
+		"b":      2.5,
+		"s":      "text",
+		"t":      true,
+		"arr":    []float32{1, 2, 3},
+		"foo":    dummyParameter{String: "string!", Int: 101},
+		"nodata": float32(-1),
+		"n":      nil,
+	}
+
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"(a + b) ** 2 % 3",
+		"-a + ~2 << 1 >> 1 | 4 & 5 ^ 6",
+		"a < b && b >= 2 || !t",
+		"a == 1 && b != 1",
+		"s + 'y' == 'texty'",
+		"s > 'abc'",
+		"s =~ 't.*' && s !~ 'x'",
+		"a in (1, 2, 3)",
+		"a > b ? a : b",
+		"a < b ? a + 1 : b",
+		"a ?? b",
+		"-1 ?? b",
+		"sum(a, b, 1) * 2",
+		"foo.Int + a",
+		"foo.FuncArgStr(s)",
+		"arr * a > 2 ? arr : a",
+		"(arr + 1) * (arr - 1)",
+		"(a + b) * (a + b) - (a + b)",
+		"(arr + a) * (arr + a) > 4 ? (arr + a) : a",
+		"sum(a, b) + sum(a, b) * sum(b, a)",
+		"n + a ?? b",
+		"arr == null || arr is null",
+		"arr * n ?? arr",
+		"t && n || n",
+		"n ? a : b",
+		"s ?? a",
+
+		// errors
+		"s - 1",
+		"a && t",
+		"t ? s : 1",
+		"missing + 1",
+		"arr + foo.Int * arr > s",
+	}
+
+	for _, input := range inputs {
+
+		expression, err := NewEvaluableExpressionWithFunctions(input, functions)
+		if err != nil {
+			test.Logf("Expression '%s' failed to parse: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		compiledResult, compiledErr := expression.Evaluate(parameters)
+
+		sanitized := &sanitizedParameters{orig: MapParameters(parameters)}
+		treeResult, treeErr := evaluateStageTree(*expression, expression.evaluationStages, sanitized)
+
+		if fmt.Sprint(compiledErr) != fmt.Sprint(treeErr) {
+			test.Logf("Expression '%s' returned error '%v', expected '%v'", input, compiledErr, treeErr)
+			test.Fail()
+			continue
+		}
+
+		if !reflect.DeepEqual(compiledResult, treeResult) {
+			test.Logf("Expression '%s' returned '%v', expected '%v'", input, compiledResult, treeResult)
+			test.Fail()
+		}
+	}
+}
+
+func TestProgramWithoutTypeChecks(test *testing.T) {
+
+	expression, _ := NewEvaluableExpression("(a + 1) * 2 > 3 && b")
+	expression.ChecksTypes = false
+
+	result, err := expression.Evaluate(map[string]interface{}{"a": 1, "b": true})
+	if err != nil || result != true {
+		test.Logf("Expected 'true', got '%v' (%v)", result, err)
+		test.Fail()
+	}
+}
+
+func TestProgramDeepNesting(test *testing.T) {
+
+	input := "1"
+	for i := 0; i < 200; i++ {
+		input = fmt.Sprintf("(%s + a)", input)
+	}
+
+	expression, err := NewEvaluableExpression(input)
+	if err != nil {
+		test.Logf("Failed to parse: %v", err)
+		test.FailNow()
+	}
+
+	result, err := expression.Evaluate(map[string]interface{}{"a": 1})
+	if err != nil || result != float32(201) {
+		test.Logf("Expected '201', got '%v' (%v)", result, err)
+		test.Fail()
+	}
+}
+
+/*
+	Represents a test of short-circuiting, which counts how many times the right operand calls a function.
+*/
+type ShortCircuitTest struct {
+	Name       string
+	Input      string
+	Parameters map[string]interface{}
+	Expected   interface{}
+	Calls      int
+}
+
+func TestShortCircuit(test *testing.T) {
+
+	var calls int
+
+	functions := map[string]ExpressionFunction{
+		"count": func(arguments ...interface{}) (interface{}, error) {
+			calls++
+			return float32(5), nil
+		},
+	}
+
+	shortCircuitTests := []ShortCircuitTest{
+
+		ShortCircuitTest{
+			Name:     "Or",
+			Input:    "true || count() > 0",
+			Expected: true,
+		},
+		ShortCircuitTest{
+			Name:       "And",
+			Input:      "t && count() > 0",
+			Parameters: map[string]interface{}{"t": false},
+			Expected:   false,
+		},
+		ShortCircuitTest{
+			Name:       "And needing right",
+			Input:      "t && count() > 0",
+			Parameters: map[string]interface{}{"t": true},
+			Expected:   true,
+			Calls:      1,
+		},
+		ShortCircuitTest{
+			Name:       "Ternary",
+			Input:      "a > 0 ? count() : 2",
+			Parameters: map[string]interface{}{"a": -1, "nodata": float32(-9999)},
+			Expected:   float32(2),
+		},
+		ShortCircuitTest{
+			Name:       "Ternary else",
+			Input:      "a > 0 ? 1 : count()",
+			Parameters: map[string]interface{}{"a": 1, "nodata": float32(-9999)},
+			Expected:   float32(1),
+		},
+		ShortCircuitTest{
+			Name:       "Coalesce",
+			Input:      "a ?? count()",
+			Parameters: map[string]interface{}{"a": 1, "nodata": float32(-1)},
+			Expected:   float32(1),
+		},
+		ShortCircuitTest{
+			Name:       "Coalesce needing right",
+			Input:      "a ?? count()",
+			Parameters: map[string]interface{}{"a": -1, "nodata": float32(-1)},
+			Expected:   float32(5),
+			Calls:      1,
+		},
+		ShortCircuitTest{
+			Name:       "Array decided everywhere",
+			Input:      "m ? count() : 0",
+			Parameters: map[string]interface{}{"m": []bool{false, false}, "nodata": float32(-1)},
+			Expected:   []float32{0, 0},
+		},
+		ShortCircuitTest{
+			Name:       "Array needing right",
+			Input:      "m ? count() : 0",
+			Parameters: map[string]interface{}{"m": []bool{false, true}, "nodata": float32(-1)},
+			Expected:   []float32{0, 5},
+			Calls:      1,
+		},
+		ShortCircuitTest{
+			Name:       "Scalar deciding for an array",
+			Input:      "a > 0 && b > 0",
+			Parameters: map[string]interface{}{"a": 0, "b": []float32{1, 2}},
+			Expected:   false,
+		},
+		ShortCircuitTest{
+			Name:       "Missing parameter",
+			Input:      "a > 0 && missing > 0",
+			Parameters: map[string]interface{}{"a": 0},
+			Expected:   false,
+		},
+		ShortCircuitTest{
+			Name:       "Missing array parameter",
+			Input:      "a > 0 && missing > 0",
+			Parameters: map[string]interface{}{"a": []float32{0, -1}},
+			Expected:   []bool{false, false},
+		},
+	}
+
+	for _, shortCircuitTest := range shortCircuitTests {
+
+		expression, err := NewEvaluableExpressionWithFunctions(shortCircuitTest.Input, functions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: '%s'", shortCircuitTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		calls = 0
+
+		result, err := expression.Evaluate(shortCircuitTest.Parameters)
+		if err != nil {
+			test.Logf("Test '%s' failed: %v", shortCircuitTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		if !reflect.DeepEqual(result, shortCircuitTest.Expected) {
+			test.Logf("Test '%s' failed", shortCircuitTest.Name)
+			test.Logf("Evaluation result '%v' does not match expected: '%v'", result, shortCircuitTest.Expected)
+			test.Fail()
+		}
+
+		if calls != shortCircuitTest.Calls {
+			test.Logf("Test '%s' called the function %d times, expected %d", shortCircuitTest.Name, calls, shortCircuitTest.Calls)
+			test.Fail()
+		}
+	}
+}
+
+func TestShortCircuitErrors(test *testing.T) {
+
+	expression, _ := NewEvaluableExpression("a > 0 && missing > 0")
+
+	_, err := expression.Evaluate(map[string]interface{}{"a": []float32{0, 1}})
+	if err == nil || err.Error() != "No parameter 'missing' found." {
+		test.Logf("Expected missing parameter error, got: %v", err)
+		test.Fail()
+	}
+}
+
+/*
+	Reference evaluator, which walks the planned tree and applies every stage, ignoring kernels.
+*/
+func evaluateStageTree(expression EvaluableExpression, stage *evaluationStage, parameters Parameters) (interface{}, error) {
+
+	var left, right interface{}
+	var err error
+
+	if stage.leftStage != nil {
+		left, err = evaluateStageTree(expression, stage.leftStage, parameters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stage.rightStage != nil {
+
+		if isBranchingStage(stage) {
+
+			noData, err := getNoData(parameters)
+			if err != nil {
+				return nil, err
+			}
+
+			substitute, decided := findShortCircuitOperand(stage.symbol, makeProgramValue(left), noData)
+			if decided {
+				return expression.applyStage(stage, left, substitute.box(), parameters)
+			}
+		}
+
+		right, err = evaluateStageTree(expression, stage.rightStage, parameters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return expression.applyStage(stage, left, right, parameters)
+}
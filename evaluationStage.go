@@ -1,6 +1,7 @@
 package govaluate
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -40,6 +41,25 @@ type evaluationStage struct {
 
 	// regardless of which type check is used, this string format will be used as the error message for type errors
 	typeErrorFormat string
+
+	// if this stage reads a parameter, the name of that parameter.
+	parameterName string
+
+	// if this stage accesses a parameter's fields or methods, the parameter name followed by each field or method name.
+	accessorPath []string
+
+	// if this stage calls a function, the name of that function, and whether or not it's pure.
+	functionName string
+	pure         bool
+
+	// if this stage is a "?" whose result is given to a ":", which needs to tell a null it selected apart from a branch it didn't.
+	elseFollows bool
+
+	// if this stage is the root of a subtree of element-wise operators, this computes the whole subtree in one pass.
+	kernel *stageKernel
+
+	// the token that this stage was planned from, if any. For parenthesis, its span covers everything up to the closing parenthesis.
+	token ExpressionToken
 }
 
 var (
@@ -62,6 +82,11 @@ func (this *evaluationStage) setToNonStage(other evaluationStage) {
 	this.rightTypeCheck = other.rightTypeCheck
 	this.typeCheck = other.typeCheck
 	this.typeErrorFormat = other.typeErrorFormat
+	this.parameterName = other.parameterName
+	this.accessorPath = other.accessorPath
+	this.functionName = other.functionName
+	this.pure = other.pure
+	this.token = other.token
 }
 
 func (this *evaluationStage) isShortCircuitable() bool {
@@ -115,7 +140,7 @@ func addStage(left interface{}, right interface{}, parameters Parameters) (inter
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -145,7 +170,7 @@ func addStage(left interface{}, right interface{}, parameters Parameters) (inter
 		return lx + rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for addition")
+	return nil, newOperandError("addition", left, right)
 
 }
 func subtractStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
@@ -157,7 +182,7 @@ func subtractStage(left interface{}, right interface{}, parameters Parameters) (
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -187,7 +212,7 @@ func subtractStage(left interface{}, right interface{}, parameters Parameters) (
 		return lx - rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for subtraction")
+	return nil, newOperandError("subtraction", left, right)
 }
 func multiplyStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]float32)
@@ -198,7 +223,7 @@ func multiplyStage(left interface{}, right interface{}, parameters Parameters) (
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -228,7 +253,7 @@ func multiplyStage(left interface{}, right interface{}, parameters Parameters) (
 		return lx * rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for multiplication")
+	return nil, newOperandError("multiplication", left, right)
 }
 func divideStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]float32)
@@ -239,7 +264,7 @@ func divideStage(left interface{}, right interface{}, parameters Parameters) (in
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -269,7 +294,7 @@ func divideStage(left interface{}, right interface{}, parameters Parameters) (in
 		return lx / rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for division")
+	return nil, newOperandError("division", left, right)
 }
 func exponentStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]float32)
@@ -280,7 +305,7 @@ func exponentStage(left interface{}, right interface{}, parameters Parameters) (
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -310,7 +335,7 @@ func exponentStage(left interface{}, right interface{}, parameters Parameters) (
 		return float32(math.Pow(float64(lx), float64(rx))), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for exponential")
+	return nil, newOperandError("exponential", left, right)
 
 }
 func modulusStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
@@ -322,7 +347,7 @@ func modulusStage(left interface{}, right interface{}, parameters Parameters) (i
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -352,7 +377,7 @@ func modulusStage(left interface{}, right interface{}, parameters Parameters) (i
 		return float32(math.Mod(float64(lx), float64(rx))), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for modulus")
+	return nil, newOperandError("modulus", left, right)
 }
 func gteStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	if isString(left) && isString(right) {
@@ -367,7 +392,7 @@ func gteStage(left interface{}, right interface{}, parameters Parameters) (inter
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -397,7 +422,7 @@ func gteStage(left interface{}, right interface{}, parameters Parameters) (inter
 		return lx >= rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for >=")
+	return nil, newOperandError(">=", left, right)
 }
 func gtStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	if isString(left) && isString(right) {
@@ -412,7 +437,7 @@ func gtStage(left interface{}, right interface{}, parameters Parameters) (interf
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -442,7 +467,7 @@ func gtStage(left interface{}, right interface{}, parameters Parameters) (interf
 		return lx > rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for >")
+	return nil, newOperandError(">", left, right)
 }
 func lteStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	if isString(left) && isString(right) {
@@ -457,7 +482,7 @@ func lteStage(left interface{}, right interface{}, parameters Parameters) (inter
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -487,7 +512,7 @@ func lteStage(left interface{}, right interface{}, parameters Parameters) (inter
 		return lx <= rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for <=")
+	return nil, newOperandError("<=", left, right)
 }
 func ltStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	if isString(left) && isString(right) {
@@ -501,7 +526,7 @@ func ltStage(left interface{}, right interface{}, parameters Parameters) (interf
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -531,7 +556,7 @@ func ltStage(left interface{}, right interface{}, parameters Parameters) (interf
 		return lx < rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for <")
+	return nil, newOperandError("<", left, right)
 }
 func equalStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	ls, lsok := left.(string)
@@ -548,7 +573,7 @@ func equalStage(left interface{}, right interface{}, parameters Parameters) (int
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -578,7 +603,7 @@ func equalStage(left interface{}, right interface{}, parameters Parameters) (int
 		return lx == rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for ==")
+	return nil, newOperandError("==", left, right)
 }
 func notEqualStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	ls, lsok := left.(string)
@@ -595,7 +620,7 @@ func notEqualStage(left interface{}, right interface{}, parameters Parameters) (
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -625,7 +650,7 @@ func notEqualStage(left interface{}, right interface{}, parameters Parameters) (
 		return lx != rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for !=")
+	return nil, newOperandError("!=", left, right)
 }
 func andStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]bool)
@@ -636,7 +661,7 @@ func andStage(left interface{}, right interface{}, parameters Parameters) (inter
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -666,9 +691,7 @@ func andStage(left interface{}, right interface{}, parameters Parameters) (inter
 		return lx && rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for &&")
-
-	return boolIface(left.(bool) && right.(bool)), nil
+	return nil, newOperandError("&&", left, right)
 }
 func orStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]bool)
@@ -679,7 +702,7 @@ func orStage(left interface{}, right interface{}, parameters Parameters) (interf
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]bool, len(lax))
@@ -709,7 +732,7 @@ func orStage(left interface{}, right interface{}, parameters Parameters) (interf
 		return lx || rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for ||")
+	return nil, newOperandError("||", left, right)
 
 }
 func negateStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
@@ -728,7 +751,7 @@ func negateStage(left interface{}, right interface{}, parameters Parameters) (in
 		return -rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for -")
+	return nil, newOperandError("-", left, right)
 }
 func invertStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	rax, raok := right.([]bool)
@@ -746,7 +769,7 @@ func invertStage(left interface{}, right interface{}, parameters Parameters) (in
 		return !rx, nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for !")
+	return nil, newOperandError("!", left, right)
 }
 func bitwiseNotStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	rax, raok := right.([]float32)
@@ -764,7 +787,7 @@ func bitwiseNotStage(left interface{}, right interface{}, parameters Parameters)
 		return float32(^int64(rx)), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for ^")
+	return nil, newOperandError("^", left, right)
 }
 func ternaryIfStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	noData, err := getNoData(parameters)
@@ -780,7 +803,7 @@ func ternaryIfStage(left interface{}, right interface{}, parameters Parameters)
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -826,7 +849,7 @@ func ternaryIfStage(left interface{}, right interface{}, parameters Parameters)
 		}
 	}
 
-	return nil, fmt.Errorf("invalid operand for ternary if")
+	return nil, newOperandError("ternary if", left, right)
 }
 func ternaryElseStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	noData, err := getNoData(parameters)
@@ -842,7 +865,7 @@ func ternaryElseStage(left interface{}, right interface{}, parameters Parameters
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -888,7 +911,7 @@ func ternaryElseStage(left interface{}, right interface{}, parameters Parameters
 		}
 	}
 
-	return nil, fmt.Errorf("invalid operand for ternary else")
+	return nil, newOperandError("ternary else", left, right)
 }
 
 func regexStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
@@ -928,7 +951,7 @@ func bitwiseOrStage(left interface{}, right interface{}, parameters Parameters)
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -958,7 +981,7 @@ func bitwiseOrStage(left interface{}, right interface{}, parameters Parameters)
 		return float32(int64(lx) | int64(rx)), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for |")
+	return nil, newOperandError("|", left, right)
 
 }
 func bitwiseAndStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
@@ -970,7 +993,7 @@ func bitwiseAndStage(left interface{}, right interface{}, parameters Parameters)
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -1000,7 +1023,7 @@ func bitwiseAndStage(left interface{}, right interface{}, parameters Parameters)
 		return float32(int64(lx) & int64(rx)), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for &")
+	return nil, newOperandError("&", left, right)
 }
 func bitwiseXORStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]float32)
@@ -1011,7 +1034,7 @@ func bitwiseXORStage(left interface{}, right interface{}, parameters Parameters)
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -1041,7 +1064,7 @@ func bitwiseXORStage(left interface{}, right interface{}, parameters Parameters)
 		return float32(int64(lx) ^ int64(rx)), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for ^")
+	return nil, newOperandError("^", left, right)
 }
 func leftShiftStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]float32)
@@ -1052,7 +1075,7 @@ func leftShiftStage(left interface{}, right interface{}, parameters Parameters)
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -1082,7 +1105,7 @@ func leftShiftStage(left interface{}, right interface{}, parameters Parameters)
 		return float32(uint64(lx) << uint64(rx)), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for <<")
+	return nil, newOperandError("<<", left, right)
 }
 func rightShiftStage(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
 	lax, laok := left.([]float32)
@@ -1093,7 +1116,7 @@ func rightShiftStage(left interface{}, right interface{}, parameters Parameters)
 
 	if laok && raok {
 		if len(lax) != len(rax) {
-			return nil, fmt.Errorf("different array sizes: %v, %v", len(lax), len(rax))
+			return nil, &ArrayShapeError{Left: len(lax), Right: len(rax)}
 		}
 
 		res := make([]float32, len(lax))
@@ -1123,7 +1146,7 @@ func rightShiftStage(left interface{}, right interface{}, parameters Parameters)
 		return float32(uint64(lx) >> uint64(rx)), nil
 	}
 
-	return nil, fmt.Errorf("invalid operand for >>")
+	return nil, newOperandError(">>", left, right)
 }
 
 func makeParameterStage(parameterName string) evaluationOperator {
@@ -1161,6 +1184,104 @@ func makeFunctionStage(function ExpressionFunction) evaluationOperator {
 	}
 }
 
+func makeContextFunctionStage(function ContextExpressionFunction) evaluationOperator {
+
+	return func(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+		ctx := findContext(parameters)
+
+		if right == nil {
+			return function(ctx)
+		}
+
+		switch right.(type) {
+		case []interface{}:
+			return function(ctx, right.([]interface{})...)
+		default:
+			return function(ctx, right)
+		}
+	}
+}
+
+func makeEvaluationFunctionStage(function EvaluationExpressionFunction) evaluationOperator {
+
+	return func(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+		evaluation := &EvaluationContext{
+			Context:    findContext(parameters),
+			Parameters: parameters,
+		}
+
+		if right == nil {
+			return function(evaluation)
+		}
+
+		switch right.(type) {
+		case []interface{}:
+			return function(evaluation, right.([]interface{})...)
+		default:
+			return function(evaluation, right)
+		}
+	}
+}
+
+/*
+	Returns the operator which calls the given [function] called [name], which is one of the kinds returned by `findDefinedFunction`.
+	Returns false if it isn't any of them.
+	Errors returned by Go functions are wrapped in a `FunctionError`. Those from declared functions come from their own stages, so are left as they are.
+*/
+func makeCallStage(name string, function interface{}) (evaluationOperator, bool) {
+
+	var operator evaluationOperator
+
+	switch typed := function.(type) {
+	case ExpressionFunction:
+		operator = makeFunctionStage(typed)
+	case ContextExpressionFunction:
+		operator = makeContextFunctionStage(typed)
+	case EvaluationExpressionFunction:
+		operator = makeEvaluationFunctionStage(typed)
+	case *declaredFunction:
+		return typed.operator(), true
+	default:
+		return nil, false
+	}
+
+	return func(left interface{}, right interface{}, parameters Parameters) (interface{}, error) {
+
+		result, err := operator(left, right, parameters)
+		if err != nil {
+			return nil, newFunctionError(name, err, parameters)
+		}
+		return result, nil
+	}, true
+}
+
+/*
+	Returns whether or not calls to the given [function] can see more of the evaluation than their arguments,
+	such as the parameters, so that identical calls may return different results in different places.
+*/
+func readsEvaluation(function interface{}) bool {
+
+	switch function.(type) {
+	case EvaluationExpressionFunction, *declaredFunction:
+		return true
+	}
+	return false
+}
+
+/*
+	Returns the context that the given [parameters] are being evaluated with, if any.
+*/
+func findContext(parameters Parameters) context.Context {
+
+	sanitized, ok := parameters.(*sanitizedParameters)
+	if ok && sanitized.context != nil {
+		return sanitized.context
+	}
+	return context.Background()
+}
+
 func typeConvertParam(p reflect.Value, t reflect.Type) (ret reflect.Value, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -1324,7 +1445,11 @@ func separatorStage(left interface{}, right interface{}, parameters Parameters)
 
 	switch left.(type) {
 	case []interface{}:
-		ret = append(left.([]interface{}), right)
+		// the left list may also be used by another stage, so it's never appended to in-place.
+		previous := left.([]interface{})
+		ret = make([]interface{}, len(previous), len(previous)+1)
+		copy(ret, previous)
+		ret = append(ret, right)
 	default:
 		ret = []interface{}{left, right}
 	}
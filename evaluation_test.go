@@ -1,6 +1,7 @@
 package govaluate
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -1514,3 +1515,85 @@ func runEvaluationTests(evaluationTests []EvaluationTest, test *testing.T) {
 		}
 	}
 }
+
+func TestEvalContext(test *testing.T) {
+
+	type contextKey string
+
+	var calls int
+	var cancel context.CancelFunc
+
+	definitions := map[string]FunctionDefinition{
+		"lookup": FunctionDefinition{
+			ContextFunction: func(ctx context.Context, arguments ...interface{}) (interface{}, error) {
+				return ctx.Value(contextKey(arguments[0].(string))), nil
+			},
+		},
+		"cancel": FunctionDefinition{
+			ContextFunction: func(ctx context.Context, arguments ...interface{}) (interface{}, error) {
+				cancel()
+				return float32(1), nil
+			},
+		},
+		"count": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				calls++
+				return float32(1), nil
+			},
+		},
+	}
+
+	// context functions see the context that the expression was evaluated with.
+	expression, _ := NewEvaluableExpressionWithDefinitions("lookup('name') + '!'", definitions)
+
+	ctx := context.WithValue(context.Background(), contextKey("name"), "value")
+	result, err := expression.EvalContext(ctx, nil)
+	if err != nil || result != "value!" {
+		test.Logf("Expected 'value!', got '%v' (%v)", result, err)
+		test.Fail()
+	}
+
+	// without a context, they see the background context. Its missing value is null, which the concatenation propagates.
+	result, err = expression.Eval(nil)
+	if err != nil || result != nil {
+		test.Logf("Expected null, got '%v' (%v)", result, err)
+		test.Fail()
+	}
+
+	// a context which is already done stops evaluation before it starts.
+	expression, _ = NewEvaluableExpressionWithDefinitions("count() + 1", definitions)
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	calls = 0
+
+	_, err = expression.EvalContext(ctx, nil)
+	if err != context.DeadlineExceeded || calls != 0 {
+		test.Logf("Expected deadline error without any calls, got '%v' after %d calls", err, calls)
+		test.Fail()
+	}
+	cancel()
+
+	// cancellation is noticed before the next stage.
+	expression, _ = NewEvaluableExpressionWithDefinitions("cancel() + count()", definitions)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	calls = 0
+
+	_, err = expression.EvalContext(ctx, nil)
+	if err != context.Canceled || calls != 0 {
+		test.Logf("Expected cancellation without any calls, got '%v' after %d calls", err, calls)
+		test.Fail()
+	}
+
+	// and before a kernel gets to work on its arrays.
+	expression, _ = NewEvaluableExpressionWithDefinitions("a * 2 + cancel()", definitions)
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	_, err = expression.EvalContext(ctx, MapParameters{"a": make([]float32, 100000)})
+	if err != context.Canceled {
+		test.Logf("Expected cancellation of the kernel, got '%v'", err)
+		test.Fail()
+	}
+	cancel()
+}
@@ -0,0 +1,145 @@
+package govaluate
+
+import (
+	"container/list"
+	"sync"
+)
+
+/*
+	Keeps the most recently used expressions which were parsed with one set of functions, so that the same text isn't parsed again.
+	The expressions it returns are shared between every caller which asks for the same text, which is safe as long as none of them change it.
+	All of its methods may be called from many goroutines at once.
+*/
+type ExpressionCache struct {
+	definitions map[string]FunctionDefinition
+	limits      Limits
+	capacity    int
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+
+	// the cached expressions, most recently used first.
+	order *list.List
+
+	hits, misses, evictions uint64
+}
+
+/*
+	Counts how well an `ExpressionCache` has been doing since it was made.
+*/
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+
+	// the number of expressions currently cached.
+	Size int
+}
+
+type cacheEntry struct {
+	expression string
+	value      *EvaluableExpression
+}
+
+/*
+	Creates a cache which parses expressions with the given [definitions], and keeps up to [capacity] of them.
+	When it's full, the least recently used expression is dropped. A [capacity] of zero or less means that nothing is ever dropped.
+	The definitions are copied, so changing the map afterwards doesn't affect the cache.
+*/
+func NewExpressionCache(capacity int, definitions map[string]FunctionDefinition) *ExpressionCache {
+	return NewExpressionCacheWithLimits(capacity, definitions, Limits{})
+}
+
+/*
+	Similar to [NewExpressionCache], except that every expression is parsed with the given [limits].
+*/
+func NewExpressionCacheWithLimits(capacity int, definitions map[string]FunctionDefinition, limits Limits) *ExpressionCache {
+
+	copied := make(map[string]FunctionDefinition, len(definitions))
+	for name, definition := range definitions {
+		copied[name] = definition
+	}
+
+	return &ExpressionCache{
+		definitions: copied,
+		limits:      limits,
+		capacity:    capacity,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+/*
+	Returns the parsed form of the given [expression], parsing it only if it isn't already cached.
+	Expressions which fail to parse aren't cached, and return the same error every time they're asked for.
+*/
+func (this *ExpressionCache) Get(expression string) (*EvaluableExpression, error) {
+
+	this.mutex.Lock()
+
+	element, found := this.entries[expression]
+	if found {
+		this.hits++
+		this.order.MoveToFront(element)
+		this.mutex.Unlock()
+		return element.Value.(*cacheEntry).value, nil
+	}
+
+	this.misses++
+	this.mutex.Unlock()
+
+	// parsing can take a while, so other expressions may be fetched in the meantime.
+	parsed, err := NewEvaluableExpressionWithLimits(expression, this.definitions, this.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	// another goroutine may have parsed the same expression first, in which case everyone should share its result.
+	element, found = this.entries[expression]
+	if found {
+		this.order.MoveToFront(element)
+		return element.Value.(*cacheEntry).value, nil
+	}
+
+	this.entries[expression] = this.order.PushFront(&cacheEntry{expression: expression, value: parsed})
+
+	for this.capacity > 0 && this.order.Len() > this.capacity {
+
+		oldest := this.order.Back()
+		this.order.Remove(oldest)
+		delete(this.entries, oldest.Value.(*cacheEntry).expression)
+		this.evictions++
+	}
+	return parsed, nil
+}
+
+/*
+	Returns how many times expressions were found in the cache, or had to be parsed, or were dropped.
+*/
+func (this *ExpressionCache) Stats() CacheStats {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return CacheStats{
+		Hits:      this.hits,
+		Misses:    this.misses,
+		Evictions: this.evictions,
+		Size:      this.order.Len(),
+	}
+}
+
+/*
+	Drops every cached expression. The statistics are kept.
+*/
+func (this *ExpressionCache) Purge() {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.entries = make(map[string]*list.Element)
+	this.order.Init()
+}
@@ -0,0 +1,145 @@
+package govaluate
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestExpressionCache(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"double": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return arguments[0].(float32) * 2, nil
+			},
+		},
+	}
+
+	cache := NewExpressionCache(2, definitions)
+
+	// changing the definitions afterwards shouldn't affect the cache.
+	delete(definitions, "double")
+
+	first, err := cache.Get("double(x) + 1")
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	again, _ := cache.Get("double(x) + 1")
+	if again != first {
+		test.Logf("Expected the cached expression to be returned again")
+		test.Fail()
+	}
+
+	cache.Get("x + 2")
+	cache.Get("double(x) + 1")
+	cache.Get("x + 3")
+
+	// "x + 2" was the least recently used, so it should have been dropped.
+	stats := cache.Stats()
+	expected := CacheStats{Hits: 2, Misses: 3, Evictions: 1, Size: 2}
+
+	if stats != expected {
+		test.Logf("Expected stats %+v, got %+v", expected, stats)
+		test.Fail()
+	}
+
+	cache.Get("x + 2")
+	cache.Get("x + 3")
+
+	stats = cache.Stats()
+	if stats.Misses != 4 || stats.Hits != 3 {
+		test.Logf("Expected only the dropped expression to be parsed again, got %+v", stats)
+		test.Fail()
+	}
+
+	_, err = cache.Get("x +")
+	if err == nil || cache.Stats().Size != 2 {
+		test.Logf("Expected a parse error which isn't cached, got %v", err)
+		test.Fail()
+	}
+
+	cache.Purge()
+	if cache.Stats().Size != 0 {
+		test.Logf("Expected an empty cache after purging")
+		test.Fail()
+	}
+}
+
+func TestExpressionCacheLimits(test *testing.T) {
+
+	cache := NewExpressionCacheWithLimits(0, nil, Limits{MaxTokens: 3})
+
+	_, err := cache.Get("a + b + c")
+	if _, ok := err.(*LimitError); !ok {
+		test.Logf("Expected a limit error, got %v", err)
+		test.Fail()
+	}
+}
+
+/*
+	Evaluates shared expressions from many goroutines at once. Best run with -race.
+*/
+func TestConcurrentEvaluation(test *testing.T) {
+
+	cache := NewExpressionCache(0, nil)
+	inputs := []string{
+		"x * 2 + x * 2 > 10 ? x : -x",
+		"xs * 2 + 1 > 4 && xs != 3",
+		"(x + 1) * (x + 1) in (4, 9, 16)",
+	}
+
+	var group sync.WaitGroup
+	failures := make(chan string, 64)
+
+	for worker := 0; worker < 16; worker++ {
+
+		group.Add(1)
+		go func(worker int) {
+
+			defer group.Done()
+
+			for i := 0; i < 200; i++ {
+
+				x := float32((worker + i) % 5)
+				parameters := map[string]interface{}{
+					"x":  x,
+					"xs": []float32{x, x + 1, x + 2},
+				}
+
+				for _, input := range inputs {
+
+					expression, err := cache.Get(input)
+					if err != nil {
+						failures <- err.Error()
+						return
+					}
+
+					reference, _ := NewEvaluableExpression(input)
+
+					actual, actualErr := expression.Evaluate(parameters)
+					expected, expectedErr := reference.Evaluate(parameters)
+
+					if !reflect.DeepEqual(actual, expected) || (actualErr == nil) != (expectedErr == nil) {
+						failures <- input
+						return
+					}
+				}
+			}
+		}(worker)
+	}
+
+	group.Wait()
+	close(failures)
+
+	for failure := range failures {
+		test.Logf("Concurrent evaluation gave a different result for '%s'", failure)
+		test.Fail()
+	}
+
+	if cache.Stats().Size != len(inputs) {
+		test.Logf("Expected %d cached expressions, got %+v", len(inputs), cache.Stats())
+		test.Fail()
+	}
+}
@@ -0,0 +1,159 @@
+package govaluate
+
+/*
+	Everything that an expression reads from its parameters, and the functions it calls, each in the order they first appear.
+*/
+type dependencies struct {
+	variables   orderedNames
+	functions   orderedNames
+	accessors   orderedNames
+	conditional orderedNames
+
+	// variables which are read on every evaluation.
+	unconditional map[string]bool
+}
+
+type orderedNames struct {
+	names []string
+	seen  map[string]bool
+}
+
+func (this *orderedNames) add(name string) {
+
+	if this.seen == nil {
+		this.seen = make(map[string]bool)
+	}
+
+	if this.seen[name] {
+		return
+	}
+	this.seen[name] = true
+	this.names = append(this.names, name)
+}
+
+/*
+	Returns the names of the parameters used by this expression, each only once, in the order they first appear.
+	Unlike `Vars`, this includes parameters which are only used through accessors, like `foo` in `foo.Bar`.
+*/
+func (this EvaluableExpression) Variables() []string {
+	return this.findDependencies().variables.names
+}
+
+/*
+	Returns the names of the functions called by this expression, each only once, in the order they first appear.
+*/
+func (this EvaluableExpression) Functions() []string {
+	return this.findDependencies().functions.names
+}
+
+/*
+	Returns every accessor used by this expression, like `foo.Bar.Baz`, each only once, in the order they first appear.
+*/
+func (this EvaluableExpression) Accessors() []string {
+	return this.findDependencies().accessors.names
+}
+
+/*
+	Returns the parameters which this expression may not need, depending on the values of other parameters.
+	These are only used on one side of a ternary, or on the right of `&&`, `||` or `??`, so whether they're read depends on what's on the left.
+	A parameter which is also used anywhere that's always evaluated isn't included, and neither is one which both sides of a ternary use.
+
+	Any parameter which isn't given is still an error if the expression does end up reading it.
+	When the left of a short-circuiting operator is an array, the right is read regardless.
+*/
+func (this EvaluableExpression) ConditionalVariables() []string {
+
+	found := this.findDependencies()
+
+	var ret []string
+	for _, name := range found.conditional.names {
+		if !found.unconditional[name] {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+func (this EvaluableExpression) findDependencies() *dependencies {
+
+	ret := &dependencies{
+		unconditional: make(map[string]bool),
+	}
+
+	root := this.AST()
+	if root != nil {
+		ret.find(root, false)
+	}
+	return ret
+}
+
+func (this *dependencies) find(node Node, conditional bool) {
+
+	switch typed := node.(type) {
+
+	case *VariableNode:
+		this.addVariable(typed.Name(), conditional)
+
+	case *AccessorNode:
+		this.addVariable(typed.Variable(), conditional)
+		this.accessors.add(joinAccessorPath(append([]string{typed.Variable()}, typed.Path()...)))
+
+	case *CallNode:
+		this.functions.add(typed.Name())
+
+	case *BinaryNode:
+
+		switch typed.Operator() {
+		case AND, OR, COALESCE:
+			this.find(typed.Left(), conditional)
+			this.find(typed.Right(), true)
+			return
+		}
+
+	case *TernaryNode:
+
+		this.find(typed.Condition(), conditional)
+		this.find(typed.True(), true)
+		if typed.False() == nil {
+			return
+		}
+		this.find(typed.False(), true)
+
+		// a variable which both branches always read is read whichever branch is taken.
+		whenTrue := findUnconditionalVariables(typed.True())
+		for name := range findUnconditionalVariables(typed.False()) {
+			if whenTrue[name] {
+				this.addVariable(name, conditional)
+			}
+		}
+		return
+	}
+
+	for _, child := range node.Children() {
+		this.find(child, conditional)
+	}
+}
+
+/*
+	Returns the variables which are read every time the given [node] is evaluated.
+*/
+func findUnconditionalVariables(node Node) map[string]bool {
+
+	found := &dependencies{
+		unconditional: make(map[string]bool),
+	}
+
+	found.find(node, false)
+	return found.unconditional
+}
+
+func (this *dependencies) addVariable(name string, conditional bool) {
+
+	this.variables.add(name)
+
+	if conditional {
+		this.conditional.add(name)
+		return
+	}
+	this.unconditional[name] = true
+}
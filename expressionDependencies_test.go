@@ -0,0 +1,119 @@
+package govaluate
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+	Represents a test of the dependencies that are found in the given [Input].
+*/
+type DependencyTest struct {
+	Name        string
+	Input       string
+	Variables   []string
+	Functions   []string
+	Accessors   []string
+	Conditional []string
+}
+
+func TestDependencies(test *testing.T) {
+
+	functions := map[string]ExpressionFunction{
+		"band": func(arguments ...interface{}) (interface{}, error) {
+			return arguments[0], nil
+		},
+		"mask": func(arguments ...interface{}) (interface{}, error) {
+			return true, nil
+		},
+	}
+
+	dependencyTests := []DependencyTest{
+
+		DependencyTest{
+			Name:      "Duplicates",
+			Input:     "b + a * b - a",
+			Variables: []string{"b", "a"},
+		},
+		DependencyTest{
+			Name:      "Accessors",
+			Input:     "foo.Bar + foo.Nested.Baz + x + foo.Bar",
+			Variables: []string{"foo", "x"},
+			Accessors: []string{"foo.Bar", "foo.Nested.Baz"},
+		},
+		DependencyTest{
+			Name:      "Functions",
+			Input:     "band(red) + band(nir) * mask()",
+			Variables: []string{"red", "nir"},
+			Functions: []string{"band", "mask"},
+		},
+		DependencyTest{
+			Name:        "Ternary",
+			Input:       "ndvi > 0.5 ? red : nir",
+			Variables:   []string{"ndvi", "red", "nir"},
+			Conditional: []string{"red", "nir"},
+		},
+		DependencyTest{
+			Name:        "Short circuit",
+			Input:       "a && b || c ?? d",
+			Variables:   []string{"a", "b", "c", "d"},
+			Conditional: []string{"b", "c", "d"},
+		},
+		DependencyTest{
+			Name:        "Also unconditional",
+			Input:       "(a > 0 ? b : c) + b",
+			Variables:   []string{"a", "b", "c"},
+			Conditional: []string{"c"},
+		},
+		DependencyTest{
+			Name:        "Both branches",
+			Input:       "p ? red : red + nir",
+			Variables:   []string{"p", "red", "nir"},
+			Conditional: []string{"nir"},
+		},
+		DependencyTest{
+			Name:        "Both branches of a conditional ternary",
+			Input:       "a && (p ? red : red && nir)",
+			Variables:   []string{"a", "p", "red", "nir"},
+			Conditional: []string{"p", "red", "nir"},
+		},
+		DependencyTest{
+			Name:        "Nested",
+			Input:       "a ? (b ? c : d) : band(e)",
+			Variables:   []string{"a", "b", "c", "d", "e"},
+			Functions:   []string{"band"},
+			Conditional: []string{"b", "c", "d", "e"},
+		},
+		DependencyTest{
+			Name:      "Constants",
+			Input:     "1 + 2 in (1, 2, 3)",
+			Variables: nil,
+		},
+	}
+
+	for _, dependencyTest := range dependencyTests {
+
+		expression, err := NewEvaluableExpressionWithFunctions(dependencyTest.Input, functions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", dependencyTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		results := [][2][]string{
+			{expression.Variables(), dependencyTest.Variables},
+			{expression.Functions(), dependencyTest.Functions},
+			{expression.Accessors(), dependencyTest.Accessors},
+			{expression.ConditionalVariables(), dependencyTest.Conditional},
+		}
+
+		for _, result := range results {
+
+			if !reflect.DeepEqual(result[0], result[1]) {
+				test.Logf("Test '%s' failed", dependencyTest.Name)
+				test.Logf("Expected %v, got %v", result[1], result[0])
+				test.Fail()
+			}
+		}
+	}
+}
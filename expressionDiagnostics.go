@@ -0,0 +1,322 @@
+package govaluate
+
+import (
+	"fmt"
+	"sort"
+)
+
+type DiagnosticSeverity int
+
+const (
+
+	// the expression can't be parsed.
+	ErrorDiagnostic DiagnosticSeverity = iota
+
+	// the expression is valid, but probably doesn't do what was meant.
+	WarningDiagnostic
+)
+
+func (this DiagnosticSeverity) String() string {
+
+	if this == WarningDiagnostic {
+		return "warning"
+	}
+	return "error"
+}
+
+/*
+	A single problem found in an expression by `Validate` or `Lint`.
+*/
+type Diagnostic struct {
+	Severity DiagnosticSeverity
+	Message  string
+
+	/*
+		The characters of the expression which the problem is about. Not valid if that isn't known.
+		[Line] and [Column] give where it starts, both counting from one, or are zero if it isn't known.
+	*/
+	Span   Span
+	Line   int
+	Column int
+
+	/*
+		For errors, the error that parsing the expression returned, such as a `*ParseError`. Nil for warnings.
+	*/
+	Err error
+}
+
+func (this Diagnostic) String() string {
+
+	if this.Line == 0 {
+		return fmt.Sprintf("%v: %s", this.Severity, this.Message)
+	}
+	return fmt.Sprintf("%d:%d: %v: %s", this.Line, this.Column, this.Severity, this.Message)
+}
+
+/*
+	Checks the given [expression] without stopping at the first error, and returns every error found, in the order they appear.
+	Returns nothing if the expression can be parsed with the given function [definitions].
+
+	Text which can't be read as a token is reported, then skipped, and the tokens around it are checked on their own.
+	Errors which only show up once the expression has been read in full, such as a misplaced ternary, are only found once there are no others.
+*/
+func Validate(expression string, definitions map[string]FunctionDefinition) []Diagnostic {
+
+	_, ret := validateExpression(expression, definitions)
+	return ret
+}
+
+/*
+	Same as `Validate`, but if the expression is valid, returns the warnings from `EvaluableExpression.Lint` instead.
+*/
+func Lint(expression string, definitions map[string]FunctionDefinition, schema Schema) []Diagnostic {
+
+	parsed, ret := validateExpression(expression, definitions)
+	if parsed == nil {
+		return ret
+	}
+	return parsed.Lint(schema)
+}
+
+/*
+	Returns every error in the given [expression], or the parsed expression if there aren't any.
+*/
+func validateExpression(expression string, definitions map[string]FunctionDefinition) (*EvaluableExpression, []Diagnostic) {
+
+	var errs []error
+	var tokens []ExpressionToken
+
+	// the indices of tokens which follow text that couldn't be read.
+	restarts := make(map[int]bool)
+
+	stream := newLexerStream(expression)
+	state := validLexerStates[0]
+
+	for stream.canRead() {
+
+		start := stream.position
+
+		token, err, found := readToken(stream, state, definitions)
+		if err != nil {
+
+			errs = append(errs, err)
+			restarts[len(tokens)] = true
+
+			// carry on from just past the text that couldn't be read.
+			parseError, ok := err.(*ParseError)
+			if ok && parseError.Span.End > stream.position {
+				stream.position = parseError.Span.End
+			}
+			if stream.position <= start {
+				stream.position = start + 1
+			}
+			continue
+		}
+
+		if !found {
+			break
+		}
+
+		state, err = getLexerStateForToken(token.Kind)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		tokens = append(tokens, token)
+	}
+
+	errs = append(errs, findBalanceErrors(tokens)...)
+	errs = append(errs, findSyntaxErrors(tokens, restarts)...)
+
+	for index := range tokens {
+
+		err := checkFunctionCall(tokens, index)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+
+		parsed, err := parseEvaluableExpression(expression, definitions, nil, Limits{})
+		if err == nil {
+			return parsed, nil
+		}
+		errs = append(errs, err)
+	}
+
+	var ret []Diagnostic
+	for _, err := range errs {
+		ret = append(ret, makeErrorDiagnostic(locateError(err, expression)))
+	}
+
+	sortDiagnostics(ret)
+	return nil, ret
+}
+
+func makeErrorDiagnostic(err error) Diagnostic {
+
+	parseError, ok := err.(*ParseError)
+	if !ok {
+		return Diagnostic{Severity: ErrorDiagnostic, Message: err.Error(), Err: err}
+	}
+
+	return Diagnostic{
+		Severity: ErrorDiagnostic,
+		Message:  parseError.Message,
+		Span:     parseError.Span,
+		Line:     parseError.Line,
+		Column:   parseError.Column,
+		Err:      err,
+	}
+}
+
+/*
+	Orders the given [diagnostics] by where they start, keeping the order of those which start at the same place.
+	Those without a position go last.
+*/
+func sortDiagnostics(diagnostics []Diagnostic) {
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+
+		if !diagnostics[j].Span.IsValid() {
+			return diagnostics[i].Span.IsValid()
+		}
+		return diagnostics[i].Span.IsValid() && diagnostics[i].Span.Start < diagnostics[j].Span.Start
+	})
+}
+
+/*
+	Returns warnings about parts of this expression which are valid, but probably don't do what was meant:
+
+	  - `==` or `!=` on arrays of numbers, which compare each element exactly, so are thrown off by rounding.
+	  - Any comparison with `nodata`, which marks missing values rather than being a value itself.
+	  - `<`, `>`, `<=` or `>=` with a literal null, which always gives null.
+	  - `/` or `%` by a literal zero.
+
+	The [schema] is used to tell which values are arrays. Anything it doesn't declare is assumed not to be one.
+	Warnings are about the expression as it was written, before any constants were folded.
+*/
+func (this EvaluableExpression) Lint(schema Schema) []Diagnostic {
+
+	if len(this.tokens) == 0 {
+		return nil
+	}
+
+	// planned again, since the planned stages of the expression have already been simplified.
+	root, err := planTokens(newTokenStream(this.tokens))
+	if err != nil || root == nil {
+		return nil
+	}
+	reorderStages(root)
+
+	linter := expressionLinter{
+		expression: []rune(this.inputExpression),
+		inference: typeInference{
+			schema: schema,
+			types:  make(map[*evaluationStage]inferredType),
+		},
+	}
+
+	linter.lint(root)
+	sortDiagnostics(linter.diagnostics)
+	return linter.diagnostics
+}
+
+type expressionLinter struct {
+	expression  []rune
+	inference   typeInference
+	diagnostics []Diagnostic
+}
+
+func (this *expressionLinter) lint(stage *evaluationStage) {
+
+	if stage == nil {
+		return
+	}
+
+	switch stage.symbol {
+
+	case EQ, NEQ:
+		if this.isNumberArray(stage.leftStage) || this.isNumberArray(stage.rightStage) {
+			this.warn(stage, "'%s' compares each number of an array exactly, so rounding can make them differ; compare the difference with a tolerance instead", describeOperator(stage))
+		}
+	case DIVIDE, MODULUS:
+		if isLiteralZero(stage.rightStage) {
+			this.warn(stage, "'%s' by a literal zero never gives a finite number", describeOperator(stage))
+		}
+	}
+
+	switch stage.symbol {
+	case EQ, NEQ, GT, LT, GTE, LTE:
+		if isNoDataStage(stage.leftStage) || isNoDataStage(stage.rightStage) {
+			this.warn(stage, "'%s' compares with nodata, which marks missing values rather than being one; use '??' to replace them, or 'is null' to find them, instead", describeOperator(stage))
+		}
+	}
+
+	switch stage.symbol {
+	case GT, LT, GTE, LTE:
+		if isNullLiteral(stage.leftStage) || isNullLiteral(stage.rightStage) {
+			this.warn(stage, "'%s' with null is always null; use 'is null' to test for it instead", describeOperator(stage))
+		}
+	}
+
+	this.lint(stage.leftStage)
+	this.lint(stage.rightStage)
+}
+
+func (this *expressionLinter) warn(stage *evaluationStage, format string, arguments ...interface{}) {
+
+	diagnostic := Diagnostic{
+		Severity: WarningDiagnostic,
+		Message:  fmt.Sprintf(format, arguments...),
+		Span:     stage.token.span,
+	}
+
+	if diagnostic.Span.IsValid() && len(this.expression) > 0 {
+		diagnostic.Line, diagnostic.Column = findLocation(this.expression, diagnostic.Span.Start)
+	}
+	this.diagnostics = append(this.diagnostics, diagnostic)
+}
+
+/*
+	Returns whether or not the given [stage] is known to compute an array of numbers.
+*/
+func (this *expressionLinter) isNumberArray(stage *evaluationStage) bool {
+
+	if stage == nil {
+		return false
+	}
+
+	inferred, err := this.inference.inferStage(stage)
+	return err == nil && isPlainType(inferred, NumberValue) && inferred.value.Shape == ArrayShape
+}
+
+/*
+	Returns the stage inside any parenthesis around the given [stage].
+*/
+func unwrapParenthesis(stage *evaluationStage) *evaluationStage {
+
+	for stage != nil && stage.symbol == NOOP && stage.rightStage != nil {
+		stage = stage.rightStage
+	}
+	return stage
+}
+
+func isNoDataStage(stage *evaluationStage) bool {
+
+	stage = unwrapParenthesis(stage)
+	return stage != nil && stage.symbol == VALUE && stage.parameterName == "nodata"
+}
+
+func isNullLiteral(stage *evaluationStage) bool {
+
+	stage = unwrapParenthesis(stage)
+	return isLiteralStage(stage) && literalStageValue(stage) == nil
+}
+
+func isLiteralZero(stage *evaluationStage) bool {
+
+	stage = unwrapParenthesis(stage)
+	return isLiteralStage(stage) && literalStageValue(stage) == float32(0)
+}
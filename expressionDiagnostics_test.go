@@ -0,0 +1,137 @@
+package govaluate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type DiagnosticTest struct {
+	Input string
+
+	// the start of each diagnostic, as a string, in order.
+	Expected []string
+}
+
+func TestValidation(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"pad": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return arguments[0], nil
+			},
+			Signature: &FunctionSignature{Arguments: []ValueType{StringType, NumberType}},
+		},
+	}
+
+	diagnosticTests := []DiagnosticTest{
+		{"pad('a', 2) + x", nil},
+		{"a + * 2 + $ + b", []string{
+			"1:5: error: Cannot transition token types from MODIFIER [+] to MODIFIER [*]",
+			"1:11: error: Invalid token: '$'",
+		}},
+		{"(pad(1, 2) + 0x + foo(1)", []string{
+			"1:1: error: Unbalanced parenthesis",
+			"1:6: error: Function 'pad': Argument 1 must be string, not float32",
+			"1:14: error: Unable to parse hex value '0x': malformed literal, with no digits after its prefix",
+			"1:19: error: Undefined function foo",
+		}},
+		{"1 + + 2 $ 3 ) (", []string{
+			"1:5: error: Cannot transition token types from MODIFIER [+] to MODIFIER [+]",
+			"1:9: error: Invalid token: '$'",
+			"1:13: error: Unbalanced parenthesis",
+			"1:15: error: Unbalanced parenthesis",
+			"1:15: error: Unexpected end of expression",
+		}},
+		{"1 ) + (2", []string{
+			"1:3: error: Unbalanced parenthesis",
+			"1:7: error: Unbalanced parenthesis",
+		}},
+		{"a + 'b", []string{
+			"1:5: error: Unclosed string literal",
+		}},
+		{"a +\nb +", []string{
+			"2:3: error: Unexpected end of expression",
+		}},
+	}
+
+	for _, diagnosticTest := range diagnosticTests {
+		checkDiagnostics(test, diagnosticTest, Validate(diagnosticTest.Input, definitions))
+	}
+
+	// errors keep what parsing returned.
+	diagnostics := Validate("a + * 2", nil)
+
+	var parseError *ParseError
+	if len(diagnostics) != 1 || !errors.As(diagnostics[0].Err, &parseError) || diagnostics[0].Span != (Span{4, 5}) {
+		test.Logf("Expected a single parse error at 4-5, got %v", diagnostics)
+		test.Fail()
+	}
+}
+
+func TestLinting(test *testing.T) {
+
+	schema := Schema{
+		Variables: map[string]ValueType{
+			"xs": NumberArrayType,
+			"x":  NumberType,
+		},
+	}
+
+	diagnosticTests := []DiagnosticTest{
+		{"x == 1 && xs > 1", nil},
+		{"xs == 1", []string{
+			"1:4: warning: '==' compares each number of an array exactly",
+		}},
+		{"x > 0 && (xs + 1) != xs", []string{
+			"1:19: warning: '!=' compares each number of an array exactly",
+		}},
+		{"x / 0 + 1 / (0) + x % 0", []string{
+			"1:3: warning: '/' by a literal zero",
+			"1:11: warning: '/' by a literal zero",
+			"1:21: warning: '%' by a literal zero",
+		}},
+		{"y < nodata || x != (nodata)", []string{
+			"1:3: warning: '<' compares with nodata",
+			"1:17: warning: '!=' compares with nodata",
+		}},
+		{"x is null || (null) <= x", []string{
+			"1:21: warning: '<=' with null is always null",
+		}},
+		{"x > 0 &&\n\t(xs + 1) / 0 == 1", []string{
+			"2:11: warning: '/' by a literal zero",
+			"2:15: warning: '==' compares each number of an array exactly",
+		}},
+		{"a + * 2", []string{
+			"1:5: error: Cannot transition token types",
+		}},
+	}
+
+	for _, diagnosticTest := range diagnosticTests {
+		checkDiagnostics(test, diagnosticTest, Lint(diagnosticTest.Input, nil, schema))
+	}
+
+	// warnings point at the operator they're about.
+	diagnostics := Lint("x + xs == 1", nil, schema)
+	if len(diagnostics) != 1 || diagnostics[0].Span != (Span{7, 9}) || diagnostics[0].Err != nil {
+		test.Logf("Expected a single warning spanning 7-9, got %v", diagnostics)
+		test.Fail()
+	}
+}
+
+func checkDiagnostics(test *testing.T, diagnosticTest DiagnosticTest, diagnostics []Diagnostic) {
+
+	if len(diagnostics) != len(diagnosticTest.Expected) {
+		test.Logf("Expected %d diagnostics for '%s', got %v", len(diagnosticTest.Expected), diagnosticTest.Input, diagnostics)
+		test.Fail()
+		return
+	}
+
+	for i, diagnostic := range diagnostics {
+
+		if !strings.HasPrefix(diagnostic.String(), diagnosticTest.Expected[i]) {
+			test.Logf("Expected '%s' for '%s', got '%v'", diagnosticTest.Expected[i], diagnosticTest.Input, diagnostic)
+			test.Fail()
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package govaluate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+	Every error of one of the types below is `errors.Is` the matching one of these, so that the kind of an error can be checked
+	without needing its details.
+*/
+var (
+	ErrParse            = errors.New("Expression could not be parsed")
+	ErrType             = errors.New("Value has the wrong type")
+	ErrMissingParameter = errors.New("Parameter was not found")
+	ErrArrayShape       = errors.New("Arrays have different sizes")
+	ErrFunction         = errors.New("Function returned an error")
+)
+
+/*
+	Returned when an expression can't be parsed, along with where in the expression the problem was found.
+*/
+type ParseError struct {
+
+	/*
+		What went wrong, without where.
+	*/
+	Message string
+
+	/*
+		The characters of the expression which caused the error.
+		Not valid if it isn't known, such as for expressions made from tokens rather than a string.
+	*/
+	Span Span
+
+	/*
+		The line and column that [Span] starts at, both counting from one. Zero if the position isn't known.
+		Columns count characters (runes), not bytes.
+	*/
+	Line   int
+	Column int
+
+	/*
+		The expression that was being parsed, if it was parsed from a string.
+	*/
+	Expression string
+}
+
+func newParseError(span Span, format string, arguments ...interface{}) *ParseError {
+
+	return &ParseError{
+		Message: fmt.Sprintf(format, arguments...),
+		Span:    span,
+	}
+}
+
+func (this *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+func (this *ParseError) Error() string {
+
+	if this.Line == 0 {
+		return this.Message
+	}
+	return fmt.Sprintf("%s (line %d, column %d)", this.Message, this.Line, this.Column)
+}
+
+/*
+	Returns the line of the expression that the error was found on, followed by a line with carets under the characters which caused it:
+
+		price * * 2
+		        ^
+
+	Returns an empty string if the position of the error isn't known.
+*/
+func (this *ParseError) Snippet() string {
+
+	if this.Line == 0 {
+		return ""
+	}
+
+	line := []rune(strings.Split(this.Expression, "\n")[this.Line-1])
+
+	// tabs are kept, so that the carets line up with the line above however wide a tab is.
+	var indent []rune
+	for _, character := range line[:this.Column-1] {
+		if character == '\t' {
+			indent = append(indent, '\t')
+			continue
+		}
+		indent = append(indent, ' ')
+	}
+
+	// spans which cross onto later lines are only underlined up to the end of the first.
+	width := this.Span.End - this.Span.Start
+	if width > len(line)-(this.Column-1) {
+		width = len(line) - (this.Column - 1)
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	return fmt.Sprintf("%s\n%s%s", string(line), string(indent), strings.Repeat("^", width))
+}
+
+/*
+	Fills in the position of the given [err] within [expression], if it's a parse error whose span is known.
+	Returns the same error.
+*/
+func locateError(err error, expression string) error {
+
+	parseError, ok := err.(*ParseError)
+	if !ok || !parseError.Span.IsValid() || expression == "" {
+		return err
+	}
+
+	parseError.Expression = expression
+	parseError.Line, parseError.Column = findLocation([]rune(expression), parseError.Span.Start)
+	return parseError
+}
+
+/*
+	Returns the given [err] as it would be for an expression which starts [offset] characters into [source],
+	with [prefix] before its message, if it's a parse error whose span is known.
+	Returns false for any other error, which is left as it is.
+*/
+func moveParseError(err error, source string, offset int, prefix string) (error, bool) {
+
+	parseError, ok := err.(*ParseError)
+	if !ok || !parseError.Span.IsValid() {
+		return err, false
+	}
+
+	span := Span{Start: parseError.Span.Start + offset, End: parseError.Span.End + offset}
+	return locateError(newParseError(span, "%s%s", prefix, parseError.Message), source), true
+}
+
+/*
+	Returns the line and column of the character at the given [offset] in [source], both counting from one.
+	An offset at the very end of the source is just past its last character.
+*/
+func findLocation(source []rune, offset int) (int, int) {
+
+	line := 1
+	column := 1
+
+	for i := 0; i < offset && i < len(source); i++ {
+
+		if source[i] == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
+
+/*
+	Returned when an operator is given a value it can't use, such as a string for `*`, or a number for `&&`.
+*/
+type TypeError struct {
+	Message string
+
+	/*
+		The operator as it's written in expressions, like `*` or `&&`.
+		For calls and accessors, the name of the function or the accessor, like `foo.Bar`.
+	*/
+	Operator string
+
+	/*
+		The types of the values that the operator was given. Nil for an operand it doesn't have, or which was nil.
+	*/
+	Left  reflect.Type
+	Right reflect.Type
+
+	/*
+		Where the operator was written in the expression. Not valid if that isn't known.
+	*/
+	Span Span
+}
+
+func newTypeError(format string, arguments ...interface{}) *TypeError {
+	return &TypeError{Message: fmt.Sprintf(format, arguments...)}
+}
+
+/*
+	Returns the error for an operator which was given [left] and [right] operands it can't use,
+	described by the given [operator] name (like "addition").
+*/
+func newOperandError(operator string, left interface{}, right interface{}) *TypeError {
+
+	return &TypeError{
+		Message: "invalid operand for " + operator,
+		Left:    reflect.TypeOf(left),
+		Right:   reflect.TypeOf(right),
+	}
+}
+
+func (this *TypeError) Is(target error) bool {
+	return target == ErrType
+}
+
+func (this *TypeError) Error() string {
+	return this.Message
+}
+
+/*
+	Returned when an expression reads a parameter which wasn't given. `MapParameters` returns it for any name it doesn't have.
+*/
+type MissingParameterError struct {
+	Name string
+
+	/*
+		Where the parameter was read in the expression. Not valid if that isn't known.
+	*/
+	Span Span
+}
+
+func (this *MissingParameterError) Is(target error) bool {
+	return target == ErrMissingParameter
+}
+
+func (this *MissingParameterError) Error() string {
+	return fmt.Sprintf("No parameter '%s' found.", this.Name)
+}
+
+/*
+	Returned when an operator, or a typed function, is given arrays of different lengths.
+*/
+type ArrayShapeError struct {
+	Left  int
+	Right int
+
+	/*
+		The operator as it's written in expressions, or the name of the function. Empty if it isn't known.
+	*/
+	Operator string
+
+	/*
+		Where the operator or call was written in the expression. Not valid if that isn't known.
+	*/
+	Span Span
+}
+
+func (this *ArrayShapeError) Is(target error) bool {
+	return target == ErrArrayShape
+}
+
+func (this *ArrayShapeError) Error() string {
+	return fmt.Sprintf("different array sizes: %v, %v", this.Left, this.Right)
+}
+
+/*
+	Returned when a function defined in Go returns an error, which it wraps, so that `errors.Is` and `errors.As` see the original too.
+	The message is the same as the original's.
+*/
+type FunctionError struct {
+	Function string
+	Err      error
+
+	/*
+		Where the call was written in the expression. Not valid if that isn't known.
+	*/
+	Span Span
+}
+
+/*
+	Wraps the [err] returned by the function called [name] while evaluating with the given [parameters].
+	A function which gives up because its context is done may return the context's error, which is returned as it is.
+*/
+func newFunctionError(name string, err error, parameters Parameters) error {
+
+	ctx := findContext(parameters)
+	if ctx != context.Background() && err == ctx.Err() {
+		return err
+	}
+	return &FunctionError{Function: name, Err: err}
+}
+
+func (this *FunctionError) Is(target error) bool {
+	return target == ErrFunction
+}
+
+func (this *FunctionError) Unwrap() error {
+	return this.Err
+}
+
+func (this *FunctionError) Error() string {
+	return this.Err.Error()
+}
+
+/*
+	Fills in where the given [err] happened, if it's one of the errors above and was returned by the given [stage].
+	Errors are copied rather than changed, since a `Parameters` may return the same error more than once.
+*/
+func locateStageError(err error, stage *evaluationStage, left interface{}, right interface{}) error {
+
+	switch typed := err.(type) {
+
+	case *TypeError:
+		if typed.Operator != "" {
+			return err
+		}
+
+		located := *typed
+		located.Operator = describeOperator(stage)
+		located.Left = reflect.TypeOf(left)
+		located.Right = reflect.TypeOf(right)
+		located.Span = stage.token.span
+		return &located
+
+	case *ArrayShapeError:
+		if typed.Operator != "" {
+			return err
+		}
+
+		located := *typed
+		located.Operator = describeOperator(stage)
+		located.Span = stage.token.span
+		return &located
+
+	case *MissingParameterError:
+		return locateMissingParameter(err, stage.token.span)
+
+	case *FunctionError:
+		if typed.Span.IsValid() {
+			return err
+		}
+
+		located := *typed
+		located.Span = stage.token.span
+		return &located
+	}
+	return err
+}
+
+/*
+	Fills in the [span] of a parameter which was read, if [err] says that it wasn't found.
+*/
+func locateMissingParameter(err error, span Span) error {
+
+	missing, ok := err.(*MissingParameterError)
+	if !ok || missing.Span.IsValid() {
+		return err
+	}
+
+	located := *missing
+	located.Span = span
+	return &located
+}
+
+/*
+	Returns the operator of the given [stage] as it's written in expressions.
+*/
+func describeOperator(stage *evaluationStage) string {
+
+	switch stage.symbol {
+	case FUNCTIONAL:
+		return stage.functionName
+	case ACCESS:
+		return joinAccessorPath(stage.accessorPath)
+	}
+
+	switch stage.token.Kind {
+	case MODIFIER, COMPARATOR, LOGICALOP, PREFIX, TERNARY:
+		operator, ok := stage.token.Value.(string)
+		if ok {
+			return operator
+		}
+	}
+	return stage.symbol.String()
+}
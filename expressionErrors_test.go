@@ -0,0 +1,251 @@
+package govaluate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ParseErrorTest struct {
+	Name    string
+	Input   string
+	Message string
+	Line    int
+	Column  int
+	Snippet string
+}
+
+func TestParseErrorPositions(test *testing.T) {
+
+	parseErrorTests := []ParseErrorTest{
+
+		ParseErrorTest{
+			Name:    "Invalid token",
+			Input:   "1 + @@ 2",
+			Message: "Invalid token: '@@'",
+			Line:    1,
+			Column:  5,
+			Snippet: "1 + @@ 2\n    ^^",
+		},
+		ParseErrorTest{
+			Name:    "Unclosed parenthesis",
+			Input:   "(a + (b)",
+			Message: "Unbalanced parenthesis",
+			Line:    1,
+			Column:  1,
+			Snippet: "(a + (b)\n^",
+		},
+		ParseErrorTest{
+			Name:    "Unopened parenthesis",
+			Input:   "a + b)",
+			Message: "Unbalanced parenthesis",
+			Line:    1,
+			Column:  6,
+			Snippet: "a + b)\n     ^",
+		},
+		ParseErrorTest{
+			Name:    "Unexpected end",
+			Input:   "a +\n  b *",
+			Message: "Unexpected end of expression",
+			Line:    2,
+			Column:  5,
+			Snippet: "  b *\n    ^",
+		},
+		ParseErrorTest{
+			Name:    "Unclosed string",
+			Input:   "x == 'abc",
+			Message: "Unclosed string literal",
+			Line:    1,
+			Column:  6,
+			Snippet: "x == 'abc\n     ^^^^",
+		},
+		ParseErrorTest{
+			Name:    "Undefined function",
+			Input:   "1 + foo(2)",
+			Message: "Undefined function foo",
+			Line:    1,
+			Column:  5,
+			Snippet: "1 + foo(2)\n    ^^^",
+		},
+		ParseErrorTest{
+			Name:    "Tabs",
+			Input:   "\tx + * 1",
+			Message: "Cannot transition token types",
+			Line:    1,
+			Column:  6,
+			Snippet: "\tx + * 1\n\t    ^",
+		},
+	}
+
+	for _, parseErrorTest := range parseErrorTests {
+
+		_, err := NewEvaluableExpression(parseErrorTest.Input)
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			test.Logf("Test '%s' failed: expected a parse error, got %v", parseErrorTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		if !strings.HasPrefix(parseError.Message, parseErrorTest.Message) ||
+			parseError.Line != parseErrorTest.Line ||
+			parseError.Column != parseErrorTest.Column ||
+			parseError.Snippet() != parseErrorTest.Snippet {
+
+			test.Logf("Test '%s' failed", parseErrorTest.Name)
+			test.Logf("Expected '%s' at %d:%d, got '%s' at %d:%d", parseErrorTest.Message, parseErrorTest.Line, parseErrorTest.Column,
+				parseError.Message, parseError.Line, parseError.Column)
+			test.Logf("Expected snippet:\n%s\nGot:\n%s", parseErrorTest.Snippet, parseError.Snippet())
+			test.Fail()
+		}
+	}
+}
+
+func TestParseErrorsInScripts(test *testing.T) {
+
+	failures := []struct {
+		Source  string
+		Message string
+		Line    int
+		Column  int
+	}{
+		{"a = 1\nb = a + * 2", "Cannot transition token types", 2, 9},
+		{"x = 1; y = (x", "Unbalanced parenthesis", 1, 12},
+		{"def f(x) = x + * 1; f(1)", "Function 'f': Cannot transition token types", 1, 16},
+		{"/* one;\ntwo */ a = 1 // three\nb = a + * 2", "Cannot transition token types", 3, 9},
+	}
+
+	for _, failure := range failures {
+
+		_, err := NewScript(failure.Source, nil)
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			test.Logf("Expected a parse error for '%s', got %v", failure.Source, err)
+			test.Fail()
+			continue
+		}
+
+		if !strings.HasPrefix(parseError.Message, failure.Message) || parseError.Line != failure.Line || parseError.Column != failure.Column {
+			test.Logf("Expected '%s' at %d:%d for '%s', got '%s' at %d:%d", failure.Message, failure.Line, failure.Column,
+				failure.Source, parseError.Message, parseError.Line, parseError.Column)
+			test.Fail()
+		}
+	}
+}
+
+func TestTokenSpans(test *testing.T) {
+
+	expression, err := NewEvaluableExpression("band + 12")
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	expected := []Span{Span{0, 4}, Span{5, 6}, Span{7, 9}}
+
+	for i, token := range expression.Tokens() {
+
+		if token.Span() != expected[i] {
+			test.Logf("Expected token %d to span %v, got %v", i, expected[i], token.Span())
+			test.Fail()
+		}
+	}
+
+	// errors from expressions made from tokens have no position.
+	_, err = NewEvaluableExpressionFromTokens(expression.Tokens()[:2])
+	if err == nil || err.Error() != "Unexpected end of expression" {
+		test.Logf("Expected an error without a position, got %v", err)
+		test.Fail()
+	}
+}
+
+func TestEvaluationErrors(test *testing.T) {
+
+	failed := errors.New("Sensor is offline")
+
+	definitions := map[string]FunctionDefinition{
+		"read": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return nil, failed
+			},
+		},
+	}
+
+	parameters := map[string]interface{}{
+		"name": "a",
+		"xs":   []float32{1, 2, 3},
+		"ys":   []float32{1, 2},
+	}
+
+	evaluate := func(input string) error {
+
+		expression, err := NewEvaluableExpressionWithDefinitions(input, definitions)
+		if err != nil {
+			test.Fatalf("Failed to parse '%s': %v", input, err)
+		}
+
+		_, err = expression.Evaluate(parameters)
+		return err
+	}
+
+	// type errors
+	err := evaluate("1 + name * 2")
+
+	var typeError *TypeError
+	if !errors.As(err, &typeError) || !errors.Is(err, ErrType) {
+		test.Fatalf("Expected a type error, got %v", err)
+	}
+
+	if typeError.Operator != "*" || typeError.Left != reflect.TypeOf("") || typeError.Right != reflect.TypeOf(float32(0)) || typeError.Span != (Span{9, 10}) {
+		test.Logf("Expected '*' on string and float32 at 9-10, got '%s' on %v and %v at %v", typeError.Operator, typeError.Left, typeError.Right, typeError.Span)
+		test.Fail()
+	}
+
+	// missing parameters
+	err = evaluate("xs + missing")
+
+	var missing *MissingParameterError
+	if !errors.As(err, &missing) || !errors.Is(err, ErrMissingParameter) {
+		test.Fatalf("Expected a missing parameter error, got %v", err)
+	}
+
+	if missing.Name != "missing" || missing.Span != (Span{5, 12}) || err.Error() != "No parameter 'missing' found." {
+		test.Logf("Expected 'missing' at 5-12, got '%s' at %v (%v)", missing.Name, missing.Span, err)
+		test.Fail()
+	}
+
+	// arrays of different sizes
+	err = evaluate("xs + ys")
+
+	var shapeError *ArrayShapeError
+	if !errors.As(err, &shapeError) || !errors.Is(err, ErrArrayShape) {
+		test.Fatalf("Expected an array shape error, got %v", err)
+	}
+
+	if shapeError.Operator != "+" || shapeError.Left != 3 || shapeError.Right != 2 || shapeError.Span != (Span{3, 4}) {
+		test.Logf("Expected '+' on 3 and 2 elements at 3-4, got '%s' on %d and %d at %v", shapeError.Operator, shapeError.Left, shapeError.Right, shapeError.Span)
+		test.Fail()
+	}
+
+	// errors from functions keep the original error.
+	err = evaluate("xs * read(1)")
+
+	var functionError *FunctionError
+	if !errors.As(err, &functionError) || !errors.Is(err, ErrFunction) || !errors.Is(err, failed) {
+		test.Fatalf("Expected a function error wrapping the original, got %v", err)
+	}
+
+	if functionError.Function != "read" || functionError.Span != (Span{5, 9}) || err.Error() != failed.Error() {
+		test.Logf("Expected 'read' at 5-9, got '%s' at %v (%v)", functionError.Function, functionError.Span, err)
+		test.Fail()
+	}
+
+	// parse errors
+	_, err = NewEvaluableExpression("1 +")
+	if !errors.Is(err, ErrParse) || errors.Is(err, ErrType) {
+		test.Logf("Expected only a parse error, got %v", err)
+		test.Fail()
+	}
+}
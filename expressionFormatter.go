@@ -0,0 +1,380 @@
+package govaluate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/*
+	How tightly each kind of node binds its operands, following the order in which the stage planner handles them.
+	Operators at the same level are applied left to right.
+*/
+const (
+	ternaryLevel = iota + 1
+	logicalOrLevel
+	logicalAndLevel
+	comparatorLevel
+	bitwiseLevel
+	bitwiseShiftLevel
+	additiveLevel
+	multiplicativeLevel
+	exponentialLevel
+	prefixLevel
+	primaryLevel
+)
+
+/*
+	Renders the given syntax tree as an expression, in a canonical form: operators are separated from their operands by single spaces,
+	lists and arguments by a comma and a space, and parenthesis are only used where they're needed.
+	Parsing the result gives an expression which evaluates exactly the same way.
+
+	Returns an error if the tree has a node which can't be written as an expression, such as a literal of an unsupported type.
+*/
+func Format(node Node) (string, error) {
+
+	var buffer bytes.Buffer
+
+	err := writeNode(&buffer, node)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+/*
+	Renders this expression in the canonical form described by `Format`.
+*/
+func (this EvaluableExpression) Format() (string, error) {
+
+	root := this.AST()
+	if root == nil {
+		return "", nil
+	}
+	return Format(root)
+}
+
+func writeNode(buffer *bytes.Buffer, node Node) error {
+
+	switch typed := node.(type) {
+
+	case nil:
+		return errors.New("Syntax tree is missing a node")
+
+	case *VariableNode:
+		writeVariableName(buffer, typed.name)
+		return nil
+
+	case *LiteralNode:
+		return writeLiteral(buffer, typed.value)
+
+	case *UnaryNode:
+		operator, found := prefixSymbolStrings[typed.operator]
+		if !found {
+			return fmt.Errorf("Operator '%v' can't be used as a prefix", typed.operator)
+		}
+
+		buffer.WriteString(operator)
+		return writeOperand(buffer, typed.operand, !isPrefixOperand(typed.operand))
+
+	case *BinaryNode:
+		operator, found := binarySymbolTokens[typed.operator]
+		if !found {
+			return fmt.Errorf("Operator '%v' can't be used between two operands", typed.operator)
+		}
+
+		level := findNodeLevel(node)
+
+		err := writeOperand(buffer, typed.left, findNodeLevel(typed.left) < level)
+		if err != nil {
+			return err
+		}
+
+		buffer.WriteString(" " + operator.Value.(string) + " ")
+		return writeOperand(buffer, typed.right, findNodeLevel(typed.right) <= level)
+
+	case *TernaryNode:
+		err := writeOperand(buffer, typed.condition, findNodeLevel(typed.condition) < ternaryLevel)
+		if err != nil {
+			return err
+		}
+
+		buffer.WriteString(" ? ")
+		err = writeOperand(buffer, typed.whenTrue, findNodeLevel(typed.whenTrue) <= ternaryLevel)
+		if err != nil || typed.whenFalse == nil {
+			return err
+		}
+
+		buffer.WriteString(" : ")
+		return writeOperand(buffer, typed.whenFalse, findNodeLevel(typed.whenFalse) <= ternaryLevel)
+
+	case *CallNode:
+		if !isPlainName(typed.name) {
+			return fmt.Errorf("Function name '%s' can't be written in an expression", typed.name)
+		}
+
+		buffer.WriteString(typed.name)
+		return writeList(buffer, typed.arguments)
+
+	case *AccessorNode:
+		path := append([]string{typed.variable}, typed.path...)
+
+		for _, name := range path {
+			if !isPlainName(name) {
+				return fmt.Errorf("Accessor '%s' can't be written in an expression", strings.Join(path, "."))
+			}
+		}
+
+		buffer.WriteString(strings.Join(path, "."))
+		if len(typed.arguments) == 0 {
+			return nil
+		}
+		return writeList(buffer, typed.arguments)
+
+	case *ListNode:
+		return writeList(buffer, typed.elements)
+	}
+
+	return fmt.Errorf("Unknown syntax tree node %T", node)
+}
+
+func writeOperand(buffer *bytes.Buffer, node Node, parenthesized bool) error {
+
+	if !parenthesized {
+		return writeNode(buffer, node)
+	}
+
+	buffer.WriteString("(")
+
+	err := writeNode(buffer, node)
+	if err != nil {
+		return err
+	}
+
+	buffer.WriteString(")")
+	return nil
+}
+
+func writeList(buffer *bytes.Buffer, nodes []Node) error {
+
+	buffer.WriteString("(")
+
+	for i, node := range nodes {
+
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+
+		err := writeNode(buffer, node)
+		if err != nil {
+			return err
+		}
+	}
+
+	buffer.WriteString(")")
+	return nil
+}
+
+/*
+	Variables are written as-is if they'd be read back as the same variable, otherwise they're escaped in brackets.
+*/
+func writeVariableName(buffer *bytes.Buffer, name string) {
+
+	if isPlainName(name) {
+		buffer.WriteString(name)
+		return
+	}
+
+	buffer.WriteString("[")
+	for _, character := range name {
+
+		if character == '\\' || character == ']' {
+			buffer.WriteRune('\\')
+		}
+		buffer.WriteRune(character)
+	}
+	buffer.WriteString("]")
+}
+
+func writeLiteral(buffer *bytes.Buffer, value interface{}) error {
+
+	switch typed := value.(type) {
+
+	case float32:
+		// numbers are read without signs, so negative numbers are negated.
+		switch {
+		case math.IsNaN(float64(typed)):
+			buffer.WriteString("NaN")
+		case math.IsInf(float64(typed), 1):
+			buffer.WriteString("Inf")
+		case math.IsInf(float64(typed), -1):
+			buffer.WriteString("-Inf")
+		default:
+			buffer.WriteString(formatNumber(typed))
+		}
+
+	case bool:
+		buffer.WriteString(strconv.FormatBool(typed))
+
+	case nil:
+		buffer.WriteString("null")
+
+	case string:
+		writeString(buffer, typed)
+
+	case *regexp.Regexp:
+		writeString(buffer, typed.String())
+
+	case time.Time:
+		writeString(buffer, typed.Format(time.RFC3339Nano))
+
+	default:
+		return fmt.Errorf("Literal '%v' has unsupported type %T", value, value)
+	}
+
+	return nil
+}
+
+/*
+	Both kinds of quote end a string, so both are escaped, as are characters which can't be seen.
+*/
+/*
+	Returns the shortest decimal form which reads back as the given [value].
+	Numbers which are very large or very small are given an exponent, so that `3.4e38` isn't written out as 39 digits.
+*/
+func formatNumber(value float32) string {
+
+	magnitude := float32(math.Abs(float64(value)))
+	if magnitude == 0 || (magnitude >= 1e-6 && magnitude < 1e21) {
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	}
+
+	// the exponent is written without a "+" or leading zeroes, like "1e-7" rather than "1e-07".
+	text := strconv.FormatFloat(float64(value), 'e', -1, 32)
+	separator := strings.IndexByte(text, 'e')
+
+	exponent, _ := strconv.Atoi(text[separator+1:])
+	return text[:separator+1] + strconv.Itoa(exponent)
+}
+
+func writeString(buffer *bytes.Buffer, value string) {
+
+	buffer.WriteString("'")
+	for _, character := range value {
+
+		switch {
+		case character == '\\' || character == '\'' || character == '"':
+			buffer.WriteRune('\\')
+			buffer.WriteRune(character)
+		case character == '\n':
+			buffer.WriteString("\\n")
+		case character == '\t':
+			buffer.WriteString("\\t")
+		case character == '\r':
+			buffer.WriteString("\\r")
+		case !unicode.IsPrint(character) && character != ' ':
+			if character > 0xffff {
+				fmt.Fprintf(buffer, "\\U%08x", character)
+			} else {
+				fmt.Fprintf(buffer, "\\u%04x", character)
+			}
+		default:
+			buffer.WriteRune(character)
+		}
+	}
+	buffer.WriteString("'")
+}
+
+func findNodeLevel(node Node) int {
+
+	switch typed := node.(type) {
+
+	case *TernaryNode:
+		return ternaryLevel
+
+	case *UnaryNode:
+		return prefixLevel
+
+	case *LiteralNode:
+		number, isNumber := typed.value.(float32)
+		if isNumber && math.Signbit(float64(number)) {
+			return prefixLevel
+		}
+
+	case *BinaryNode:
+		switch typed.operator {
+		case TERNARY_TRUE, TERNARY_FALSE, COALESCE:
+			return ternaryLevel
+		case OR:
+			return logicalOrLevel
+		case AND:
+			return logicalAndLevel
+		case EQ, NEQ, GT, LT, GTE, LTE, REQ, NREQ, IN, IS, IS_NOT:
+			return comparatorLevel
+		case BITWISE_AND, BITWISE_OR, BITWISE_XOR:
+			return bitwiseLevel
+		case BITWISE_LSHIFT, BITWISE_RSHIFT:
+			return bitwiseShiftLevel
+		case PLUS, MINUS:
+			return additiveLevel
+		case MULTIPLY, DIVIDE, MODULUS:
+			return multiplicativeLevel
+		case EXPONENT:
+			return exponentialLevel
+		}
+	}
+
+	return primaryLevel
+}
+
+/*
+	Returns true if the given [node] can directly follow a prefix operator.
+	Only a few kinds of token may follow one, and a prefix applies to a single value, so anything else is parenthesized.
+*/
+func isPrefixOperand(node Node) bool {
+
+	switch typed := node.(type) {
+
+	case *VariableNode, *CallNode, *AccessorNode, *ListNode:
+		return true
+
+	case *LiteralNode:
+		switch typed.value.(type) {
+		case bool, nil:
+			return true
+		case float32:
+			return findNodeLevel(node) == primaryLevel
+		}
+	}
+
+	return false
+}
+
+/*
+	Returns true if the given [name] is read back as a single name, rather than a keyword or something else entirely.
+*/
+func isPlainName(name string) bool {
+
+	switch name {
+	case "", "true", "false", "in", "IN", "is", "IS", "null", "NULL", "NaN", "Inf":
+		return false
+	}
+
+	for i, character := range name {
+
+		if i == 0 && !unicode.IsLetter(character) {
+			return false
+		}
+
+		if !unicode.IsLetter(character) && !unicode.IsDigit(character) && character != '_' {
+			return false
+		}
+	}
+	return true
+}
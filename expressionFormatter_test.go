@@ -0,0 +1,228 @@
+package govaluate
+
+import (
+	"math"
+	"testing"
+)
+
+/*
+	Represents a test of the canonical formatter, which expects the [Input] to be formatted as [Expected].
+*/
+type FormatTest struct {
+	Name     string
+	Input    string
+	Expected string
+}
+
+func TestFormat(test *testing.T) {
+
+	functions := map[string]ExpressionFunction{
+		"max": func(arguments ...interface{}) (interface{}, error) {
+			return arguments[0], nil
+		},
+	}
+
+	formatTests := []FormatTest{
+
+		FormatTest{
+			Name:     "Spacing",
+			Input:    "a+b*  2",
+			Expected: "a + b * 2",
+		},
+		FormatTest{
+			Name:     "Redundant parenthesis",
+			Input:    "((a * b)) + (c)",
+			Expected: "a * b + c",
+		},
+		FormatTest{
+			Name:     "Needed parenthesis",
+			Input:    "(a + b) * c",
+			Expected: "(a + b) * c",
+		},
+		FormatTest{
+			Name:     "Left associative",
+			Input:    "(a - b) - c",
+			Expected: "a - b - c",
+		},
+		FormatTest{
+			Name:     "Right grouping",
+			Input:    "a - (b - c)",
+			Expected: "a - (b - c)",
+		},
+		FormatTest{
+			Name:     "Exponent",
+			Input:    "(a ** b) ** c + a ** (b ** c)",
+			Expected: "a ** b ** c + a ** (b ** c)",
+		},
+		FormatTest{
+			Name:     "Logical",
+			Input:    "a && (b || c) || !d",
+			Expected: "a && (b || c) || !d",
+		},
+		FormatTest{
+			Name:     "Prefixes",
+			Input:    "-(a) + -(-b) * ~(c + 1)",
+			Expected: "-a + -(-b) * ~(c + 1)",
+		},
+		FormatTest{
+			Name:     "Bitwise",
+			Input:    "(a | b) << 2 & 0xff",
+			Expected: "(a | b) << 2 & 255",
+		},
+		FormatTest{
+			Name:     "Ternary",
+			Input:    "(a > b) ? (a) : (b - 1)",
+			Expected: "a > b ? a : b - 1",
+		},
+		FormatTest{
+			Name:     "Nested ternary",
+			Input:    "a ? b : (c ? d : e)",
+			Expected: "a ? b : (c ? d : e)",
+		},
+		FormatTest{
+			Name:     "Coalesce",
+			Input:    "(a ?? b) ?? c",
+			Expected: "a ?? b ?? c",
+		},
+		FormatTest{
+			Name:     "Null",
+			Input:    "(a IS NOT NULL) && (b is null) || -(null) == NULL",
+			Expected: "a is not null && b is null || -null == null",
+		},
+		FormatTest{
+			Name:     "Null names",
+			Input:    "[null] + [is]",
+			Expected: "[null] + [is]",
+		},
+		FormatTest{
+			Name:     "Function",
+			Input:    "max( a,(b),'c' )",
+			Expected: "max(a, b, 'c')",
+		},
+		FormatTest{
+			Name:     "Empty function",
+			Input:    "max()+1",
+			Expected: "max() + 1",
+		},
+		FormatTest{
+			Name:     "Accessor",
+			Input:    "foo.Nested.Dunk('a')",
+			Expected: "foo.Nested.Dunk('a')",
+		},
+		FormatTest{
+			Name:     "Membership",
+			Input:    "a in (1,2,  3)",
+			Expected: "a in (1, 2, 3)",
+		},
+		FormatTest{
+			Name:     "Regex",
+			Input:    "a =~ \"^b\\\\.c\"",
+			Expected: "a =~ '^b\\\\.c'",
+		},
+		FormatTest{
+			Name:     "Escaped variable",
+			Input:    "[a b] + [c.d] + [in]",
+			Expected: "[a b] + [c.d] + [in]",
+		},
+		FormatTest{
+			Name:     "Quotes",
+			Input:    "'it\\'s' + \"\\\"\"",
+			Expected: "'it\\'s' + '\\\"'",
+		},
+		FormatTest{
+			Name:     "Numbers",
+			Input:    "0.50 + 1.0 + 16777216",
+			Expected: "0.5 + 1 + 16777216",
+		},
+		FormatTest{
+			Name:     "Large and small numbers",
+			Input:    "340000000000000000000000000000000000000 * 0.0000001 + 3.4028235E+38 - 1e-45 + 0.000001",
+			Expected: "3.4e38 * 1e-7 + 3.4028235e38 - 1e-45 + 0.000001",
+		},
+		FormatTest{
+			Name:     "Date",
+			Input:    "a > '2014-01-02T10:00:00Z'",
+			Expected: "a > '2014-01-02T10:00:00Z'",
+		},
+	}
+
+	for _, formatTest := range formatTests {
+
+		expression, err := NewEvaluableExpressionWithFunctions(formatTest.Input, functions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", formatTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		formatted, err := expression.Format()
+		if err != nil || formatted != formatTest.Expected {
+			test.Logf("Test '%s' failed", formatTest.Name)
+			test.Logf("Expected '%s', got '%s' (%v)", formatTest.Expected, formatted, err)
+			test.Fail()
+			continue
+		}
+
+		// the formatted expression should parse back into exactly the same tree.
+		reparsed, err := NewEvaluableExpressionWithFunctions(formatted, functions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse its formatted expression: %v", formatTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		if describeNode(reparsed.AST()) != describeNode(expression.AST()) {
+			test.Logf("Test '%s' failed to round-trip", formatTest.Name)
+			test.Logf("Expected tree %s, got %s", describeNode(expression.AST()), describeNode(reparsed.AST()))
+			test.Fail()
+		}
+	}
+}
+
+func TestFormatBuiltTrees(test *testing.T) {
+
+	root := NewBinaryNode(PLUS,
+		NewUnaryNode(NEGATE, NewLiteralNode(float32(-2))),
+		NewBinaryNode(MULTIPLY,
+			NewLiteralNode(float32(math.Inf(1))),
+			NewUnaryNode(INVERT, NewLiteralNode("x")),
+		),
+	)
+
+	formatted, err := Format(root)
+	if err != nil || formatted != "-(-2) + Inf * !('x')" {
+		test.Logf("Unexpected formatting '%s' (%v)", formatted, err)
+		test.Fail()
+	}
+
+	// built trees have no input string, so they're formatted instead.
+	expression, err := NewEvaluableExpressionFromAST(NewBinaryNode(MINUS,
+		NewLiteralNode(float32(1)),
+		NewLiteralNode(float32(-2)),
+	))
+	if err != nil {
+		test.Fatalf("Failed to build: %v", err)
+	}
+
+	if expression.String() != "1 - -2" {
+		test.Logf("Unexpected string '%s'", expression.String())
+		test.Fail()
+	}
+
+	reparsed, err := NewEvaluableExpression(expression.String())
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	result, err := reparsed.Evaluate(nil)
+	if err != nil || result != float32(3) {
+		test.Logf("Expected 3, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	_, err = Format(NewLiteralNode(1))
+	if err == nil {
+		test.Logf("Expected an error formatting an int literal")
+		test.Fail()
+	}
+}
@@ -1,8 +1,130 @@
 package govaluate
 
+import (
+	"context"
+)
+
 /*
 	Represents a function that can be called from within an expression.
 	This method must return an error if, for any reason, it is unable to produce exactly one unambiguous result.
 	An error returned will halt execution of the expression.
 */
 type ExpressionFunction func(arguments ...interface{}) (interface{}, error)
+
+/*
+	Represents a function which also receives the context that the expression is being evaluated with (see `EvalContext`).
+	Long-running functions should give up, and return the context's error, once it's done.
+*/
+type ContextExpressionFunction func(ctx context.Context, arguments ...interface{}) (interface{}, error)
+
+/*
+	Represents a function which also receives what it needs of the evaluation which called it,
+	such as the value of "nodata", or a parameter which isn't one of its arguments.
+*/
+type EvaluationExpressionFunction func(evaluation *EvaluationContext, arguments ...interface{}) (interface{}, error)
+
+/*
+	What a function defined with an `EvaluationExpressionFunction` can see of the evaluation which called it.
+*/
+type EvaluationContext struct {
+
+	/*
+		The context that the expression is being evaluated with (see `EvalContext`).
+	*/
+	Context context.Context
+
+	/*
+		The parameters that the expression is being evaluated with. Numbers are given as float32, the same as they are to the expression.
+		Inside a script, these include the script's locals, and inside a declared function, its own parameters.
+	*/
+	Parameters Parameters
+}
+
+/*
+	Returns the value of the "nodata" parameter, which ternaries and `??` compare against.
+	If it isn't given, this is the smallest non-zero float32, the same as the operators use.
+*/
+func (this *EvaluationContext) NoData() (float32, error) {
+	return getNoData(this.Parameters)
+}
+
+/*
+	Describes a function that can be called from within an expression, along with what the library may assume about it.
+*/
+type FunctionDefinition struct {
+	Function ExpressionFunction
+
+	/*
+		If set, this is called instead of [Function].
+	*/
+	ContextFunction ContextExpressionFunction
+
+	/*
+		If set, this is called instead of [Function] or [ContextFunction].
+		Calls to it are never made when the expression is parsed, and are only shared between identical calls in one evaluation,
+		even if it's pure, since it may read parameters which aren't among its arguments.
+	*/
+	EvaluationFunction EvaluationExpressionFunction
+
+	/*
+		Whether or not this function always returns the same result when given the same arguments, and has no side effects.
+		Identical calls to a pure function within a single expression are only made once per evaluation,
+		as are calls from the same place which are given the same numbers, bools or strings.
+		Calls whose arguments are all literals, like `pow10(3)`, are made once when the expression is parsed,
+		unless they return an error or something other than a number, bool or string.
+	*/
+	Pure bool
+
+	/*
+		The arguments that this function takes, and what it returns. Optional.
+		If given, calls with the wrong number of arguments, or with a literal argument of the wrong type, fail to parse,
+		and `InferType` uses it for this function if the schema doesn't declare one.
+	*/
+	Signature *FunctionSignature
+
+	/*
+		Describes what the function does, for anything which lists the functions that are available. Not used by the library itself.
+	*/
+	Doc string
+
+	// set for functions declared with `def`, which are called instead of any other function.
+	declared *declaredFunction
+
+	// the arguments that the function accepts, for functions whose arguments are known.
+	signature *functionSignature
+}
+
+/*
+	Returns the signature that calls to the given [definition] are checked against, or nil if they aren't checked.
+*/
+func findDefinedSignature(definition FunctionDefinition) *functionSignature {
+
+	if definition.signature != nil {
+		return definition.signature
+	}
+	if definition.Signature != nil {
+		return newDeclaredSignature(definition.Signature)
+	}
+	return nil
+}
+
+/*
+	Returns the function that calls to the given [definition] should use, or nil if it has none.
+	Functions declared in the expression language come first, then evaluation functions, then context functions.
+*/
+func findDefinedFunction(definition FunctionDefinition) interface{} {
+
+	if definition.declared != nil {
+		return definition.declared
+	}
+	if definition.EvaluationFunction != nil {
+		return definition.EvaluationFunction
+	}
+	if definition.ContextFunction != nil {
+		return definition.ContextFunction
+	}
+	if definition.Function != nil {
+		return definition.Function
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package govaluate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFunctionSignatures(test *testing.T) {
+
+	identity := func(arguments ...interface{}) (interface{}, error) {
+		return arguments[0], nil
+	}
+
+	definitions := map[string]FunctionDefinition{
+		"pad": FunctionDefinition{
+			Function: identity,
+			Signature: &FunctionSignature{
+				Arguments: []ValueType{StringType, NumberType, StringType},
+				Optional:  1,
+				Result:    StringType,
+			},
+			Doc: "Pads text to the given width.",
+		},
+		"first": FunctionDefinition{
+			Function: identity,
+			Signature: &FunctionSignature{
+				Arguments: []ValueType{NumberType, NumberType},
+				Variadic:  true,
+				Result:    NumberType,
+			},
+		},
+		"scale": FunctionDefinition{
+			Function: identity,
+			Signature: &FunctionSignature{
+				Arguments: []ValueType{ValueType{Kind: NumberValue, Shape: EitherShape}},
+				Result:    ValueType{Kind: NumberValue, Shape: EitherShape},
+			},
+		},
+	}
+
+	valid := []string{
+		"pad('a', 2)",
+		"pad('a', 2, ' ')",
+		"first(1)",
+		"first(1, 2, 3)",
+		"scale(x)",
+		"scale(1)",
+	}
+
+	for _, input := range valid {
+
+		_, err := NewEvaluableExpressionWithDefinitions(input, definitions)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", input, err)
+			test.Fail()
+		}
+	}
+
+	failures := map[string]string{
+		"pad('a')":          "Function 'pad' takes between 2 and 3 arguments, but was given 1",
+		"pad('a', 1, 2, 3)": "Function 'pad' takes between 2 and 3 arguments, but was given 4",
+		"pad(1, 2)":         "Argument 1 must be string, not float32",
+		"first()":           "Function 'first' takes at least 1 arguments, but was given 0",
+		"first(1, true)":    "Argument 2 must be number, not bool",
+		"scale(1, 2)":       "Function 'scale' takes 1 arguments, but was given 2",
+	}
+
+	for input, expected := range failures {
+
+		_, err := NewEvaluableExpressionWithDefinitions(input, definitions)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			test.Logf("Expected an error containing '%s' parsing '%s', got %v", expected, input, err)
+			test.Fail()
+		}
+	}
+
+	// the signature is used to infer types when the schema doesn't declare the function.
+	expression, err := NewEvaluableExpressionWithDefinitions("scale(x) > 1", definitions)
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	inferred, err := expression.InferType(Schema{Variables: map[string]ValueType{"x": NumberArrayType}})
+	if err != nil || inferred != (ValueType{Kind: BoolValue, Shape: EitherShape}) {
+		test.Logf("Expected to infer 'bool or bool array', got '%v' (%v)", inferred, err)
+		test.Fail()
+	}
+
+	// and kept in syntax trees.
+	call := expression.AST().Children()[0].(*CallNode)
+	if call.Function().Signature != definitions["scale"].Signature {
+		test.Logf("Expected the call to keep its signature, got %+v", call.Function().Signature)
+		test.Fail()
+	}
+
+	signature := definitions["pad"].Signature
+	if signature.MinArguments() != 2 || signature.MaxArguments() != 3 {
+		test.Logf("Expected 'pad' to take 2 to 3 arguments, got %d to %d", signature.MinArguments(), signature.MaxArguments())
+		test.Fail()
+	}
+}
+
+func TestPureCallFolding(test *testing.T) {
+
+	calls := 0
+
+	definitions := map[string]FunctionDefinition{
+		"pow10": FunctionDefinition{
+			Pure: true,
+			Function: func(arguments ...interface{}) (interface{}, error) {
+
+				calls++
+				result := float32(1)
+				for i := float32(0); i < arguments[0].(float32); i++ {
+					result *= 10
+				}
+				return result, nil
+			},
+		},
+		"fail": FunctionDefinition{
+			Pure: true,
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return nil, errors.New("Always fails")
+			},
+		},
+	}
+
+	expression, err := NewEvaluableExpressionWithDefinitions("x * pow10(3)", definitions)
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	if calls != 1 {
+		test.Logf("Expected one call while parsing, got %d", calls)
+		test.Fail()
+	}
+
+	for i := 0; i < 3; i++ {
+
+		result, err := expression.Evaluate(map[string]interface{}{"x": 2})
+		if err != nil || result != float32(2000) {
+			test.Logf("Expected 2000, got %v (%v)", result, err)
+			test.Fail()
+		}
+	}
+
+	if calls != 1 {
+		test.Logf("Expected no calls while evaluating, got %d", calls-1)
+		test.Fail()
+	}
+
+	// calls which fail are left until evaluation, so that they fail there.
+	expression, err = NewEvaluableExpressionWithDefinitions("fail(1) + 1", definitions)
+	if err != nil {
+		test.Fatalf("Expected a failing call to parse, got %v", err)
+	}
+
+	_, err = expression.Evaluate(nil)
+	if err == nil || !strings.Contains(err.Error(), "Always fails") {
+		test.Logf("Expected the call to fail when evaluated, got %v", err)
+		test.Fail()
+	}
+}
+
+func TestPureCallMemoization(test *testing.T) {
+
+	calls := 0
+
+	definitions := map[string]FunctionDefinition{
+		"visit": FunctionDefinition{
+			Pure: true,
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				calls++
+				return arguments[0], nil
+			},
+		},
+	}
+
+	script, err := NewScript("def fib(n) = visit(n) < 2 ? n : fib(n - 1) + fib(n - 2); fib(20)", definitions)
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	result, err := script.Evaluate(nil)
+	if err != nil || result != float32(6765) {
+		test.Logf("Expected 6765, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	// each number from 20 down to 0 is only visited once.
+	if calls != 21 {
+		test.Logf("Expected 21 calls, got %d", calls)
+		test.Fail()
+	}
+
+	// nothing is remembered between evaluations.
+	calls = 0
+
+	_, err = script.Evaluate(nil)
+	if err != nil || calls != 21 {
+		test.Logf("Expected 21 calls on the second evaluation, got %d (%v)", calls, err)
+		test.Fail()
+	}
+}
+
+type tenantKey struct{}
+
+func TestEvaluationFunctions(test *testing.T) {
+
+	calls := 0
+
+	definitions := map[string]FunctionDefinition{
+		"fill": FunctionDefinition{
+			EvaluationFunction: func(evaluation *EvaluationContext, arguments ...interface{}) (interface{}, error) {
+
+				noData, err := evaluation.NoData()
+				if err != nil {
+					return nil, err
+				}
+
+				values := arguments[0].([]float32)
+				filled := make([]float32, len(values))
+				for i, value := range values {
+					filled[i] = value
+					if value == noData {
+						filled[i] = arguments[1].(float32)
+					}
+				}
+				return filled, nil
+			},
+		},
+		"band": FunctionDefinition{
+			Pure: true,
+			EvaluationFunction: func(evaluation *EvaluationContext, arguments ...interface{}) (interface{}, error) {
+				calls++
+				return evaluation.Parameters.Get(arguments[0].(string))
+			},
+		},
+		"tenant": FunctionDefinition{
+			EvaluationFunction: func(evaluation *EvaluationContext, arguments ...interface{}) (interface{}, error) {
+				return evaluation.Context.Value(tenantKey{}), nil
+			},
+		},
+	}
+
+	parameters := map[string]interface{}{
+		"red":    []float32{1, -1, 3},
+		"nodata": -1,
+		"x":      2,
+	}
+
+	evaluationTests := []struct {
+		Input    string
+		Expected interface{}
+	}{
+		{"fill(red, 0)", []float32{1, 0, 3}},
+		{"band('x') + band('x')", float32(4)},
+		{"tenant() + '/' + band('x')", "acme/2"},
+	}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+
+	for _, evaluationTest := range evaluationTests {
+
+		expression, err := NewEvaluableExpressionWithDefinitions(evaluationTest.Input, definitions)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", evaluationTest.Input, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := expression.EvalContext(ctx, MapParameters(parameters))
+		if err != nil || !reflect.DeepEqual(result, evaluationTest.Expected) {
+			test.Logf("Expected '%s' to be %v, got %v (%v)", evaluationTest.Input, evaluationTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+
+	// pure calls with literal arguments aren't made while parsing, and identical calls share one result.
+	if calls != 2 {
+		test.Logf("Expected 2 calls to 'band', got %d", calls)
+		test.Fail()
+	}
+
+	// inside a declared function, the function's own parameters are visible, and nothing is remembered between calls.
+	script, err := NewScript("def peek(x) = band('x'); peek(1) + peek(2) + peek(2)", definitions)
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	result, err := script.Evaluate(parameters)
+	if err != nil || result != float32(5) {
+		test.Logf("Expected 5, got %v (%v)", result, err)
+		test.Fail()
+	}
+}
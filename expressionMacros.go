@@ -0,0 +1,196 @@
+package govaluate
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+	A set of named expressions which can be used by name inside other expressions, such as `ndvi` for `(nir - red) / (nir + red)`.
+	Wherever a macro's name is used as a variable, the expression it names is used instead, as if it had been written there in parenthesis.
+	Macros may be defined and used from many goroutines at once.
+*/
+type Macros struct {
+	definitions map[string]FunctionDefinition
+
+	mutex  sync.RWMutex
+	macros map[string]*EvaluableExpression
+}
+
+/*
+	Creates an empty set of macros, which are parsed with the given function [definitions].
+	Expressions which use these macros are parsed with the same definitions.
+*/
+func NewMacros(definitions map[string]FunctionDefinition) *Macros {
+
+	copied := make(map[string]FunctionDefinition, len(definitions))
+	for name, definition := range definitions {
+		copied[name] = definition
+	}
+
+	return &Macros{
+		definitions: copied,
+		macros:      make(map[string]*EvaluableExpression),
+	}
+}
+
+/*
+	Parses the given [expression], and makes it available as [name].
+	The expression may use any macro which was defined before it, but not itself.
+	Returns an error if the expression can't be parsed, or if [name] is already a macro or a function.
+*/
+func (this *Macros) Define(name string, expression string) error {
+
+	if !isPlainName(name) {
+		return fmt.Errorf("Macro name '%s' is not a plain variable name", name)
+	}
+
+	_, found := this.definitions[name]
+	if found {
+		return fmt.Errorf("Macro '%s' has the same name as a function", name)
+	}
+
+	// the expression is parsed before it's defined, so that it can't refer to itself.
+	parsed, err := parseEvaluableExpression(expression, this.definitions, this, Limits{})
+	if err != nil {
+		return fmt.Errorf("Macro '%s': %v", name, err)
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	_, found = this.macros[name]
+	if found {
+		return fmt.Errorf("Macro '%s' is already defined", name)
+	}
+
+	this.macros[name] = parsed
+	return nil
+}
+
+/*
+	Returns the expression defined for the macro with the given [name], or nil if there is no such macro.
+*/
+func (this *Macros) Lookup(name string) *EvaluableExpression {
+
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	return this.macros[name]
+}
+
+/*
+	Parses the given [expression], replacing every use of one of the given [macros] with the expression it names.
+	The expression may use any of the functions which the macros were created with.
+*/
+func NewEvaluableExpressionWithMacros(expression string, macros *Macros) (*EvaluableExpression, error) {
+	return parseEvaluableExpression(expression, macros.definitions, macros, Limits{})
+}
+
+/*
+	Appends the given [token] to [tokens], unless it names a macro, in which case the macro's tokens are appended instead.
+	If there are no macros, the token is always appended.
+*/
+func (this *Macros) expand(tokens []ExpressionToken, token ExpressionToken) ([]ExpressionToken, error) {
+
+	if this == nil {
+		return append(tokens, token), nil
+	}
+
+	switch token.Kind {
+
+	case VARIABLE:
+
+		macro := this.Lookup(token.Value.(string))
+		if macro != nil {
+			return appendSubstitution(tokens, token, macro.tokens), nil
+		}
+
+	case ACCESSOR:
+
+		root := token.Value.([]string)[0]
+		if this.Lookup(root) != nil {
+			return nil, newParseError(token.span, "Cannot use an accessor on macro '%s'", root)
+		}
+	}
+
+	return append(tokens, token), nil
+}
+
+/*
+	Returns a new expression in which every variable named in [replacements] is replaced by the expression given for it.
+	Each replacement is evaluated on its own, as if it had been written in parenthesis, so `a * b` with `b` replaced by `c + d` is `a * (c + d)`.
+	The replacements aren't parsed again, so their functions are kept.
+
+	Replaced variables can't be used with accessors. The new expression has the same limits as this one, and no input string,
+	so `String` returns it formatted. Any span within it, including that of a `*ParseError`, points to where the replaced variable
+	was written in this expression.
+*/
+func (this EvaluableExpression) Substitute(replacements map[string]*EvaluableExpression) (*EvaluableExpression, error) {
+
+	var tokens []ExpressionToken
+
+	for _, token := range this.tokens {
+
+		switch token.Kind {
+
+		case VARIABLE:
+
+			name := token.Value.(string)
+
+			replacement, found := replacements[name]
+			if !found {
+				break
+			}
+
+			if replacement == nil || len(replacement.tokens) == 0 {
+				return nil, fmt.Errorf("Cannot replace variable '%s' with an empty expression", name)
+			}
+
+			tokens = appendSubstitution(tokens, token, replacement.tokens)
+			continue
+
+		case ACCESSOR:
+
+			root := token.Value.([]string)[0]
+
+			_, found := replacements[root]
+			if found {
+				err := newParseError(token.span, "Cannot replace variable '%s', which is used with an accessor", root)
+				return nil, locateError(err, this.inputExpression)
+			}
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	err := this.limits.checkTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := buildEvaluableExpression(tokens, this.limits)
+	if err != nil {
+		return nil, locateError(err, this.inputExpression)
+	}
+
+	ret.QueryDateFormat = this.QueryDateFormat
+	ret.ChecksTypes = this.ChecksTypes
+	return ret, nil
+}
+
+/*
+	Appends the [replacement] tokens in place of the [variable] token, in parenthesis so that they're evaluated on their own.
+	Every appended token is given the span of the variable, so that anything which points at them points at where the variable was written.
+*/
+func appendSubstitution(tokens []ExpressionToken, variable ExpressionToken, replacement []ExpressionToken) []ExpressionToken {
+
+	tokens = append(tokens, ExpressionToken{Kind: CLAUSE, Value: '(', span: variable.span})
+
+	for _, token := range replacement {
+		token.span = variable.span
+		tokens = append(tokens, token)
+	}
+
+	return append(tokens, ExpressionToken{Kind: CLAUSE_CLOSE, Value: ')', span: variable.span})
+}
@@ -0,0 +1,145 @@
+package govaluate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubstitution(test *testing.T) {
+
+	ndvi, _ := NewEvaluableExpression("(nir - red) / (nir + red)")
+	scaled, _ := NewEvaluableExpressionWithFunctions("double(x)", map[string]ExpressionFunction{
+		"double": func(arguments ...interface{}) (interface{}, error) {
+			return arguments[0].(float32) * 2, nil
+		},
+	})
+
+	expression, _ := NewEvaluableExpression("ndvi > 0.5 ? scaled * ndvi : -ndvi")
+
+	substituted, err := expression.Substitute(map[string]*EvaluableExpression{
+		"ndvi":   ndvi,
+		"scaled": scaled,
+	})
+	if err != nil {
+		test.Fatalf("Failed to substitute: %v", err)
+	}
+
+	parameters := map[string]interface{}{
+		"nir": float32(7),
+		"red": float32(1),
+		"x":   float32(3),
+	}
+
+	result, err := substituted.Evaluate(parameters)
+	if err != nil || result != float32(4.5) {
+		test.Logf("Expected 4.5, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	formatted := "(nir - red) / (nir + red) > 0.5 ? double(x) * ((nir - red) / (nir + red)) : -((nir - red) / (nir + red))"
+	if substituted.String() != formatted {
+		test.Logf("Unexpected string '%s'", substituted.String())
+		test.Fail()
+	}
+
+	// every part of a replacement points back to where the variable was written.
+	Inspect(substituted.AST(), func(node Node) bool {
+
+		call, ok := node.(*CallNode)
+		if ok && call.Span() != (Span{Start: 13, End: 19}) {
+			test.Logf("Expected the call to have the span of 'scaled', got %v", call.Span())
+			test.Fail()
+		}
+		return true
+	})
+
+	_, err = expression.Substitute(map[string]*EvaluableExpression{"ndvi": nil})
+	if err == nil {
+		test.Logf("Expected an error replacing a variable with nothing")
+		test.Fail()
+	}
+
+	accessed, _ := NewEvaluableExpression("1 + foo.Bar")
+
+	_, err = accessed.Substitute(map[string]*EvaluableExpression{"foo": ndvi})
+	if err == nil || !strings.Contains(err.Error(), "column 5") {
+		test.Logf("Expected an error pointing to the accessor, got %v", err)
+		test.Fail()
+	}
+
+	limited, _ := NewEvaluableExpressionWithLimits("ndvi * 2", nil, Limits{MaxTokens: 5})
+
+	_, err = limited.Substitute(map[string]*EvaluableExpression{"ndvi": ndvi})
+	if _, ok := err.(*LimitError); !ok {
+		test.Logf("Expected a limit error, got %v", err)
+		test.Fail()
+	}
+}
+
+func TestMacros(test *testing.T) {
+
+	macros := NewMacros(map[string]FunctionDefinition{
+		"abs": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				value := arguments[0].(float32)
+				if value < 0 {
+					return -value, nil
+				}
+				return value, nil
+			},
+		},
+	})
+
+	err := macros.Define("ndvi", "(nir - red) / (nir + red)")
+	if err != nil {
+		test.Fatalf("Failed to define a macro: %v", err)
+	}
+
+	err = macros.Define("strength", "abs(ndvi)")
+	if err != nil {
+		test.Fatalf("Failed to define a macro using another: %v", err)
+	}
+
+	expression, err := NewEvaluableExpressionWithMacros("strength * 10 - [ndvi]", macros)
+	if err != nil {
+		test.Fatalf("Failed to parse with macros: %v", err)
+	}
+
+	result, err := expression.Evaluate(map[string]interface{}{"nir": 1, "red": 3})
+	if err != nil || result != float32(5.5) {
+		test.Logf("Expected 5.5, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	if !reflect.DeepEqual(expression.Variables(), []string{"nir", "red"}) {
+		test.Logf("Expected the macros to be expanded, got variables %v", expression.Variables())
+		test.Fail()
+	}
+
+	failures := []struct {
+		Name       string
+		Expression string
+		Expected   string
+	}{
+		{"ndvi", "nir", "already defined"},
+		{"abs", "nir", "same name as a function"},
+		{"two words", "nir", "not a plain variable name"},
+		{"broken", "nir +", "Macro 'broken'"},
+	}
+
+	for _, failure := range failures {
+
+		err = macros.Define(failure.Name, failure.Expression)
+		if err == nil || !strings.Contains(err.Error(), failure.Expected) {
+			test.Logf("Expected an error containing '%s' defining '%s', got %v", failure.Expected, failure.Name, err)
+			test.Fail()
+		}
+	}
+
+	_, err = NewEvaluableExpressionWithMacros("2 * ndvi.Value", macros)
+	if err == nil || !strings.Contains(err.Error(), "column 5") {
+		test.Logf("Expected an error pointing to the accessor, got %v", err)
+		test.Fail()
+	}
+}
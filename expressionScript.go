@@ -0,0 +1,390 @@
+package govaluate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+/*
+	A sequence of statements, separated by `;` or by new lines, which are evaluated in order.
+	Each statement is an expression, optionally assigned to a local variable with `name = expression`.
+	Locals can be used by any statement after the one which assigns them, and hide any parameter of the same name.
+	Evaluating a script returns the value of its last statement.
+
+	A statement may also declare a function, like `def scale(x, lo, hi) = (x - lo) / (hi - lo)`, which can be called by any statement after it.
+
+	Like expressions, a script may be evaluated by many goroutines at once. Locals only last for a single evaluation.
+*/
+type Script struct {
+	source     string
+	statements []scriptStatement
+	limits     Limits
+
+	// whether or not the script declares any functions.
+	declares bool
+}
+
+type scriptStatement struct {
+
+	// the local which this statement assigns, or "" if it doesn't assign one.
+	name string
+
+	expression *EvaluableExpression
+}
+
+/*
+	Parameters for a single evaluation of a script, which are looked up in the script's locals before the given parameters.
+*/
+type scriptParameters struct {
+	locals     map[string]interface{}
+	parameters Parameters
+}
+
+/*
+	Parses the given [source] as a script, whose statements may use the given function [definitions].
+	Statements are separated by `;`, or by new lines outside of parenthesis, so a long statement can be split across lines by putting it in parenthesis.
+*/
+func NewScript(source string, definitions map[string]FunctionDefinition) (*Script, error) {
+	return NewScriptWithLimits(source, definitions, Limits{})
+}
+
+/*
+	Similar to [NewScript], except that the script must stay within the given [limits].
+	The token and depth limits apply to each statement. The others apply to each evaluation of the whole script.
+*/
+func NewScriptWithLimits(source string, definitions map[string]FunctionDefinition, limits Limits) (*Script, error) {
+
+	ret := &Script{
+		source: source,
+		limits: limits,
+	}
+
+	// declared functions are added to a copy, so that the caller's definitions aren't changed.
+	scriptDefinitions := make(map[string]FunctionDefinition, len(definitions))
+	for name, definition := range definitions {
+		scriptDefinitions[name] = definition
+	}
+
+	for _, text := range splitStatements(source) {
+
+		var statement scriptStatement
+		var err error
+
+		if strings.TrimSpace(text.source) == "" {
+			continue
+		}
+
+		if isDeclaration(text.source) {
+
+			var name string
+			var definition FunctionDefinition
+
+			name, definition, err = ParseFunctionWithLimits(text.source, scriptDefinitions, limits)
+			if err == nil {
+				scriptDefinitions[name] = definition
+				ret.declares = true
+			}
+		} else {
+			statement, err = parseStatement(text.source, scriptDefinitions, limits)
+		}
+
+		if err != nil {
+
+			_, isLimit := err.(*LimitError)
+			if isLimit {
+				return nil, err
+			}
+
+			// parse errors already say which line they're on, once they're moved to where the statement is in the script.
+			moved, ok := moveParseError(err, source, text.offset, "")
+			if ok {
+				return nil, moved
+			}
+			return nil, fmt.Errorf("Statement on line %d: %v", text.line, err)
+		}
+
+		if statement.expression != nil {
+			ret.statements = append(ret.statements, statement)
+		}
+	}
+
+	if len(ret.statements) == 0 {
+		return nil, errors.New("Script has no statements")
+	}
+	return ret, nil
+}
+
+/*
+	Same as `Eval`, but automatically wraps a map of parameters into a `govaluate.Parameters` structure.
+*/
+func (this *Script) Evaluate(parameters map[string]interface{}) (interface{}, error) {
+
+	if parameters == nil {
+		return this.Eval(nil)
+	}
+	return this.Eval(MapParameters(parameters))
+}
+
+/*
+	Runs every statement of the script in order with the given [parameters], returning the value of the last.
+*/
+func (this *Script) Eval(parameters Parameters) (interface{}, error) {
+	return this.EvalContext(context.Background(), parameters)
+}
+
+/*
+	Same as `Eval`, but stops as soon as possible once the given [ctx] is done, returning `ctx.Err()`.
+*/
+func (this *Script) EvalContext(ctx context.Context, parameters Parameters) (interface{}, error) {
+
+	var result interface{}
+	var err error
+
+	if parameters == nil {
+		parameters = DUMMY_PARAMETERS
+	}
+
+	scope := &scriptParameters{
+		locals:     make(map[string]interface{}),
+		parameters: parameters,
+	}
+	usage := &evaluationUsage{limits: this.limits}
+
+	// calls to declared functions count against the limits of the whole script.
+	if this.declares {
+		ctx = withDeclaredCalls(ctx, usage)
+	}
+
+	for _, statement := range this.statements {
+
+		result, err = statement.expression.evalWithUsage(ctx, scope, usage)
+		if err != nil {
+			return nil, err
+		}
+
+		if statement.name != "" {
+			scope.locals[statement.name] = result
+		}
+	}
+	return result, nil
+}
+
+/*
+	Returns the names of the parameters that this script uses, each only once, in the order they first appear.
+	Locals aren't included, unless they're used before they're assigned.
+*/
+func (this *Script) Variables() []string {
+
+	var ret orderedNames
+	assigned := make(map[string]bool)
+
+	for _, statement := range this.statements {
+
+		for _, name := range statement.expression.Variables() {
+			if !assigned[name] {
+				ret.add(name)
+			}
+		}
+
+		if statement.name != "" {
+			assigned[statement.name] = true
+		}
+	}
+	return ret.names
+}
+
+/*
+	Returns the source of this script, as it was given.
+*/
+func (this *Script) String() string {
+	return this.source
+}
+
+func (this *scriptParameters) Get(name string) (interface{}, error) {
+
+	value, found := this.locals[name]
+	if found {
+		return value, nil
+	}
+	return this.parameters.Get(name)
+}
+
+/*
+	Parses a single statement, which may assign its value to a local.
+*/
+func parseStatement(source string, definitions map[string]FunctionDefinition, limits Limits) (scriptStatement, error) {
+
+	var ret scriptStatement
+	var err error
+
+	name, expression, offset := splitAssignment(source)
+	if name != "" {
+
+		_, found := definitions[name]
+		if found {
+			return ret, fmt.Errorf("Cannot assign to '%s', which is a function", name)
+		}
+		ret.name = name
+	}
+
+	ret.expression, err = NewEvaluableExpressionWithLimits(expression, definitions, limits)
+	if err != nil {
+		moved, _ := moveParseError(err, source, offset, "")
+		return ret, moved
+	}
+	return ret, nil
+}
+
+/*
+	If the given statement [source] is an assignment like `name = expression`, returns the name and the expression,
+	along with how many characters into [source] the expression starts.
+	Otherwise, returns no name, and the whole source as the expression.
+*/
+func splitAssignment(source string) (string, string, int) {
+
+	runes := []rune(source)
+	start := 0
+
+	for start < len(runes) && unicode.IsSpace(runes[start]) {
+		start++
+	}
+
+	end := start
+	for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+		end++
+	}
+
+	equals := end
+	for equals < len(runes) && unicode.IsSpace(runes[equals]) {
+		equals++
+	}
+
+	// a single '=', which isn't part of '=='.
+	if equals >= len(runes) || runes[equals] != '=' || (equals+1 < len(runes) && runes[equals+1] == '=') {
+		return "", source, 0
+	}
+
+	name := string(runes[start:end])
+	if !isPlainName(name) {
+		return "", source, 0
+	}
+	return name, string(runes[equals+1:]), equals + 1
+}
+
+type statementText struct {
+	source string
+
+	// the line of the script that the statement starts on, counting from one,
+	// and the number of characters before the statement.
+	line   int
+	offset int
+}
+
+/*
+	Splits a script's [source] into the text of each statement.
+	Separators inside strings, escaped variable names, comments, or parenthesis don't end a statement.
+	Comments are replaced by spaces, so that a statement which is only a comment is empty, and everything else stays where it was.
+*/
+func splitStatements(source string) []statementText {
+
+	var ret []statementText
+	var current []rune
+	var quote rune
+	var escaped, bracketed, lineComment, blockComment bool
+
+	characters := []rune(source)
+	parens := 0
+	line := 1
+	start := 1
+	offset := 0
+	startOffset := 0
+	commentStart := 0
+
+	for index, character := range characters {
+
+		offset++
+
+		// the newline at the end of a line comment may still end the statement.
+		if lineComment && character == '\n' {
+			lineComment = false
+		}
+
+		if lineComment || blockComment {
+
+			// the '*' which closes a block comment can't be the one which opened it.
+			if blockComment && character == '/' && characters[index-1] == '*' && index-1 >= commentStart+2 {
+				blockComment = false
+			}
+
+			if character == '\n' {
+				line++
+			} else {
+				character = ' '
+			}
+			current = append(current, character)
+			continue
+		}
+
+		switch {
+
+		case quote != 0:
+
+			switch {
+			case escaped:
+				escaped = false
+			case character == '\\':
+				escaped = true
+			case character == quote:
+				quote = 0
+			}
+
+		case bracketed:
+			bracketed = character != ']'
+
+		case isCommentStart(characters, index):
+			lineComment = characters[index+1] == '/'
+			blockComment = !lineComment
+			commentStart = index
+			character = ' '
+
+		case character == '\'' || character == '"':
+			quote = character
+
+		case character == '[':
+			bracketed = true
+
+		case character == '(':
+			parens++
+
+		case character == ')':
+			parens--
+
+		case character == ';' || (character == '\n' && parens <= 0):
+
+			ret = append(ret, statementText{source: string(current), line: start, offset: startOffset})
+			current = current[:0]
+
+			if character == '\n' {
+				line++
+			}
+			start = line
+			startOffset = offset
+			continue
+		}
+
+		if character == '\n' {
+			line++
+		}
+		current = append(current, character)
+	}
+
+	// a block comment which is never closed is left as it is, so that parsing it reports the error.
+	if blockComment {
+		current = append(current[:len(current)-(len(characters)-commentStart)], characters[commentStart:]...)
+	}
+
+	return append(ret, statementText{source: string(current), line: start, offset: startOffset})
+}
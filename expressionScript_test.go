@@ -0,0 +1,170 @@
+package govaluate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+	Represents a test of a script, which expects [Source] to evaluate to [Expected] with the given [Parameters].
+*/
+type ScriptTest struct {
+	Name       string
+	Source     string
+	Parameters map[string]interface{}
+	Expected   interface{}
+}
+
+func TestScripts(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"double": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return arguments[0].(float32) * 2, nil
+			},
+		},
+	}
+
+	scriptTests := []ScriptTest{
+
+		ScriptTest{
+			Name:       "Single expression",
+			Source:     "1 + x",
+			Parameters: map[string]interface{}{"x": 2},
+			Expected:   float32(3),
+		},
+		ScriptTest{
+			Name:       "Semicolons",
+			Source:     "v = (nir - red) / (nir + red); m = v > 0.2; m ? v : nodata",
+			Parameters: map[string]interface{}{"nir": 3, "red": 1, "nodata": -1},
+			Expected:   float32(0.5),
+		},
+		ScriptTest{
+			Name:       "New lines",
+			Source:     "v = (nir - red) / (nir + red)\n\nm = v > 0.6\n\nm ? v : nodata\n",
+			Parameters: map[string]interface{}{"nir": 3, "red": 1, "nodata": -1},
+			Expected:   float32(-1),
+		},
+		ScriptTest{
+			Name:       "Statement over several lines",
+			Source:     "total = (a +\n b +\n c)\ntotal * 2",
+			Parameters: map[string]interface{}{"a": 1, "b": 2, "c": 3},
+			Expected:   float32(12),
+		},
+		ScriptTest{
+			Name:       "Locals hide parameters",
+			Source:     "x = x * 10; x + 1",
+			Parameters: map[string]interface{}{"x": 2},
+			Expected:   float32(21),
+		},
+		ScriptTest{
+			Name:     "Reassignment",
+			Source:   "a = 1; a = a + 1; a = double(a)",
+			Expected: float32(4),
+		},
+		ScriptTest{
+			Name:     "Separators in strings",
+			Source:   "s = 'a;b\\n' ; t = [a;b]; s == 'a;b\\n' && t",
+			Expected: true,
+			Parameters: map[string]interface{}{
+				"a;b": true,
+			},
+		},
+		ScriptTest{
+			Name:       "Comparisons aren't assignments",
+			Source:     "a == 1",
+			Parameters: map[string]interface{}{"a": 1},
+			Expected:   true,
+		},
+		ScriptTest{
+			Name:       "Comments",
+			Source:     "// totals\na = 1 // first; not a separator\n/* b = 2;\n   still a comment */\nb = a + 1 /* inline */ + [c // d]\nb",
+			Parameters: map[string]interface{}{"c // d": 1},
+			Expected:   float32(3),
+		},
+		ScriptTest{
+			Name:       "Arrays",
+			Source:     "scaled = xs * 2; scaled > 3",
+			Parameters: map[string]interface{}{"xs": []float32{1, 2}},
+			Expected:   []bool{false, true},
+		},
+	}
+
+	for _, scriptTest := range scriptTests {
+
+		script, err := NewScript(scriptTest.Source, definitions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", scriptTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := script.Evaluate(scriptTest.Parameters)
+		if err != nil || !reflect.DeepEqual(result, scriptTest.Expected) {
+			test.Logf("Test '%s' failed", scriptTest.Name)
+			test.Logf("Expected %v, got %v (%v)", scriptTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+}
+
+func TestScriptErrors(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"double": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return arguments[0], nil
+			},
+		},
+	}
+
+	failures := map[string]string{
+		"a = 1\nb = a +\nb": "line 2",
+		"a = 1; double = 2": "which is a function",
+		" ; \n ":            "no statements",
+		"// a = 1\n/* b */": "no statements",
+		"a = 1\nb /* a +\n": "Unclosed block comment (line 2, column 3)",
+	}
+
+	for source, expected := range failures {
+
+		_, err := NewScript(source, definitions)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			test.Logf("Expected an error containing '%s' for '%s', got %v", expected, source, err)
+			test.Fail()
+		}
+	}
+
+	// locals don't outlive an evaluation.
+	script, _ := NewScript("b = a + 1; c", nil)
+
+	_, err := script.Evaluate(map[string]interface{}{"a": 1})
+	if err == nil {
+		test.Logf("Expected an error for a missing parameter")
+		test.Fail()
+	}
+
+	// evaluation limits count every statement.
+	limited, _ := NewScriptWithLimits("a = double(1); double(a)", definitions, Limits{MaxFunctionCalls: 1})
+
+	_, err = limited.EvalContext(context.Background(), nil)
+	if _, ok := err.(*LimitError); !ok {
+		test.Logf("Expected a limit error, got %v", err)
+		test.Fail()
+	}
+}
+
+func TestScriptVariables(test *testing.T) {
+
+	script, err := NewScript("v = (nir - red) / (nir + red)\nv > limit ? v : red", nil)
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	if !reflect.DeepEqual(script.Variables(), []string{"nir", "red", "limit"}) {
+		test.Logf("Unexpected variables %v", script.Variables())
+		test.Fail()
+	}
+}
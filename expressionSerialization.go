@@ -0,0 +1,605 @@
+package govaluate
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	The version of the serialized form written by `MarshalJSON` and `MarshalBinary`.
+	It changes whenever a stored expression would no longer be read back the same way.
+*/
+const serializationVersion = 1
+
+/*
+	The stored form of an expression. It holds the expression's tokens and its planned stages,
+	so that neither has to be worked out again when it's read back.
+	Functions are stored by name, and looked up again when the expression is read.
+*/
+type serializedExpression struct {
+	Version    int               `json:"version"`
+	Expression string            `json:"expression,omitempty"`
+	Tokens     []serializedToken `json:"tokens"`
+	Plan       *serializedStage  `json:"plan,omitempty"`
+	Limits     Limits            `json:"limits"`
+}
+
+type serializedToken struct {
+	Kind     string           `json:"kind"`
+	Value    *serializedValue `json:"value,omitempty"`
+	Function string           `json:"function,omitempty"`
+	Start    int              `json:"start,omitempty"`
+	End      int              `json:"end,omitempty"`
+}
+
+type serializedStage struct {
+	Symbol   string           `json:"symbol"`
+	Left     *serializedStage `json:"left,omitempty"`
+	Right    *serializedStage `json:"right,omitempty"`
+	Value    *serializedValue `json:"value,omitempty"`
+	Variable string           `json:"variable,omitempty"`
+	Function string           `json:"function,omitempty"`
+	Path     []string         `json:"path,omitempty"`
+	Format   string           `json:"format,omitempty"`
+}
+
+/*
+	A single literal value. Numbers are stored as text, so that infinities, NaN and negative zero are kept exactly.
+*/
+type serializedValue struct {
+	Type string   `json:"type"`
+	Text string   `json:"text,omitempty"`
+	Path []string `json:"path,omitempty"`
+}
+
+var registeredFunctions = struct {
+	sync.RWMutex
+	definitions map[string]FunctionDefinition
+}{
+	definitions: make(map[string]FunctionDefinition),
+}
+
+/*
+	Makes a function available to every expression which is unmarshaled without being given functions of its own,
+	which is the case for `UnmarshalText`, `UnmarshalJSON` and `UnmarshalBinary`.
+	This is meant to be called during initialization, before any expressions are unmarshaled.
+*/
+func RegisterFunction(name string, definition FunctionDefinition) {
+
+	registeredFunctions.Lock()
+	defer registeredFunctions.Unlock()
+
+	registeredFunctions.definitions[name] = definition
+}
+
+func findRegisteredFunctions() map[string]FunctionDefinition {
+
+	registeredFunctions.RLock()
+	defer registeredFunctions.RUnlock()
+
+	ret := make(map[string]FunctionDefinition, len(registeredFunctions.definitions))
+	for name, definition := range registeredFunctions.definitions {
+		ret[name] = definition
+	}
+	return ret
+}
+
+/*
+	Returns the text of this expression (see `String`), so that expressions can be used in configuration files.
+*/
+func (this EvaluableExpression) MarshalText() ([]byte, error) {
+
+	if this.inputExpression != "" {
+		return []byte(this.inputExpression), nil
+	}
+
+	formatted, err := this.Format()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(formatted), nil
+}
+
+/*
+	Parses the given [text] into this expression, with any functions that have been registered with `RegisterFunction`.
+*/
+func (this *EvaluableExpression) UnmarshalText(text []byte) error {
+
+	parsed, err := NewEvaluableExpressionWithDefinitions(string(text), findRegisteredFunctions())
+	if err != nil {
+		return err
+	}
+
+	*this = *parsed
+	return nil
+}
+
+/*
+	Stores this expression as JSON, including its planned stages, so that it can be read back without being parsed again.
+	Functions are stored by name.
+*/
+func (this EvaluableExpression) MarshalJSON() ([]byte, error) {
+
+	serialized, err := this.serialize()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(serialized)
+}
+
+/*
+	Reads an expression written by `MarshalJSON`, with any functions that have been registered with `RegisterFunction`.
+	A JSON string is also accepted, and parsed as the text of an expression.
+*/
+func (this *EvaluableExpression) UnmarshalJSON(data []byte) error {
+
+	var text string
+
+	// plain strings are convenient in configuration files.
+	if len(data) > 0 && data[0] == '"' {
+
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+		return this.UnmarshalText([]byte(text))
+	}
+
+	parsed, err := NewEvaluableExpressionFromJSON(data, findRegisteredFunctions())
+	if err != nil {
+		return err
+	}
+
+	*this = *parsed
+	return nil
+}
+
+/*
+	Stores this expression in a compact binary form, holding the same information as `MarshalJSON`.
+*/
+func (this EvaluableExpression) MarshalBinary() ([]byte, error) {
+
+	var buffer bytes.Buffer
+
+	serialized, err := this.serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	err = gob.NewEncoder(&buffer).Encode(serialized)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+/*
+	Reads an expression written by `MarshalBinary`, with any functions that have been registered with `RegisterFunction`.
+*/
+func (this *EvaluableExpression) UnmarshalBinary(data []byte) error {
+
+	parsed, err := NewEvaluableExpressionFromBinary(data, findRegisteredFunctions())
+	if err != nil {
+		return err
+	}
+
+	*this = *parsed
+	return nil
+}
+
+/*
+	Reads an expression written by `MarshalJSON`. Every function it calls must be one of the given [definitions].
+*/
+func NewEvaluableExpressionFromJSON(data []byte, definitions map[string]FunctionDefinition) (*EvaluableExpression, error) {
+
+	var serialized serializedExpression
+
+	err := json.Unmarshal(data, &serialized)
+	if err != nil {
+		return nil, err
+	}
+	return serialized.deserialize(definitions)
+}
+
+/*
+	Reads an expression written by `MarshalBinary`. Every function it calls must be one of the given [definitions].
+*/
+func NewEvaluableExpressionFromBinary(data []byte, definitions map[string]FunctionDefinition) (*EvaluableExpression, error) {
+
+	var serialized serializedExpression
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&serialized)
+	if err != nil {
+		return nil, err
+	}
+	return serialized.deserialize(definitions)
+}
+
+func (this EvaluableExpression) serialize() (*serializedExpression, error) {
+
+	var err error
+
+	ret := &serializedExpression{
+		Version:    serializationVersion,
+		Expression: this.inputExpression,
+		Tokens:     make([]serializedToken, len(this.tokens)),
+		Limits:     this.limits,
+	}
+
+	for i, token := range this.tokens {
+
+		ret.Tokens[i], err = serializeToken(token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if this.evaluationStages != nil {
+
+		ret.Plan, err = serializeStage(this.evaluationStages)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *serializedExpression) deserialize(definitions map[string]FunctionDefinition) (*EvaluableExpression, error) {
+
+	var err error
+
+	if this.Version != serializationVersion {
+		return nil, fmt.Errorf("Unsupported serialization version %d", this.Version)
+	}
+
+	ret := new(EvaluableExpression)
+	ret.QueryDateFormat = isoDateFormat
+	ret.ChecksTypes = true
+	ret.inputExpression = this.Expression
+	ret.limits = this.Limits
+	ret.tokens = make([]ExpressionToken, len(this.Tokens))
+
+	for i, token := range this.Tokens {
+
+		ret.tokens[i], err = token.deserialize(definitions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if this.Plan == nil {
+		return ret, nil
+	}
+
+	ret.evaluationStages, err = this.Plan.deserialize(definitions)
+	if err != nil {
+		return nil, err
+	}
+
+	// sharing depends on which functions are pure, so it's worked out again with the functions given now.
+	ret.evaluationStages = eliminateCommonSubexpressions(ret.evaluationStages)
+	fuseStages(ret.evaluationStages)
+
+	ret.program = compileStages(ret.evaluationStages)
+	return ret, nil
+}
+
+func serializeToken(token ExpressionToken) (serializedToken, error) {
+
+	var err error
+
+	ret := serializedToken{
+		Kind:  token.Kind.String(),
+		Start: token.span.Start,
+		End:   token.span.End,
+	}
+
+	switch token.Kind {
+
+	case FUNCTION:
+		if token.functionName == "" {
+			return ret, errors.New("Unable to store a function token without a name")
+		}
+		ret.Function = token.functionName
+
+	case CLAUSE, CLAUSE_CLOSE:
+
+	default:
+		ret.Value, err = serializeValue(token.Value)
+	}
+
+	return ret, err
+}
+
+func (this serializedToken) deserialize(definitions map[string]FunctionDefinition) (ExpressionToken, error) {
+
+	var err error
+
+	ret := ExpressionToken{
+		Kind: tokenKindNames[this.Kind],
+		span: Span{Start: this.Start, End: this.End},
+	}
+
+	switch ret.Kind {
+
+	case UNKNOWN:
+		return ret, fmt.Errorf("Unknown token kind '%s'", this.Kind)
+
+	case FUNCTION:
+		definition, found := definitions[this.Function]
+		if !found {
+			return ret, fmt.Errorf("Function '%s' is not defined", this.Function)
+		}
+
+		ret.Value = findDefinedFunction(definition)
+		ret.functionName = this.Function
+		ret.pure = definition.Pure
+		ret.signature = findDefinedSignature(definition)
+
+	case CLAUSE:
+		ret.Value = '('
+	case CLAUSE_CLOSE:
+		ret.Value = ')'
+
+	default:
+		ret.Value, err = this.Value.deserialize()
+	}
+
+	return ret, err
+}
+
+func serializeStage(stage *evaluationStage) (*serializedStage, error) {
+
+	var err error
+
+	ret := &serializedStage{
+		Symbol:   symbolNames[stage.symbol],
+		Variable: stage.parameterName,
+		Function: stage.functionName,
+		Path:     stage.accessorPath,
+		Format:   stage.typeErrorFormat,
+	}
+
+	if stage.symbol == LITERAL {
+
+		ret.Value, err = serializeValue(literalStageValue(stage))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stage.leftStage != nil {
+
+		ret.Left, err = serializeStage(stage.leftStage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stage.rightStage != nil {
+
+		ret.Right, err = serializeStage(stage.rightStage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *serializedStage) deserialize(definitions map[string]FunctionDefinition) (*evaluationStage, error) {
+
+	var err error
+
+	symbol, found := symbolValues[this.Symbol]
+	if !found {
+		return nil, fmt.Errorf("Unknown operator '%s'", this.Symbol)
+	}
+
+	ret := &evaluationStage{
+		symbol:          symbol,
+		typeErrorFormat: this.Format,
+	}
+
+	if this.Left != nil {
+
+		ret.leftStage, err = this.Left.deserialize(definitions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if this.Right != nil {
+
+		ret.rightStage, err = this.Right.deserialize(definitions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// stored stages aren't planned again, so their shape is checked here instead.
+	invalid := errors.New("Stored plan has an invalid '" + this.Symbol + "' stage")
+
+	switch symbol {
+
+	case VALUE:
+		if this.Variable == "" {
+			return nil, invalid
+		}
+		ret.parameterName = this.Variable
+		ret.operator = makeParameterStage(this.Variable)
+
+	case LITERAL:
+		literal, err := this.Value.deserialize()
+		if err != nil {
+			return nil, err
+		}
+		ret.operator = makeLiteralStage(literal)
+
+	case NOOP:
+		ret.operator = noopStageRight
+
+	case FUNCTIONAL:
+		definition, found := definitions[this.Function]
+		if !found {
+			return nil, fmt.Errorf("Function '%s' is not defined", this.Function)
+		}
+
+		function := findDefinedFunction(definition)
+
+		ret.operator, found = makeCallStage(this.Function, function)
+		if !found {
+			return nil, fmt.Errorf("Function '%s' is not defined", this.Function)
+		}
+
+		ret.functionName = this.Function
+		ret.pure = definition.Pure
+		ret.token = ExpressionToken{
+			Kind:         FUNCTION,
+			Value:        function,
+			functionName: this.Function,
+			pure:         definition.Pure,
+			signature:    findDefinedSignature(definition),
+		}
+
+	case ACCESS:
+		if len(this.Path) < 2 {
+			return nil, invalid
+		}
+		ret.accessorPath = this.Path
+		ret.operator = makeAccessorStage(this.Path)
+
+	default:
+		prefix := symbol == NEGATE || symbol == INVERT || symbol == BITWISE_NOT
+		if ret.rightStage == nil || prefix != (ret.leftStage == nil) {
+			return nil, invalid
+		}
+
+		checks := findTypeChecks(symbol)
+
+		ret.operator = stageSymbolMap[symbol]
+		ret.leftTypeCheck = checks.left
+		ret.rightTypeCheck = checks.right
+		ret.typeCheck = checks.combined
+	}
+
+	return ret, nil
+}
+
+func serializeValue(value interface{}) (*serializedValue, error) {
+
+	switch typed := value.(type) {
+	case float32:
+		return &serializedValue{Type: "number", Text: strconv.FormatFloat(float64(typed), 'g', -1, 32)}, nil
+	case float64:
+		return &serializedValue{Type: "float64", Text: strconv.FormatFloat(typed, 'g', -1, 64)}, nil
+	case bool:
+		return &serializedValue{Type: "bool", Text: strconv.FormatBool(typed)}, nil
+	case nil:
+		return &serializedValue{Type: "null"}, nil
+	case string:
+		return &serializedValue{Type: "string", Text: typed}, nil
+	case *regexp.Regexp:
+		return &serializedValue{Type: "pattern", Text: typed.String()}, nil
+	case time.Time:
+		return &serializedValue{Type: "time", Text: typed.Format(time.RFC3339Nano)}, nil
+	case []string:
+		return &serializedValue{Type: "path", Path: typed}, nil
+	}
+
+	return nil, fmt.Errorf("Unable to store value '%v' of type %T", value, value)
+}
+
+func (this *serializedValue) deserialize() (interface{}, error) {
+
+	if this == nil {
+		return nil, errors.New("Stored value is missing")
+	}
+
+	switch this.Type {
+
+	case "number":
+		value, err := strconv.ParseFloat(this.Text, 32)
+		return float32(value), err
+	case "float64":
+		return strconv.ParseFloat(this.Text, 64)
+	case "bool":
+		return strconv.ParseBool(this.Text)
+	case "null":
+		return nil, nil
+	case "string":
+		return this.Text, nil
+	case "pattern":
+		return regexp.Compile(this.Text)
+	case "time":
+		return time.Parse(time.RFC3339Nano, this.Text)
+	case "path":
+		return this.Path, nil
+	}
+
+	return nil, fmt.Errorf("Unknown stored value type '%s'", this.Type)
+}
+
+/*
+	Operators are stored by name, so that a stored expression doesn't depend on the order of the OperatorSymbol constants.
+*/
+var symbolNames = map[OperatorSymbol]string{
+	VALUE:          "VALUE",
+	LITERAL:        "LITERAL",
+	NOOP:           "NOOP",
+	EQ:             "EQ",
+	NEQ:            "NEQ",
+	GT:             "GT",
+	LT:             "LT",
+	GTE:            "GTE",
+	LTE:            "LTE",
+	REQ:            "REQ",
+	NREQ:           "NREQ",
+	IN:             "IN",
+	IS:             "IS",
+	IS_NOT:         "IS_NOT",
+	AND:            "AND",
+	OR:             "OR",
+	PLUS:           "PLUS",
+	MINUS:          "MINUS",
+	BITWISE_AND:    "BITWISE_AND",
+	BITWISE_OR:     "BITWISE_OR",
+	BITWISE_XOR:    "BITWISE_XOR",
+	BITWISE_LSHIFT: "BITWISE_LSHIFT",
+	BITWISE_RSHIFT: "BITWISE_RSHIFT",
+	MULTIPLY:       "MULTIPLY",
+	DIVIDE:         "DIVIDE",
+	MODULUS:        "MODULUS",
+	EXPONENT:       "EXPONENT",
+	NEGATE:         "NEGATE",
+	INVERT:         "INVERT",
+	BITWISE_NOT:    "BITWISE_NOT",
+	TERNARY_TRUE:   "TERNARY_TRUE",
+	TERNARY_FALSE:  "TERNARY_FALSE",
+	COALESCE:       "COALESCE",
+	FUNCTIONAL:     "FUNCTIONAL",
+	ACCESS:         "ACCESS",
+	SEPARATE:       "SEPARATE",
+}
+
+var symbolValues = map[string]OperatorSymbol{}
+var tokenKindNames = map[string]TokenKind{}
+
+func init() {
+
+	for symbol, name := range symbolNames {
+		symbolValues[name] = symbol
+	}
+
+	for kind := PREFIX; kind <= NULL; kind++ {
+		tokenKindNames[kind.String()] = kind
+	}
+}
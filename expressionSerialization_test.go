@@ -0,0 +1,203 @@
+package govaluate
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSerialization(test *testing.T) {
+
+	calls := 0
+
+	definitions := map[string]FunctionDefinition{
+		"double": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				calls++
+				return arguments[0].(float32) * 2, nil
+			},
+			Pure: true,
+		},
+	}
+
+	inputs := []string{
+		"double(x) + double(x) * 2 ** 2",
+		"name =~ '^f.o' && x in (1, 2, 3)",
+		"(1 / 0) > x ? -x : x ?? 5",
+		"foo.Int + 1",
+		"missing is not null || x + null == null ?? 1",
+		"'2014-01-02' > '2014-01-01' || [escaped name] == 'it\\'s'",
+	}
+
+	parameters := map[string]interface{}{
+		"x":            float32(3),
+		"missing":      nil,
+		"name":         "foo",
+		"foo":          dummyParameterInstance,
+		"escaped name": "it's",
+	}
+
+	for _, input := range inputs {
+
+		expression, err := NewEvaluableExpressionWithDefinitions(input, definitions)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		expected, expectedErr := expression.Evaluate(parameters)
+
+		encoded, err := json.Marshal(expression)
+		if err != nil {
+			test.Logf("Failed to store '%s' as JSON: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		binary, err := expression.MarshalBinary()
+		if err != nil {
+			test.Logf("Failed to store '%s' as binary: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		fromJSON, err := NewEvaluableExpressionFromJSON(encoded, definitions)
+		if err != nil {
+			test.Logf("Failed to read '%s' from JSON: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		fromBinary, err := NewEvaluableExpressionFromBinary(binary, definitions)
+		if err != nil {
+			test.Logf("Failed to read '%s' from binary: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		for _, stored := range []*EvaluableExpression{fromJSON, fromBinary} {
+
+			actual, actualErr := stored.Evaluate(parameters)
+
+			if !reflect.DeepEqual(actual, expected) || (actualErr == nil) != (expectedErr == nil) {
+				test.Logf("Stored '%s' evaluated to %v (%v), expected %v (%v)", input, actual, actualErr, expected, expectedErr)
+				test.Fail()
+			}
+
+			if stored.String() != expression.String() || describeNode(stored.AST()) != describeNode(expression.AST()) {
+				test.Logf("Stored '%s' doesn't match the original: '%s'", input, stored.String())
+				test.Fail()
+			}
+		}
+	}
+
+	// pure calls are still shared after being read back.
+	expression, _ := NewEvaluableExpressionWithDefinitions("double(x) + double(x)", definitions)
+	encoded, _ := json.Marshal(expression)
+	stored, _ := NewEvaluableExpressionFromJSON(encoded, definitions)
+
+	calls = 0
+	stored.Evaluate(parameters)
+
+	if calls != 1 {
+		test.Logf("Expected one call to a shared pure function, got %d", calls)
+		test.Fail()
+	}
+}
+
+func TestSerializationErrors(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"double": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return arguments[0], nil
+			},
+		},
+	}
+
+	expression, _ := NewEvaluableExpressionWithDefinitions("double(x) + 1", definitions)
+	encoded, _ := json.Marshal(expression)
+
+	_, err := NewEvaluableExpressionFromJSON(encoded, nil)
+	if err == nil || err.Error() != "Function 'double' is not defined" {
+		test.Logf("Expected an undefined function error, got: %v", err)
+		test.Fail()
+	}
+
+	corrupted := []string{
+		`{"version": 2, "tokens": []}`,
+		`{"version": 1, "tokens": [{"kind": "SOMETHING"}]}`,
+		`{"version": 1, "tokens": [], "plan": {"symbol": "PLUS", "right": {"symbol": "VALUE", "variable": "x"}}}`,
+		`{"version": 1, "tokens": [], "plan": {"symbol": "LITERAL", "value": {"type": "complex"}}}`,
+		`{"version": 1, "tokens": [], "plan": {"symbol": "UNHEARD_OF"}}`,
+	}
+
+	for _, data := range corrupted {
+
+		_, err = NewEvaluableExpressionFromJSON([]byte(data), definitions)
+		if err == nil {
+			test.Logf("Expected an error reading %s", data)
+			test.Fail()
+		}
+	}
+}
+
+type serializedConfig struct {
+	Name       string
+	Expression *EvaluableExpression
+}
+
+func TestTextSerialization(test *testing.T) {
+
+	RegisterFunction("negated", FunctionDefinition{
+		Function: func(arguments ...interface{}) (interface{}, error) {
+			return -arguments[0].(float32), nil
+		},
+	})
+
+	var config serializedConfig
+
+	err := json.Unmarshal([]byte(`{"Name": "test", "Expression": "negated(x) * 2"}`), &config)
+	if err != nil {
+		test.Fatalf("Failed to read config: %v", err)
+	}
+
+	result, err := config.Expression.Evaluate(map[string]interface{}{"x": 3})
+	if err != nil || result != float32(-6) {
+		test.Logf("Expected -6, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	text, err := config.Expression.MarshalText()
+	if err != nil || string(text) != "negated(x) * 2" {
+		test.Logf("Unexpected text '%s' (%v)", text, err)
+		test.Fail()
+	}
+
+	// the full form also reads back against registered functions.
+	encoded, err := json.Marshal(config)
+	if err != nil || !strings.Contains(string(encoded), `"function":"negated"`) {
+		test.Fatalf("Unexpected JSON %s (%v)", encoded, err)
+	}
+
+	var stored serializedConfig
+
+	err = json.Unmarshal(encoded, &stored)
+	if err != nil {
+		test.Fatalf("Failed to read stored config: %v", err)
+	}
+
+	result, err = stored.Expression.Evaluate(map[string]interface{}{"x": 3})
+	if err != nil || result != float32(-6) {
+		test.Logf("Expected -6 from the stored expression, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	err = stored.Expression.UnmarshalText([]byte("unregistered(x)"))
+	if err == nil {
+		test.Logf("Expected an error for an unregistered function")
+		test.Fail()
+	}
+}
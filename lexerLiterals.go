@@ -0,0 +1,268 @@
+package govaluate
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Reads the number which starts at the current position of the [stream]. Numbers may be written as:
+
+		12, 1.5, .5      decimals
+		1e-3, 2.5E6      decimals with an exponent
+		0x1F, 0b1010, 0o17  integers in hex, binary or octal
+		1_000_000        any of the above, with underscores between digits
+
+	Everything up to the next character which can't be part of a number is read, so that `12abc` is a single invalid number,
+	rather than a number followed by a name.
+*/
+func readNumber(stream *lexerStream) (float32, error) {
+
+	start := stream.position
+	base := findNumberBase(stream)
+
+	var previous rune
+
+	for stream.canRead() {
+
+		character := stream.source[stream.position]
+
+		// an exponent may have a sign, but a sign anywhere else is an operator.
+		exponentSign := base == 10 && (character == '+' || character == '-') && (previous == 'e' || previous == 'E')
+
+		if !exponentSign && !isNumberCharacter(character) {
+			break
+		}
+
+		previous = character
+		stream.position++
+	}
+
+	text := string(stream.source[start:stream.position])
+
+	if base != 10 {
+		return readInteger(stream, start, text[2:], base)
+	}
+
+	if !hasValidSeparators(text, isDecimalDigit) {
+		return 0, stream.errorFrom(start, "Digit separators must be between two digits, in '%s'", text)
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(text, "_", "", -1), 32)
+	if err != nil {
+		return 0, stream.errorFrom(start, "Unable to parse numeric value '%v' to float32", text)
+	}
+	return float32(value), nil
+}
+
+/*
+	Returns the base of the number at the current position of the [stream], from its prefix.
+*/
+func findNumberBase(stream *lexerStream) int {
+
+	if stream.position+1 >= stream.length || stream.source[stream.position] != '0' {
+		return 10
+	}
+
+	switch stream.source[stream.position+1] {
+	case 'x', 'X':
+		return 16
+	case 'b', 'B':
+		return 2
+	case 'o', 'O':
+		return 8
+	}
+	return 10
+}
+
+/*
+	Parses the [digits] of an integer in the given [base], which were written after its prefix.
+*/
+func readInteger(stream *lexerStream, start int, digits string, base int) (float32, error) {
+
+	var name string
+	var isBaseDigit func(rune) bool
+
+	switch base {
+	case 16:
+		name, isBaseDigit = "hex", isHexDigit
+	case 8:
+		name, isBaseDigit = "octal", isOctalDigit
+	default:
+		name, isBaseDigit = "binary", isBinaryDigit
+	}
+
+	text := string(stream.source[start:stream.position])
+
+	if digits == "" {
+		return 0, stream.errorFrom(start, "Unable to parse %s value '%s': malformed literal, with no digits after its prefix", name, text)
+	}
+
+	if !hasValidSeparators(digits, isBaseDigit) {
+		return 0, stream.errorFrom(start, "Digit separators must be between two digits, in '%s'", text)
+	}
+
+	value, err := strconv.ParseUint(strings.Replace(digits, "_", "", -1), base, 64)
+	if err != nil && err.(*strconv.NumError).Err == strconv.ErrRange {
+		return 0, stream.errorFrom(start, "Unable to parse %s value '%s': too large", name, text)
+	}
+	if err != nil {
+		return 0, stream.errorFrom(start, "Unable to parse %s value '%s': malformed literal", name, text)
+	}
+	return float32(value), nil
+}
+
+/*
+	Returns false if any underscore in [text] isn't between two characters which are digits, according to [isBaseDigit].
+*/
+func hasValidSeparators(text string, isBaseDigit func(rune) bool) bool {
+
+	characters := []rune(text)
+
+	for i, character := range characters {
+
+		if character != '_' {
+			continue
+		}
+
+		if i == 0 || i == len(characters)-1 || !isBaseDigit(characters[i-1]) || !isBaseDigit(characters[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	Reads the string literal which starts at [start], from the current position of the [stream], just after its opening quote.
+	Either kind of quote ends a string. These escapes are understood:
+
+		\n \t \r \a \b \f \v \0   control characters
+		\\ \' \"                  a backslash, or a quote
+		\xHH \uHHHH \UHHHHHHHH    the character with the given hex code point
+
+	Any other escape is an error, which points at the escape. The rest of the string is still read, so that lexing can carry on after it.
+*/
+func readString(stream *lexerStream, start int) (string, error) {
+
+	var buffer bytes.Buffer
+	var escapeError error
+
+	for stream.canRead() {
+
+		character := stream.readCharacter()
+
+		if !isNotQuote(character) {
+			return buffer.String(), escapeError
+		}
+
+		if character != '\\' {
+			buffer.WriteRune(character)
+			continue
+		}
+
+		escapeStart := stream.position - 1
+		if !stream.canRead() {
+			break
+		}
+
+		character = stream.readCharacter()
+
+		switch character {
+		case 'n':
+			buffer.WriteRune('\n')
+		case 't':
+			buffer.WriteRune('\t')
+		case 'r':
+			buffer.WriteRune('\r')
+		case 'a':
+			buffer.WriteRune('\a')
+		case 'b':
+			buffer.WriteRune('\b')
+		case 'f':
+			buffer.WriteRune('\f')
+		case 'v':
+			buffer.WriteRune('\v')
+		case '0':
+			buffer.WriteRune(0)
+		case '\\', '\'', '"':
+			buffer.WriteRune(character)
+
+		case 'x', 'u', 'U':
+			value, err := readCodePoint(stream, escapeStart, character)
+			if err != nil {
+				if escapeError == nil {
+					escapeError = err
+				}
+				continue
+			}
+			buffer.WriteRune(value)
+
+		default:
+			if escapeError == nil {
+				escapeError = stream.errorFrom(escapeStart, "Unknown escape sequence '\\%c' in string literal; use '\\\\' for a backslash", character)
+			}
+		}
+	}
+
+	return "", stream.errorFrom(start, "Unclosed string literal")
+}
+
+/*
+	Reads the hex digits of a code point escape, which started at [escapeStart] with the given [kind] of escape.
+*/
+func readCodePoint(stream *lexerStream, escapeStart int, kind rune) (rune, error) {
+
+	length := 2
+	switch kind {
+	case 'u':
+		length = 4
+	case 'U':
+		length = 8
+	}
+
+	end := stream.position + length
+	if end > stream.length {
+		end = stream.length
+	}
+
+	digits := string(stream.source[stream.position:end])
+
+	for _, digit := range digits {
+		if !isHexDigit(digit) {
+			return 0, stream.errorFrom(escapeStart, "Escape sequence '\\%c' must be followed by %d hex digits", kind, length)
+		}
+	}
+
+	if len(digits) < length {
+		return 0, stream.errorFrom(escapeStart, "Escape sequence '\\%c' must be followed by %d hex digits", kind, length)
+	}
+	stream.position = end
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return 0, stream.errorFrom(escapeStart, "Escape sequence '\\%c' must be followed by %d hex digits", kind, length)
+	}
+	if !utf8.ValidRune(rune(value)) {
+		return 0, stream.errorFrom(escapeStart, "Escape sequence '\\%c%s' is not a valid character", kind, digits)
+	}
+	return rune(value), nil
+}
+
+func isNumberCharacter(character rune) bool {
+	return unicode.IsDigit(character) || unicode.IsLetter(character) || character == '_' || character == '.'
+}
+
+func isDecimalDigit(character rune) bool {
+	return character >= '0' && character <= '9'
+}
+
+func isOctalDigit(character rune) bool {
+	return character >= '0' && character <= '7'
+}
+
+func isBinaryDigit(character rune) bool {
+	return character == '0' || character == '1'
+}
@@ -25,6 +25,7 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
 			PATTERN,
 			FUNCTION,
@@ -45,6 +46,7 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
 			PATTERN,
 			FUNCTION,
@@ -67,6 +69,7 @@ var validLexerStates = []lexerState{
 			MODIFIER,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
 			STRING,
 			PATTERN,
@@ -109,6 +112,21 @@ var validLexerStates = []lexerState{
 			SEPARATOR,
 		},
 	},
+	lexerState{
+
+		kind:       NULL,
+		isEOF:      true,
+		isNullable: true,
+		validNextKinds: []TokenKind{
+
+			MODIFIER,
+			COMPARATOR,
+			LOGICALOP,
+			CLAUSE_CLOSE,
+			TERNARY,
+			SEPARATOR,
+		},
+	},
 	lexerState{
 
 		kind:       STRING,
@@ -181,6 +199,7 @@ var validLexerStates = []lexerState{
 			ACCESSOR,
 			STRING,
 			BOOLEAN,
+			NULL,
 			CLAUSE,
 			CLAUSE_CLOSE,
 		},
@@ -195,6 +214,7 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
 			FUNCTION,
 			ACCESSOR,
@@ -215,6 +235,7 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
 			FUNCTION,
 			ACCESSOR,
@@ -233,6 +254,7 @@ var validLexerStates = []lexerState{
 
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			VARIABLE,
 			FUNCTION,
 			ACCESSOR,
@@ -251,6 +273,7 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			STRING,
 			TIME,
 			VARIABLE,
@@ -294,6 +317,7 @@ var validLexerStates = []lexerState{
 			PREFIX,
 			NUMERIC,
 			BOOLEAN,
+			NULL,
 			STRING,
 			TIME,
 			VARIABLE,
@@ -316,47 +340,75 @@ func (this lexerState) canTransitionTo(kind TokenKind) bool {
 	return false
 }
 
+/*
+	Checks that every token in [tokens] may follow the one before it, and that the last may end an expression.
+	Errors point at the token which can't follow, or for an expression which ends too soon, at its last token.
+*/
 func checkExpressionSyntax(tokens []ExpressionToken) error {
 
+	errs := findSyntaxErrors(tokens, nil)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+/*
+	Same as `checkExpressionSyntax`, but carries on past each error, and returns all of them in order.
+	A token which can't follow the one before is treated as though it could, so that one mistake isn't reported again for the tokens after it.
+
+	[restarts] holds the indices of tokens which follow text that couldn't be read, which may follow anything.
+	If it holds `len(tokens)`, the expression ended with such text, so isn't reported as ending too soon.
+*/
+func findSyntaxErrors(tokens []ExpressionToken, restarts map[int]bool) []error {
+
+	var ret []error
 	var state lexerState
 	var lastToken ExpressionToken
 	var err error
 
 	state = validLexerStates[0]
 
-	for _, token := range tokens {
+	for index, token := range tokens {
 
-		if !state.canTransitionTo(token.Kind) {
+		if !restarts[index] && !state.canTransitionTo(token.Kind) {
 
 			// call out a specific error for tokens looking like they want to be functions.
 			if lastToken.Kind == VARIABLE && token.Kind == CLAUSE {
-				return errors.New("Undefined function " + lastToken.Value.(string))
-			}
+				ret = append(ret, newParseError(lastToken.span, "Undefined function %s", lastToken.Value.(string)))
+			} else {
+				firstStateName := fmt.Sprintf("%s [%v]", state.kind.String(), lastToken.Value)
+				nextStateName := fmt.Sprintf("%s [%v]", token.Kind.String(), token.Value)
 
-			firstStateName := fmt.Sprintf("%s [%v]", state.kind.String(), lastToken.Value)
-			nextStateName := fmt.Sprintf("%s [%v]", token.Kind.String(), token.Value)
-
-			return errors.New("Cannot transition token types from " + firstStateName + " to " + nextStateName)
+				ret = append(ret, newParseError(token.span, "Cannot transition token types from %s to %s", firstStateName, nextStateName))
+			}
+		} else if isNullTest(lastToken) && token.Kind != NULL {
+			ret = append(ret, newParseError(token.span, "Comparator '%v' can only be followed by null", lastToken.Value))
 		}
 
 		state, err = getLexerStateForToken(token.Kind)
 		if err != nil {
-			return err
+			return append(ret, err)
 		}
 
 		if !state.isNullable && token.Value == nil {
-
-			errorMsg := fmt.Sprintf("Token kind '%v' cannot have a nil value", token.Kind.String())
-			return errors.New(errorMsg)
+			ret = append(ret, newParseError(token.span, "Token kind '%v' cannot have a nil value", token.Kind.String()))
 		}
 
 		lastToken = token
 	}
 
-	if !state.isEOF {
-		return errors.New("Unexpected end of expression")
+	if !state.isEOF && !restarts[len(tokens)] {
+		ret = append(ret, newParseError(lastToken.span, "Unexpected end of expression"))
 	}
-	return nil
+	return ret
+}
+
+/*
+	Returns whether or not the given [token] is `is` or `is not`, which only test whether a value is null.
+*/
+func isNullTest(token ExpressionToken) bool {
+	return token.Kind == COMPARATOR && (token.Value == "is" || token.Value == "is not")
 }
 
 func getLexerStateForToken(kind TokenKind) (lexerState, error) {
@@ -1,5 +1,10 @@
 package govaluate
 
+import (
+	"strings"
+	"unicode"
+)
+
 type lexerStream struct {
 	source   []rune
 	position int
@@ -34,6 +39,96 @@ func (this *lexerStream) rewind(amount int) {
 	this.position -= amount
 }
 
+/*
+	Returns the span from [start] to the current position, without any whitespace that was read past the end of a token.
+*/
+func (this lexerStream) spanFrom(start int) Span {
+
+	end := this.position
+	for end > start+1 && unicode.IsSpace(this.source[end-1]) {
+		end--
+	}
+	return Span{Start: start, End: end}
+}
+
+/*
+	Returns an error about the characters from [start] to the current position.
+*/
+func (this lexerStream) errorFrom(start int, format string, arguments ...interface{}) *ParseError {
+	return newParseError(this.spanFrom(start), format, arguments...)
+}
+
 func (this lexerStream) canRead() bool {
 	return this.position < this.length
 }
+
+/*
+	Returns whether or not a line comment (`//`) or a block comment (`/*`) starts at the current position.
+*/
+func (this lexerStream) atComment() bool {
+	return isCommentStart(this.source, this.position)
+}
+
+/*
+	Skips the comment which starts at the current position. A line comment ends at the end of its line, and a block comment once it's closed.
+	Returns an error if a block comment is never closed.
+*/
+func (this *lexerStream) skipComment() error {
+
+	start := this.position
+	block := this.source[start+1] == '*'
+	this.position += 2
+
+	for this.canRead() {
+
+		character := this.readCharacter()
+
+		if !block && character == '\n' {
+			return nil
+		}
+
+		if block && character == '*' && this.canRead() && this.source[this.position] == '/' {
+			this.position++
+			return nil
+		}
+	}
+
+	if block {
+		return newParseError(Span{Start: start, End: start + 2}, "Unclosed block comment")
+	}
+	return nil
+}
+
+/*
+	Reads the given [keyword], in lower or upper case, if it's the next word after any whitespace. Returns whether or not it was read.
+	Nothing is read if it wasn't.
+*/
+func (this *lexerStream) readKeyword(keyword string) bool {
+
+	position := this.position
+	for position < this.length && unicode.IsSpace(this.source[position]) {
+		position++
+	}
+
+	end := position + len([]rune(keyword))
+	if end > this.length {
+		return false
+	}
+
+	word := string(this.source[position:end])
+	if word != keyword && word != strings.ToUpper(keyword) {
+		return false
+	}
+
+	// the keyword must be a whole word, not the start of a longer name.
+	if end < this.length && isVariableName(this.source[end]) {
+		return false
+	}
+
+	this.position = end
+	return true
+}
+
+func isCommentStart(source []rune, index int) bool {
+	return index+1 < len(source) && source[index] == '/' && (source[index+1] == '/' || source[index+1] == '*')
+}
@@ -0,0 +1,203 @@
+package govaluate
+
+import (
+	"fmt"
+)
+
+/*
+	Limits bounds the resources that an expression may use, for expressions which come from untrusted sources.
+	The token and depth limits are enforced when the expression is parsed, the others every time it's evaluated.
+	A limit of zero means that there is no limit.
+*/
+type Limits struct {
+
+	/*
+		The maximum number of tokens in the expression.
+	*/
+	MaxTokens int
+
+	/*
+		The maximum depth of nested parenthesis, and of the planned stages.
+		A long chain of operators, like `a + b + c + d`, counts as deeply nested too, since each operator is applied to the result of the last.
+	*/
+	MaxDepth int
+
+	/*
+		The maximum number of bytes, in total, of all of the arrays computed during a single evaluation.
+		Arrays given as parameters don't count.
+	*/
+	MaxIntermediateBytes int64
+
+	/*
+		The maximum number of function calls during a single evaluation.
+	*/
+	MaxFunctionCalls int
+
+	/*
+		The maximum depth of calls to functions declared with `def`, which call each other or themselves.
+		Unlike the other limits, zero means the default of 100, since a function which recursed forever would crash the program.
+	*/
+	MaxCallDepth int
+}
+
+const defaultMaxCallDepth = 100
+
+/*
+	Identifies one of the limits in `Limits`.
+*/
+type LimitKind int
+
+const (
+	TokenLimit LimitKind = iota
+	DepthLimit
+	IntermediateBytesLimit
+	FunctionCallLimit
+	CallDepthLimit
+)
+
+/*
+	Returned when an expression goes over one of its limits, either when it's parsed or when it's evaluated.
+*/
+type LimitError struct {
+	Kind    LimitKind
+	Maximum int64
+}
+
+func (this *LimitError) Error() string {
+
+	switch this.Kind {
+	case TokenLimit:
+		return fmt.Sprintf("Expression has more than %d tokens", this.Maximum)
+	case DepthLimit:
+		return fmt.Sprintf("Expression is nested more than %d levels deep", this.Maximum)
+	case IntermediateBytesLimit:
+		return fmt.Sprintf("Expression computed more than %d bytes of arrays", this.Maximum)
+	case FunctionCallLimit:
+		return fmt.Sprintf("Expression made more than %d function calls", this.Maximum)
+	case CallDepthLimit:
+		return fmt.Sprintf("Expression made calls nested more than %d deep", this.Maximum)
+	}
+	return fmt.Sprintf("Expression exceeded a limit of %d", this.Maximum)
+}
+
+/*
+	Returns an error if there are more than [MaxTokens] of the given [tokens].
+	Tokens read from a string are counted as they're read instead, so that a huge expression isn't read any further.
+*/
+func (this Limits) checkTokens(tokens []ExpressionToken) error {
+
+	if this.MaxTokens > 0 && len(tokens) > this.MaxTokens {
+		return &LimitError{Kind: TokenLimit, Maximum: int64(this.MaxTokens)}
+	}
+	return nil
+}
+
+/*
+	Returns an error if the given [stage] is planned more than [MaxDepth] stages deep.
+*/
+func (this Limits) checkStageDepth(stage *evaluationStage) error {
+
+	if this.MaxDepth <= 0 || stage == nil {
+		return nil
+	}
+
+	if findStageDepth(stage, make(map[*evaluationStage]int)) > this.MaxDepth {
+		return &LimitError{Kind: DepthLimit, Maximum: int64(this.MaxDepth)}
+	}
+	return nil
+}
+
+/*
+	Shared stages are reached more than once, but their depth only needs to be found once.
+*/
+func findStageDepth(stage *evaluationStage, depths map[*evaluationStage]int) int {
+
+	if stage == nil {
+		return 0
+	}
+
+	depth, found := depths[stage]
+	if found {
+		return depth
+	}
+
+	depth = findStageDepth(stage.leftStage, depths)
+
+	right := findStageDepth(stage.rightStage, depths)
+	if right > depth {
+		depth = right
+	}
+
+	depths[stage] = depth + 1
+	return depth + 1
+}
+
+/*
+	Keeps count of the resources used by a single evaluation, against its limits,
+	along with the results of the pure calls it has made.
+*/
+type evaluationUsage struct {
+	limits Limits
+	bytes  int64
+	calls  int
+
+	remembered map[callKey]interface{}
+}
+
+/*
+	Counts an array of [length] elements, each [size] bytes, which is about to be computed.
+*/
+func (this *evaluationUsage) addArray(length int, size int64) error {
+
+	if this.limits.MaxIntermediateBytes <= 0 || length < 0 {
+		return nil
+	}
+
+	this.bytes += int64(length) * size
+	if this.bytes > this.limits.MaxIntermediateBytes {
+		return &LimitError{Kind: IntermediateBytesLimit, Maximum: this.limits.MaxIntermediateBytes}
+	}
+	return nil
+}
+
+/*
+	Counts a function call which is about to be made.
+*/
+func (this *evaluationUsage) addCall() error {
+
+	if this.limits.MaxFunctionCalls <= 0 {
+		return nil
+	}
+
+	this.calls++
+	if this.calls > this.limits.MaxFunctionCalls {
+		return &LimitError{Kind: FunctionCallLimit, Maximum: int64(this.limits.MaxFunctionCalls)}
+	}
+	return nil
+}
+
+/*
+	Returns the number of elements in the given array [value], and the size of each, or -1 if it's not an array.
+*/
+func findArrayLength(value interface{}) (int, int64) {
+
+	switch typed := value.(type) {
+	case []float32:
+		return len(typed), 4
+	case []bool:
+		return len(typed), 1
+	}
+	return -1, 0
+}
+
+/*
+	Returns the size of each element of an array computed by the operator for [symbol].
+*/
+func findElementSize(symbol OperatorSymbol) int64 {
+
+	switch symbol {
+	case EQ, NEQ, GT, LT, GTE, LTE, AND, OR, INVERT:
+		return 1
+	}
+	return 4
+}
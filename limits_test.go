@@ -0,0 +1,160 @@
+package govaluate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+/*
+	Represents a test of a single limit, which is expected to be broken either when parsing or when evaluating.
+*/
+type LimitTest struct {
+	Name       string
+	Input      string
+	Limits     Limits
+	Parameters map[string]interface{}
+	Kind       LimitKind
+	Exceeded   bool
+}
+
+func TestLimits(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"double": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+
+				values := arguments[0].([]float32)
+				ret := make([]float32, len(values))
+				for i, value := range values {
+					ret[i] = value * 2
+				}
+				return ret, nil
+			},
+		},
+	}
+
+	array := make([]float32, 100)
+
+	limitTests := []LimitTest{
+
+		LimitTest{
+			Name:     "Tokens",
+			Input:    "a + b + c",
+			Limits:   Limits{MaxTokens: 4},
+			Kind:     TokenLimit,
+			Exceeded: true,
+		},
+		LimitTest{
+			Name:   "Tokens within limit",
+			Input:  "a + b + c",
+			Limits: Limits{MaxTokens: 5},
+			Parameters: map[string]interface{}{
+				"a": 1, "b": 2, "c": 3,
+			},
+		},
+		LimitTest{
+			Name:     "Nested parenthesis",
+			Input:    "((((a))))",
+			Limits:   Limits{MaxDepth: 3},
+			Kind:     DepthLimit,
+			Exceeded: true,
+		},
+		LimitTest{
+			Name:     "Chained operators",
+			Input:    "a + b * c - d / e + f",
+			Limits:   Limits{MaxDepth: 3},
+			Kind:     DepthLimit,
+			Exceeded: true,
+		},
+		LimitTest{
+			Name:   "Depth within limit",
+			Input:  "(a + b) * (c + d)",
+			Limits: Limits{MaxDepth: 3},
+			Parameters: map[string]interface{}{
+				"a": 1, "b": 2, "c": 3, "d": 4,
+			},
+		},
+		LimitTest{
+			Name:     "Fused arrays",
+			Input:    "a * 2 + 1",
+			Limits:   Limits{MaxIntermediateBytes: 399},
+			Kind:     IntermediateBytesLimit,
+			Exceeded: true,
+			Parameters: map[string]interface{}{
+				"a": array,
+			},
+		},
+		LimitTest{
+			Name:   "Fused arrays within limit",
+			Input:  "a * 2 + 1 > 0",
+			Limits: Limits{MaxIntermediateBytes: 100},
+			Parameters: map[string]interface{}{
+				"a": array,
+			},
+		},
+		LimitTest{
+			Name:     "Unfused arrays",
+			Input:    "double(a) + double(a * 2)",
+			Limits:   Limits{MaxIntermediateBytes: 1000},
+			Kind:     IntermediateBytesLimit,
+			Exceeded: true,
+			Parameters: map[string]interface{}{
+				"a": array,
+			},
+		},
+		LimitTest{
+			Name:     "Function calls",
+			Input:    "double(a) + double(a * 2)",
+			Limits:   Limits{MaxFunctionCalls: 1},
+			Kind:     FunctionCallLimit,
+			Exceeded: true,
+			Parameters: map[string]interface{}{
+				"a": array,
+			},
+		},
+		LimitTest{
+			Name:   "Function calls within limit",
+			Input:  "double(a) + double(a * 2)",
+			Limits: Limits{MaxFunctionCalls: 2},
+			Parameters: map[string]interface{}{
+				"a": array,
+			},
+		},
+	}
+
+	for _, limitTest := range limitTests {
+
+		var limitError *LimitError
+
+		expression, err := NewEvaluableExpressionWithLimits(limitTest.Input, definitions, limitTest.Limits)
+		if err == nil {
+			_, err = expression.Evaluate(limitTest.Parameters)
+		}
+
+		if !limitTest.Exceeded {
+			if err != nil {
+				test.Logf("Test '%s' failed: %v", limitTest.Name, err)
+				test.Fail()
+			}
+			continue
+		}
+
+		if !errors.As(err, &limitError) || limitError.Kind != limitTest.Kind {
+			test.Logf("Test '%s' failed", limitTest.Name)
+			test.Logf("Expected a limit error of kind %d, got: %v", limitTest.Kind, err)
+			test.Fail()
+		}
+	}
+}
+
+func TestTokenLimitStopsReading(test *testing.T) {
+
+	input := strings.Repeat("a + ", 100000) + "a"
+
+	_, err := NewEvaluableExpressionWithLimits(input, nil, Limits{MaxTokens: 10})
+	if err == nil || err.Error() != "Expression has more than 10 tokens" {
+		test.Logf("Expected token limit error, got: %v", err)
+		test.Fail()
+	}
+}
@@ -2,16 +2,14 @@ package govaluate
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
+	"math"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 	"unicode"
 )
 
-func parseTokens(expression string, functions map[string]ExpressionFunction) ([]ExpressionToken, error) {
+func parseTokens(expression string, functions map[string]FunctionDefinition, macros *Macros, limits Limits) ([]ExpressionToken, error) {
 
 	var ret []ExpressionToken
 	var token ExpressionToken
@@ -19,6 +17,7 @@ func parseTokens(expression string, functions map[string]ExpressionFunction) ([]
 	var state lexerState
 	var err error
 	var found bool
+	var parens int
 
 	stream = newLexerStream(expression)
 	state = validLexerStates[0]
@@ -40,21 +39,34 @@ func parseTokens(expression string, functions map[string]ExpressionFunction) ([]
 			return ret, err
 		}
 
-		// append this valid token
-		ret = append(ret, token)
-	}
+		// append this valid token, or the tokens of the macro that it names.
+		ret, err = macros.expand(ret, token)
+		if err != nil {
+			return nil, err
+		}
 
-	err = checkBalance(ret)
-	if err != nil {
-		return nil, err
+		// limits are checked as soon as they're broken, so that a huge expression isn't read any further.
+		if limits.MaxTokens > 0 && len(ret) > limits.MaxTokens {
+			return nil, &LimitError{Kind: TokenLimit, Maximum: int64(limits.MaxTokens)}
+		}
+
+		switch token.Kind {
+		case CLAUSE:
+			parens++
+			if limits.MaxDepth > 0 && parens > limits.MaxDepth {
+				return nil, &LimitError{Kind: DepthLimit, Maximum: int64(limits.MaxDepth)}
+			}
+		case CLAUSE_CLOSE:
+			parens--
+		}
 	}
 
 	return ret, nil
 }
 
-func readToken(stream *lexerStream, state lexerState, functions map[string]ExpressionFunction) (ExpressionToken, error, bool) {
+func readToken(stream *lexerStream, state lexerState, functions map[string]FunctionDefinition) (ExpressionToken, error, bool) {
 
-	var function ExpressionFunction
+	var function FunctionDefinition
 	var ret ExpressionToken
 	var tokenValue interface{}
 	var tokenTime time.Time
@@ -63,6 +75,8 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 	var character rune
 	var found bool
 	var completed bool
+	var start int
+	var err error
 
 	// numeric is 0-9, or . or 0x followed by digits
 	// string starts with '
@@ -78,39 +92,30 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			continue
 		}
 
+		// comments are skipped, like whitespace.
+		stream.rewind(1)
+		if stream.atComment() {
+
+			err = stream.skipComment()
+			if err != nil {
+				return ExpressionToken{}, err, false
+			}
+			continue
+		}
+		stream.rewind(-1)
+
+		start = stream.position - 1
 		kind = UNKNOWN
 
 		// numeric constant
 		if isNumeric(character) {
 
-			if stream.canRead() && character == '0' {
-				character = stream.readCharacter()
-
-				if stream.canRead() && character == 'x' {
-					tokenString, _ = readUntilFalse(stream, false, true, true, isHexDigit)
-					tokenValueInt, err := strconv.ParseUint(tokenString, 16, 64)
-
-					if err != nil {
-						errorMsg := fmt.Sprintf("Unable to parse hex value '%v' to uint64\n", tokenString)
-						return ExpressionToken{}, errors.New(errorMsg), false
-					}
-
-					kind = NUMERIC
-					tokenValue = float32(tokenValueInt)
-					break
-				} else {
-					stream.rewind(1)
-				}
-			}
-
-			tokenString = readTokenUntilFalse(stream, isNumeric)
-			tokenValueTmp, err := strconv.ParseFloat(tokenString, 32)
-
+			stream.rewind(1)
+			tokenValue, err = readNumber(stream)
 			if err != nil {
-				errorMsg := fmt.Sprintf("Unable to parse numeric value '%v' to float64\n", tokenString)
-				return ExpressionToken{}, errors.New(errorMsg), false
+				return ExpressionToken{}, err, false
 			}
-			tokenValue = float32(tokenValueTmp)
+
 			kind = NUMERIC
 			break
 		}
@@ -130,7 +135,7 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			kind = VARIABLE
 
 			if !completed {
-				return ExpressionToken{}, errors.New("Unclosed parameter bracket"), false
+				return ExpressionToken{}, stream.errorFrom(start, "Unclosed parameter bracket"), false
 			}
 
 			// above method normally rewinds us to the closing bracket, which we want to skip.
@@ -160,7 +165,37 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 				}
 			}
 
+			// not-a-number, or infinity?
+			if tokenValue == "NaN" {
+
+				kind = NUMERIC
+				tokenValue = float32(math.NaN())
+			}
+			if tokenValue == "Inf" {
+
+				kind = NUMERIC
+				tokenValue = float32(math.Inf(1))
+			}
+
+			// null?
+			if tokenValue == "null" || tokenValue == "NULL" {
+
+				kind = NULL
+				tokenValue = nil
+			}
+
 			// textual operator?
+			if tokenValue == "is" || tokenValue == "IS" {
+
+				// force lower case for consistency
+				tokenValue = "is"
+				kind = COMPARATOR
+
+				_, found = functions[tokenString]
+				if !found && stream.readKeyword("not") {
+					tokenValue = "is not"
+				}
+			}
 			if tokenValue == "in" || tokenValue == "IN" {
 
 				// force lower case for consistency
@@ -172,7 +207,10 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			function, found = functions[tokenString]
 			if found {
 				kind = FUNCTION
-				tokenValue = function
+				tokenValue = findDefinedFunction(function)
+				ret.functionName = tokenString
+				ret.pure = function.Pure
+				ret.signature = findDefinedSignature(function)
 			}
 
 			// accessor?
@@ -181,8 +219,7 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 
 				// check that it doesn't end with a hanging period
 				if tokenString[len(tokenString)-1] == '.' {
-					errorMsg := fmt.Sprintf("Hanging accessor on token '%s'", tokenString)
-					return ExpressionToken{}, errors.New(errorMsg), false
+					return ExpressionToken{}, stream.errorFrom(start, "Hanging accessor on token '%s'", tokenString), false
 				}
 
 				kind = ACCESSOR
@@ -195,8 +232,7 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 					firstCharacter := getFirstRune(splits[i])
 
 					if unicode.ToUpper(firstCharacter) != firstCharacter {
-						errorMsg := fmt.Sprintf("Unable to access unexported field '%s' in token '%s'", splits[i], tokenString)
-						return ExpressionToken{}, errors.New(errorMsg), false
+						return ExpressionToken{}, stream.errorFrom(start, "Unable to access unexported field '%s' in token '%s'", splits[i], tokenString), false
 					}
 				}
 			}
@@ -204,14 +240,11 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 		}
 
 		if !isNotQuote(character) {
-			tokenValue, completed = readUntilFalse(stream, true, false, true, isNotQuote)
-
-			if !completed {
-				return ExpressionToken{}, errors.New("Unclosed string literal"), false
+			tokenString, err = readString(stream, start)
+			if err != nil {
+				return ExpressionToken{}, err, false
 			}
-
-			// advance the stream one position, since reading until false assumes the terminator is a real token
-			stream.rewind(-1)
+			tokenValue = tokenString
 
 			// check to see if this can be parsed as a time.
 			tokenTime, found = tryParseTime(tokenValue.(string))
@@ -238,6 +271,17 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 
 		// must be a known symbol
 		tokenString = readTokenUntilFalse(stream, isNotAlphanumeric)
+
+		// which ends where any comment right after it begins.
+		symbol := []rune(tokenString)
+		for i := 1; i < len(symbol); i++ {
+
+			if isCommentStart(symbol, i) {
+				stream.position = start + i
+				tokenString = string(symbol[:i])
+				break
+			}
+		}
 		tokenValue = tokenString
 
 		// quick hack for the case where "-" can mean "prefixed negation" or "minus", which are used
@@ -278,12 +322,12 @@ func readToken(stream *lexerStream, state lexerState, functions map[string]Expre
 			break
 		}
 
-		errorMessage := fmt.Sprintf("Invalid token: '%s'", tokenString)
-		return ret, errors.New(errorMessage), false
+		return ret, stream.errorFrom(start, "Invalid token: '%s'", tokenString), false
 	}
 
 	ret.Kind = kind
 	ret.Value = tokenValue
+	ret.span = stream.spanFrom(start)
 
 	return ret, nil, (kind != UNKNOWN)
 }
@@ -375,7 +419,7 @@ func optimizeTokens(tokens []ExpressionToken) ([]ExpressionToken, error) {
 			token.Value, err = regexp.Compile(token.Value.(string))
 
 			if err != nil {
-				return tokens, err
+				return tokens, newParseError(token.span, "%v", err)
 			}
 
 			tokens[index] = token
@@ -386,12 +430,27 @@ func optimizeTokens(tokens []ExpressionToken) ([]ExpressionToken, error) {
 
 /*
 	Checks the balance of tokens which have multiple parts, such as parenthesis.
+	The error points at the first closing parenthesis which has nothing to close, or else the last one which is never closed.
 */
 func checkBalance(tokens []ExpressionToken) error {
 
+	errs := findBalanceErrors(tokens)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+/*
+	Returns an error for every closing parenthesis which has nothing to close, followed by one for every parenthesis which is never closed,
+	from the last to the first.
+*/
+func findBalanceErrors(tokens []ExpressionToken) []error {
+
 	var stream *tokenStream
 	var token ExpressionToken
-	var parens int
+	var open []ExpressionToken
+	var errs []error
 
 	stream = newTokenStream(tokens)
 
@@ -399,19 +458,23 @@ func checkBalance(tokens []ExpressionToken) error {
 
 		token = stream.next()
 		if token.Kind == CLAUSE {
-			parens++
+			open = append(open, token)
 			continue
 		}
 		if token.Kind == CLAUSE_CLOSE {
-			parens--
+			if len(open) == 0 {
+				errs = append(errs, newParseError(token.span, "Unbalanced parenthesis"))
+				continue
+			}
+			open = open[:len(open)-1]
 			continue
 		}
 	}
 
-	if parens != 0 {
-		return errors.New("Unbalanced parenthesis")
+	for i := len(open) - 1; i >= 0; i-- {
+		errs = append(errs, newParseError(open[i].span, "Unbalanced parenthesis"))
 	}
-	return nil
+	return errs
 }
 
 func isDigit(character rune) bool {
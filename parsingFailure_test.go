@@ -19,6 +19,11 @@ const (
 	HANGING_ACCESSOR                = "Hanging accessor on token"
 	UNEXPORTED_ACCESSOR             = "Unable to access unexported"
 	INVALID_HEX                     = "Unable to parse hex value"
+	INVALID_BINARY                  = "Unable to parse binary value"
+	INVALID_SEPARATOR               = "Digit separators must be between two digits"
+	UNKNOWN_ESCAPE                  = "Unknown escape sequence"
+	SHORT_ESCAPE                    = "must be followed by"
+	NULL_TEST                       = "can only be followed by null"
 )
 
 /*
@@ -160,6 +165,12 @@ func TestParsingFailure(test *testing.T) {
 			Input:    "10 > (1 + 50",
 			Expected: UNBALANCED_PARENTHESIS,
 		},
+		ParsingFailureTest{
+
+			Name:     "Parenthesis closed before opening",
+			Input:    "1 ) + (2",
+			Expected: UNBALANCED_PARENTHESIS,
+		},
 		ParsingFailureTest{
 
 			Name:     "Multiple radix",
@@ -188,7 +199,7 @@ func TestParsingFailure(test *testing.T) {
 		ParsingFailureTest{
 			Name:     "Incomplete Hex",
 			Input:    "0x",
-			Expected: INVALID_TOKEN_TRANSITION,
+			Expected: INVALID_HEX + " '0x': malformed literal, with no digits after its prefix",
 		},
 		ParsingFailureTest{
 			Name:     "Invalid Hex literal",
@@ -198,12 +209,87 @@ func TestParsingFailure(test *testing.T) {
 		ParsingFailureTest{
 			Name:     "Hex float (Unsupported)",
 			Input:    "0x1.1",
-			Expected: INVALID_TOKEN_TRANSITION,
+			Expected: INVALID_HEX,
 		},
 		ParsingFailureTest{
 			Name:     "Hex invalid letter",
 			Input:    "0x12g1",
-			Expected: INVALID_TOKEN_TRANSITION,
+			Expected: INVALID_HEX + " '0x12g1': malformed literal",
+		},
+		ParsingFailureTest{
+			Name:     "Hex out of range",
+			Input:    "0x1_0000_0000_0000_0000",
+			Expected: INVALID_HEX + " '0x1_0000_0000_0000_0000': too large",
+		},
+		ParsingFailureTest{
+			Name:     "Binary invalid digit",
+			Input:    "0b102",
+			Expected: INVALID_BINARY,
+		},
+		ParsingFailureTest{
+			Name:     "Exponent without digits",
+			Input:    "1e+",
+			Expected: INVALID_NUMERIC,
+		},
+		ParsingFailureTest{
+			Name:     "Number out of range",
+			Input:    "1e39",
+			Expected: INVALID_NUMERIC + " '1e39' to float32",
+		},
+		ParsingFailureTest{
+			Name:     "Number followed by letters",
+			Input:    "12abc",
+			Expected: INVALID_NUMERIC,
+		},
+		ParsingFailureTest{
+			Name:     "Doubled digit separator",
+			Input:    "1__000",
+			Expected: INVALID_SEPARATOR,
+		},
+		ParsingFailureTest{
+			Name:     "Trailing digit separator",
+			Input:    "0xFF_",
+			Expected: INVALID_SEPARATOR,
+		},
+		ParsingFailureTest{
+			Name:     "Digit separator before a point",
+			Input:    "1_.5",
+			Expected: INVALID_SEPARATOR,
+		},
+		ParsingFailureTest{
+			Name:     "Unknown escape",
+			Input:    "'a\\qb'",
+			Expected: UNKNOWN_ESCAPE,
+		},
+		ParsingFailureTest{
+			Name:     "Short unicode escape",
+			Input:    "'\\u12'",
+			Expected: SHORT_ESCAPE,
+		},
+		ParsingFailureTest{
+			Name:     "Surrogate unicode escape",
+			Input:    "'\\ud800'",
+			Expected: "is not a valid character",
+		},
+		ParsingFailureTest{
+			Name:     "Is without null",
+			Input:    "x is 1",
+			Expected: NULL_TEST,
+		},
+		ParsingFailureTest{
+			Name:     "Is not with parenthesis",
+			Input:    "x is not (null)",
+			Expected: NULL_TEST,
+		},
+		ParsingFailureTest{
+			Name:     "Is with a name starting with not",
+			Input:    "x is nothing",
+			Expected: NULL_TEST,
+		},
+		ParsingFailureTest{
+			Name:     "Hanging is",
+			Input:    "x is not",
+			Expected: UNEXPECTED_END,
 		},
 	}
 
@@ -3,6 +3,7 @@ package govaluate
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
 	"testing"
 	"time"
@@ -1668,3 +1669,106 @@ func runTokenParsingTest(tokenParsingTests []TokenParsingTest, test *testing.T)
 func noop(arguments ...interface{}) (interface{}, error) {
 	return nil, nil
 }
+
+func TestLiteralParsing(test *testing.T) {
+
+	literalTests := []struct {
+		Input    string
+		Expected interface{}
+	}{
+		{"1e-3", float32(0.001)},
+		{"2.5E6", float32(2500000)},
+		{".5e1 + 1e+1", float32(15)},
+		{"0b1010", float32(10)},
+		{"0o17", float32(15)},
+		{"0X1f", float32(31)},
+		{"1_000_000", float32(1000000)},
+		{"0xFF_FF", float32(65535)},
+		{"2e3-1", float32(1999)},
+		{"Inf", float32(math.Inf(1))},
+		{"-Inf < 0", true},
+		{"NaN != NaN", true},
+		{"'a\\nb\\t\\'\\\\'", "a\nb\t'\\"},
+		{"'\\x41\\u00e9\\U0001F600'", "Aé😀"},
+		{"'é'", "é"},
+		{"\"it\\'s\\0\"", "it's\x00"},
+	}
+
+	for _, literalTest := range literalTests {
+
+		expression, err := NewEvaluableExpression(literalTest.Input)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", literalTest.Input, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := expression.Evaluate(nil)
+		if err != nil || result != literalTest.Expected {
+			test.Logf("Expected '%s' to be %#v, got %#v (%v)", literalTest.Input, literalTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+
+	// strings and special numbers are written back so that they read the same.
+	expression, err := NewEvaluableExpression("'a\\tb\\u0001' + NaN + -Inf")
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	formatted, err := Format(expression.AST())
+	if err != nil || formatted != "'a\\tb\\u0001' + NaN + -Inf" {
+		test.Logf("Unexpected formatting '%s' (%v)", formatted, err)
+		test.Fail()
+	}
+}
+
+func TestComments(test *testing.T) {
+
+	commentTests := []struct {
+		Input    string
+		Expected interface{}
+	}{
+		{"1 + // one\n2", float32(3)},
+		{"1 /* one */ + 2", float32(3)},
+		{"/* first */ 1 // last", float32(1)},
+		{"2 **/* squared */2", float32(4)},
+		{"4 //* a line comment */\n / 2", float32(2)},
+		{"1 /* over\nseveral\nlines */ + 1", float32(2)},
+		{"1 /*/ still a comment */ + 1", float32(2)},
+		{"'a // b /* c' + [d /* e */]", "a // b /* cx"},
+	}
+
+	parameters := map[string]interface{}{
+		"d /* e */": "x",
+	}
+
+	for _, commentTest := range commentTests {
+
+		expression, err := NewEvaluableExpression(commentTest.Input)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", commentTest.Input, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := expression.Evaluate(parameters)
+		if err != nil || result != commentTest.Expected {
+			test.Logf("Expected '%s' to be %v, got %v (%v)", commentTest.Input, commentTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+
+	// positions after comments still count every line.
+	_, err := NewEvaluableExpression("1 + /* one\ntwo */ 2 +\n// three\n* 3")
+	if err == nil || err.Error() != "Cannot transition token types from MODIFIER [+] to MODIFIER [*] (line 4, column 1)" {
+		test.Logf("Expected an error on line 4, got %v", err)
+		test.Fail()
+	}
+
+	_, err = NewEvaluableExpression("1 + /* never closed")
+	if err == nil || err.Error() != "Unclosed block comment (line 1, column 5)" {
+		test.Logf("Expected an unclosed comment, got %v", err)
+		test.Fail()
+	}
+}
@@ -1,9 +1,15 @@
 package govaluate
 
+import (
+	"context"
+)
+
 // sanitizedParameters is a wrapper for Parameters that does sanitization as
-// parameters are accessed.
+// parameters are accessed. It also carries the context of the evaluation
+// through to the stages which need it.
 type sanitizedParameters struct {
-	orig Parameters
+	orig    Parameters
+	context context.Context
 }
 
 func (p sanitizedParameters) Get(key string) (interface{}, error) {
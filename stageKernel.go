@@ -0,0 +1,934 @@
+package govaluate
+
+import (
+	"context"
+	"math"
+)
+
+/*
+	The kind of value held by a single kernel register.
+	Booleans are stored in the same float32 register file as numbers (as 1 or 0), so that every node in a kernel
+	can be addressed the same way.
+*/
+type kernelType int
+
+const (
+	kernelNumber kernelType = iota
+	kernelBool
+)
+
+/*
+	The number of elements computed by each instruction before moving on to the next instruction.
+	Small enough that every intermediate block stays in cache, large enough that the dispatch cost disappears.
+*/
+const kernelBlockSize = 512
+
+/*
+	A stageKernel represents a maximal subtree of element-wise operators (arithmetic, comparison, logical, prefix and ternary)
+	which can be computed in a single pass over the data, rather than materializing a whole array for every node.
+	The pass works through the arrays one small block at a time, computing every operator for that block before moving on,
+	so each intermediate value stays in cache and each output element is written exactly once.
+
+	Stages which can't be fused (parameters, literals, functions, accessors, and so on) become the "leaves" of the kernel.
+	They are evaluated once per `Eval`, and their values are fed into the loop.
+	If the kernel can't be used for a given set of leaf values, the same operators are applied one stage at a time instead.
+*/
+type stageKernel struct {
+
+	// every fused operator and leaf, in postfix order. The last node is the root of the kernel.
+	// an operator which is used more than once appears only once, and is referred to by every one of its parents.
+	nodes []kernelNode
+
+	// the non-fusable stages which provide values to the kernel, in the order that they must be evaluated.
+	leaves []*evaluationStage
+
+	// for each leaf, whether it's only used by the right operand of short-circuiting operators.
+	conditional []bool
+
+	// the short-circuiting operators whose right operand can be skipped for a whole block,
+	// keyed by the first node of that operand. Outer operators come first.
+	branches map[int][]int
+
+	// whether or not any node in this kernel needs the "nodata" parameter.
+	needsNoData bool
+
+	// while the kernel is being built, the node for each shared stage which has been fused.
+	shared map[*evaluationStage]int
+}
+
+type kernelNode struct {
+	stage *evaluationStage
+
+	// index into the kernel's leaves, or -1 if this node is an operator.
+	leaf int
+
+	// indexes into the kernel's nodes for the operands of this node, or -1 if there is no such operand.
+	left, right int
+
+	// the first node which was added along with this one. Every node from there up to this one is part of computing this one.
+	first int
+}
+
+/*
+	A single instruction, executed over one block of elements at a time.
+	[destination], [left] and [right] are all indexes into the register file.
+*/
+type kernelInstruction struct {
+	symbol      OperatorSymbol
+	destination int
+	left, right int
+
+	// only set for instructions which load an element from a leaf array.
+	numbers []float32
+	bools   []bool
+
+	// set for the check before the right operand of a short-circuiting operator, which is instruction [target].
+	// If [left] decides every element of the block, the operator's result is written to [destination] and execution skips to after [target].
+	branch bool
+	target int
+}
+
+/*
+	Returns true if the given [stage] performs an operation which can be computed one element at a time.
+	Short-circuiting operators are only fused if computing their right operand ahead of time is cheap,
+	since a kernel computes all of its leaves before it starts.
+*/
+func isFusableStage(stage *evaluationStage) bool {
+
+	if stage.isShortCircuitable() {
+		return stage.operator != nil && isCheapStage(stage.rightStage)
+	}
+	return isElementWiseStage(stage)
+}
+
+/*
+	Returns true if the given [stage] and all of its operands are parameters, literals, or element-wise operators.
+*/
+func isCheapStage(stage *evaluationStage) bool {
+
+	if stage == nil {
+		return true
+	}
+
+	switch stage.symbol {
+	case VALUE:
+		return stage.parameterName != ""
+	case LITERAL:
+		return true
+	}
+
+	return isElementWiseStage(stage) && isCheapStage(stage.leftStage) && isCheapStage(stage.rightStage)
+}
+
+func isElementWiseStage(stage *evaluationStage) bool {
+
+	switch stage.symbol {
+	case NOOP:
+		return stage.rightStage != nil
+	case PLUS, MINUS, MULTIPLY, DIVIDE, MODULUS, EXPONENT,
+		BITWISE_AND, BITWISE_OR, BITWISE_XOR, BITWISE_LSHIFT, BITWISE_RSHIFT,
+		EQ, NEQ, GT, LT, GTE, LTE,
+		AND, OR,
+		NEGATE, INVERT, BITWISE_NOT,
+		TERNARY_TRUE, TERNARY_FALSE, COALESCE:
+		return stage.operator != nil
+	}
+
+	return false
+}
+
+/*
+	Recurses through the entire stage tree, attaching a kernel to the root of every maximal fusable subtree.
+	A stage which is shared by more than one parent is computed once. It's fused only if all of its parents are in the same kernel,
+	otherwise it becomes a leaf of any kernel that uses it (and the root of its own kernel).
+*/
+func fuseStages(root *evaluationStage) {
+
+	if root == nil {
+		return
+	}
+
+	fuseStage(root, countStageReferences(root))
+}
+
+func fuseStage(root *evaluationStage, references map[*evaluationStage]int) {
+
+	var kernel *stageKernel
+
+	// shared stages may be reached more than once.
+	if root == nil || root.kernel != nil {
+		return
+	}
+
+	if !isFusableStage(root) || root.symbol == NOOP && !isFusableStage(root.rightStage) {
+
+		fuseStage(root.leftStage, references)
+		fuseStage(root.rightStage, references)
+		return
+	}
+
+	// a shared stage used from outside the kernel needs its own value, so it's made into a leaf and the kernel is built again.
+	forcedLeaves := make(map[*evaluationStage]bool)
+	for {
+
+		kernel = new(stageKernel)
+		kernel.shared = make(map[*evaluationStage]int)
+		kernel.addNode(root, references, forcedLeaves)
+
+		escaped := kernel.findEscapedStages(references)
+		if len(escaped) == 0 {
+			break
+		}
+
+		for _, stage := range escaped {
+			forcedLeaves[stage] = true
+		}
+	}
+
+	kernel.shared = nil
+
+	// a kernel made of nothing but parenthesis would only copy its input.
+	if kernel.hasOperators() {
+		kernel.findConditionalLeaves()
+		kernel.findBranches()
+		root.kernel = kernel
+	}
+
+	for _, leaf := range kernel.leaves {
+		fuseStage(leaf, references)
+	}
+}
+
+/*
+	Adds the given fusable [stage] and all of its operands to this kernel. Returns the index of the new node.
+*/
+func (this *stageKernel) addNode(stage *evaluationStage, references map[*evaluationStage]int, forcedLeaves map[*evaluationStage]bool) int {
+
+	var node kernelNode
+
+	node.stage = stage
+	node.leaf = -1
+	node.left = -1
+	node.right = -1
+	node.first = len(this.nodes)
+
+	if stage.leftStage != nil {
+		node.left = this.addOperand(stage.leftStage, references, forcedLeaves)
+	}
+	if stage.rightStage != nil {
+		node.right = this.addOperand(stage.rightStage, references, forcedLeaves)
+	}
+
+	switch stage.symbol {
+	case TERNARY_TRUE, TERNARY_FALSE, COALESCE:
+		this.needsNoData = true
+	}
+
+	this.nodes = append(this.nodes, node)
+	return len(this.nodes) - 1
+}
+
+/*
+	Adds the given operand [stage] to this kernel, either as another fused operator or as a leaf.
+	A stage which is used more than once is only added once, and every use refers to the same node.
+*/
+func (this *stageKernel) addOperand(stage *evaluationStage, references map[*evaluationStage]int, forcedLeaves map[*evaluationStage]bool) int {
+
+	if isFusableStage(stage) && !forcedLeaves[stage] {
+
+		if references[stage] <= 1 {
+			return this.addNode(stage, references, forcedLeaves)
+		}
+
+		index, found := this.shared[stage]
+		if !found {
+			index = this.addNode(stage, references, forcedLeaves)
+			this.shared[stage] = index
+		}
+		return index
+	}
+
+	node := kernelNode{
+		stage: stage,
+		leaf:  len(this.leaves),
+		left:  -1,
+		right: -1,
+		first: len(this.nodes),
+	}
+
+	for i, leaf := range this.leaves {
+		if leaf == stage {
+			node.leaf = i
+			break
+		}
+	}
+
+	if node.leaf == len(this.leaves) {
+		this.leaves = append(this.leaves, stage)
+	}
+
+	this.nodes = append(this.nodes, node)
+	return len(this.nodes) - 1
+}
+
+/*
+	Returns every shared operator in this kernel (other than the root) which is also used by a stage outside of this kernel.
+*/
+func (this *stageKernel) findEscapedStages(references map[*evaluationStage]int) []*evaluationStage {
+
+	var ret []*evaluationStage
+
+	uses := make(map[*evaluationStage]int)
+	for _, node := range this.nodes {
+
+		if node.left >= 0 {
+			uses[this.nodes[node.left].stage]++
+		}
+		if node.right >= 0 {
+			uses[this.nodes[node.right].stage]++
+		}
+	}
+
+	for stage, index := range this.shared {
+		if index != len(this.nodes)-1 && uses[stage] < references[stage] {
+			ret = append(ret, stage)
+		}
+	}
+	return ret
+}
+
+/*
+	Returns true if this kernel contains at least one operator other than parenthesis.
+*/
+func (this *stageKernel) hasOperators() bool {
+
+	for _, node := range this.nodes {
+		if node.leaf < 0 && node.stage.symbol != NOOP {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Returns true if this kernel contains a short-circuiting operator, which might not need its right operand.
+*/
+func (this *stageKernel) hasBranchingNodes() bool {
+
+	for _, node := range this.nodes {
+		if node.isBranching() {
+			return true
+		}
+	}
+	return false
+}
+
+func (this kernelNode) isBranching() bool {
+	return this.leaf < 0 && this.left >= 0 && this.right >= 0 && this.stage.isShortCircuitable()
+}
+
+/*
+	Finds the leaves which are only used by the right operands of short-circuiting operators, and so might not be needed at all.
+*/
+func (this *stageKernel) findConditionalLeaves() {
+
+	unconditional := make([]bool, len(this.leaves))
+	visited := make(map[int]bool)
+
+	this.visitConditionalLeaves(len(this.nodes)-1, false, unconditional, visited)
+
+	this.conditional = make([]bool, len(this.leaves))
+	for i := range this.leaves {
+		this.conditional[i] = !unconditional[i]
+	}
+}
+
+func (this *stageKernel) visitConditionalLeaves(index int, conditional bool, unconditional []bool, visited map[int]bool) {
+
+	// shared nodes are reached more than once, but only need to be walked once for each way they can be reached.
+	key := index * 2
+	if conditional {
+		key++
+	}
+
+	if visited[key] {
+		return
+	}
+	visited[key] = true
+
+	node := this.nodes[index]
+
+	if node.leaf >= 0 {
+		if !conditional {
+			unconditional[node.leaf] = true
+		}
+		return
+	}
+
+	if node.left >= 0 {
+		this.visitConditionalLeaves(node.left, conditional, unconditional, visited)
+	}
+	if node.right >= 0 {
+		this.visitConditionalLeaves(node.right, conditional || node.isBranching(), unconditional, visited)
+	}
+}
+
+/*
+	Finds the short-circuiting operators whose right operand can be skipped.
+	That's only possible when the right operand computes something, and nothing else in the kernel uses any part of it,
+	including the left operand.
+*/
+func (this *stageKernel) findBranches() {
+
+	this.branches = make(map[int][]int)
+
+	for index, node := range this.nodes {
+
+		if !node.isBranching() || this.nodes[node.right].leaf >= 0 {
+			continue
+		}
+
+		first := this.nodes[node.right].first
+		if !this.isUsedOnlyBy(first, node.right, index) {
+			continue
+		}
+
+		// the left operand is needed before the branch, so it can't be part of what's skipped (as it is when both operands are shared).
+		if node.left >= first && node.left <= node.right {
+			continue
+		}
+
+		// operators enclosing this one come later in postfix order, but need to check first.
+		this.branches[first] = append([]int{index}, this.branches[first]...)
+	}
+}
+
+/*
+	Returns true if the nodes from [first] to [last] are only used by each other, or (for [last]) by the node at [user].
+*/
+func (this *stageKernel) isUsedOnlyBy(first int, last int, user int) bool {
+
+	for index, node := range this.nodes {
+
+		if index >= first && index <= last {
+			continue
+		}
+
+		for _, operand := range []int{node.left, node.right} {
+
+			if operand < first || operand > last {
+				continue
+			}
+			if index != user || operand != last {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/*
+	Returns true if every leaf of this kernel comes before every operator (other than parenthesis), in postfix order,
+	and each leaf is used only once.
+*/
+func (this *stageKernel) leavesFirst() bool {
+
+	operatorFound := false
+	leaves := 0
+
+	for _, node := range this.nodes {
+
+		if node.leaf >= 0 {
+
+			// a leaf which is used more than once would need to be copied.
+			if operatorFound || node.leaf != leaves {
+				return false
+			}
+			leaves++
+			continue
+		}
+
+		if node.stage.symbol != NOOP {
+			operatorFound = true
+		}
+	}
+	return true
+}
+
+/*
+	Runs the fused loop over the given [leafValues], checking between blocks whether [ctx] is done.
+	The result is counted against the given [usage] before it's allocated.
+	Returns false if the kernel can't be used for these values, in which case the caller needs to evaluate stage-by-stage.
+	This happens when no leaf is an array, when a leaf is of an unsupported type, or when the types or array lengths
+	don't line up - the stage-by-stage path will produce the appropriate error for those.
+*/
+func (this *stageKernel) run(ctx context.Context, leafValues []interface{}, parameters Parameters, usage *evaluationUsage) (interface{}, bool, error) {
+
+	var instructions []kernelInstruction
+	var noData float32
+	var err error
+
+	if !containsKernelArray(leafValues) {
+		return nil, false, nil
+	}
+
+	length := -1
+	types := make([]kernelType, len(this.nodes))
+
+	// whether each node depends on an array, rather than being the same for every element.
+	arrays := make([]bool, len(this.nodes))
+
+	// the register which holds the result of each node. Usually the node itself, unless the node is a NOOP.
+	targets := make([]int, len(this.nodes))
+
+	// the position of the branch instruction for each short-circuiting operator which has one.
+	branchInstructions := make(map[int]int)
+
+	for i, node := range this.nodes {
+
+		targets[i] = i
+
+		for _, operator := range this.branches[i] {
+
+			branchInstructions[operator] = len(instructions)
+			instructions = append(instructions, kernelInstruction{
+				symbol:      this.nodes[operator].stage.symbol,
+				destination: operator,
+				left:        targets[this.nodes[operator].left],
+				branch:      true,
+			})
+		}
+
+		if node.leaf >= 0 {
+
+			switch value := leafValues[node.leaf].(type) {
+			case float32:
+				types[i] = kernelNumber
+			case bool:
+				types[i] = kernelBool
+			case []float32:
+				if length >= 0 && length != len(value) {
+					return nil, false, nil
+				}
+				length = len(value)
+				types[i] = kernelNumber
+				arrays[i] = true
+				instructions = append(instructions, kernelInstruction{symbol: VALUE, destination: i, numbers: value})
+			case []bool:
+				if length >= 0 && length != len(value) {
+					return nil, false, nil
+				}
+				length = len(value)
+				types[i] = kernelBool
+				arrays[i] = true
+				instructions = append(instructions, kernelInstruction{symbol: VALUE, destination: i, bools: value})
+			default:
+				return nil, false, nil
+			}
+			continue
+		}
+
+		resultType, ok := findKernelType(node, types)
+		if !ok {
+			return nil, false, nil
+		}
+		types[i] = resultType
+
+		if node.left >= 0 {
+			arrays[i] = arrays[node.left]
+		}
+		if node.right >= 0 {
+			arrays[i] = arrays[i] || arrays[node.right]
+		}
+
+		// a single value which decides a short-circuiting operator decides it for the whole result,
+		// which is then a single value too. Only the stage-by-stage code can find that out without computing the right operand.
+		if node.isBranching() && !arrays[node.left] {
+			return nil, false, nil
+		}
+
+		if node.stage.symbol == NOOP {
+			targets[i] = targets[node.right]
+			continue
+		}
+
+		instruction := kernelInstruction{
+			symbol:      node.stage.symbol,
+			destination: i,
+			left:        -1,
+			right:       -1,
+		}
+
+		if node.left >= 0 {
+			instruction.left = targets[node.left]
+		}
+		if node.right >= 0 {
+			instruction.right = targets[node.right]
+		}
+
+		branch, found := branchInstructions[i]
+		if found {
+			instructions[branch].target = len(instructions)
+		}
+
+		instructions = append(instructions, instruction)
+	}
+
+	if length < 0 {
+		return nil, false, nil
+	}
+
+	if this.needsNoData {
+		noData, err = getNoData(parameters)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	root := len(this.nodes) - 1
+	output := targets[root]
+	done := ctx.Done()
+	blockSize := kernelBlockSize
+	if length < blockSize {
+		blockSize = length
+	}
+
+	// scalar leaves are broadcast once, intermediate values get a block-sized buffer.
+	// numeric array leaves are read in-place, and need no buffer.
+	registers := make([][]float32, len(this.nodes))
+	for i, node := range this.nodes {
+
+		if targets[i] != i {
+			continue
+		}
+
+		if node.leaf < 0 {
+			registers[i] = make([]float32, blockSize)
+			continue
+		}
+
+		switch value := leafValues[node.leaf].(type) {
+		case float32:
+			registers[i] = makeKernelBlock(blockSize, value)
+		case bool:
+			registers[i] = makeKernelBlock(blockSize, kernelBoolValue(value))
+		case []bool:
+			registers[i] = make([]float32, blockSize)
+		}
+	}
+
+	if types[root] == kernelBool {
+
+		err = usage.addArray(length, 1)
+		if err != nil {
+			return nil, false, err
+		}
+
+		result := make([]bool, length)
+		for start := 0; start < length; start += blockSize {
+
+			end := start + blockSize
+			if end > length {
+				end = length
+			}
+
+			if done != nil && isDone(done) {
+				return nil, false, ctx.Err()
+			}
+
+			executeKernelInstructions(instructions, registers, start, end, noData)
+			for i, value := range registers[output][:end-start] {
+				result[start+i] = value != 0
+			}
+		}
+		return result, true, nil
+	}
+
+	err = usage.addArray(length, 4)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// numeric results are written by the root instruction straight into the output.
+	result := make([]float32, length)
+	for start := 0; start < length; start += blockSize {
+
+		end := start + blockSize
+		if end > length {
+			end = length
+		}
+
+		if done != nil && isDone(done) {
+			return nil, false, ctx.Err()
+		}
+
+		registers[output] = result[start:end]
+		executeKernelInstructions(instructions, registers, start, end, noData)
+	}
+	return result, true, nil
+}
+
+func containsKernelArray(values []interface{}) bool {
+
+	for _, value := range values {
+		switch value.(type) {
+		case []float32, []bool:
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Determines the type produced by the given operator [node], given the types of its operands.
+	Returns false if the stage-by-stage operator would refuse these types.
+*/
+func findKernelType(node kernelNode, types []kernelType) (kernelType, bool) {
+
+	var left, right kernelType
+
+	if node.left >= 0 {
+		left = types[node.left]
+	}
+	if node.right >= 0 {
+		right = types[node.right]
+	}
+
+	switch node.stage.symbol {
+	case NOOP:
+		return right, true
+
+	case PLUS, MINUS, MULTIPLY, DIVIDE, MODULUS, EXPONENT,
+		BITWISE_AND, BITWISE_OR, BITWISE_XOR, BITWISE_LSHIFT, BITWISE_RSHIFT,
+		TERNARY_FALSE, COALESCE:
+		return kernelNumber, left == kernelNumber && right == kernelNumber
+
+	case EQ, NEQ, GT, LT, GTE, LTE:
+		return kernelBool, left == kernelNumber && right == kernelNumber
+
+	case AND, OR:
+		return kernelBool, left == kernelBool && right == kernelBool
+
+	case NEGATE, BITWISE_NOT:
+		return kernelNumber, right == kernelNumber
+
+	case INVERT:
+		return kernelBool, right == kernelBool
+
+	case TERNARY_TRUE:
+		return kernelNumber, left == kernelBool && right == kernelNumber
+	}
+
+	return kernelNumber, false
+}
+
+/*
+	Computes every instruction for the elements from [start] up to (but not including) [end].
+	Each operator gives exactly what its stage operator would for the same elements; `TestOperatorImplementationsAgree` checks this.
+*/
+func executeKernelInstructions(instructions []kernelInstruction, registers [][]float32, start int, end int, noData float32) {
+
+	var left, right, destination []float32
+
+	count := end - start
+
+	for pc := 0; pc < len(instructions); pc++ {
+
+		instruction := &instructions[pc]
+
+		if instruction.branch {
+			if skipKernelOperand(instruction, registers, count, noData) {
+				pc = instruction.target
+			}
+			continue
+		}
+
+		if instruction.symbol == VALUE {
+
+			if instruction.numbers != nil {
+				registers[instruction.destination] = instruction.numbers[start:end]
+				continue
+			}
+
+			destination = registers[instruction.destination][:count]
+			for i, value := range instruction.bools[start:end] {
+				destination[i] = kernelBoolValue(value)
+			}
+			continue
+		}
+
+		destination = registers[instruction.destination][:count]
+		right = registers[instruction.right][:count]
+		if instruction.left >= 0 {
+			left = registers[instruction.left][:count]
+		}
+
+		switch instruction.symbol {
+		case PLUS:
+			for i := range destination {
+				destination[i] = left[i] + right[i]
+			}
+		case MINUS:
+			for i := range destination {
+				destination[i] = left[i] - right[i]
+			}
+		case MULTIPLY:
+			for i := range destination {
+				destination[i] = left[i] * right[i]
+			}
+		case DIVIDE:
+			for i := range destination {
+				destination[i] = left[i] / right[i]
+			}
+		case MODULUS:
+			for i := range destination {
+				destination[i] = float32(math.Mod(float64(left[i]), float64(right[i])))
+			}
+		case EXPONENT:
+			for i := range destination {
+				destination[i] = float32(math.Pow(float64(left[i]), float64(right[i])))
+			}
+		case BITWISE_AND:
+			for i := range destination {
+				destination[i] = float32(int64(left[i]) & int64(right[i]))
+			}
+		case BITWISE_OR:
+			for i := range destination {
+				destination[i] = float32(int64(left[i]) | int64(right[i]))
+			}
+		case BITWISE_XOR:
+			for i := range destination {
+				destination[i] = float32(int64(left[i]) ^ int64(right[i]))
+			}
+		case BITWISE_LSHIFT:
+			for i := range destination {
+				destination[i] = float32(uint64(left[i]) << uint64(right[i]))
+			}
+		case BITWISE_RSHIFT:
+			for i := range destination {
+				destination[i] = float32(uint64(left[i]) >> uint64(right[i]))
+			}
+		case EQ:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] == right[i])
+			}
+		case NEQ:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] != right[i])
+			}
+		case GT:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] > right[i])
+			}
+		case LT:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] < right[i])
+			}
+		case GTE:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] >= right[i])
+			}
+		case LTE:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] <= right[i])
+			}
+		case AND:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] != 0 && right[i] != 0)
+			}
+		case OR:
+			for i := range destination {
+				destination[i] = kernelBoolValue(left[i] != 0 || right[i] != 0)
+			}
+		case NEGATE:
+			for i := range destination {
+				destination[i] = -right[i]
+			}
+		case INVERT:
+			for i := range destination {
+				destination[i] = kernelBoolValue(right[i] == 0)
+			}
+		case BITWISE_NOT:
+			for i := range destination {
+				destination[i] = float32(^int64(right[i]))
+			}
+		case TERNARY_TRUE:
+			for i := range destination {
+				if left[i] != 0 {
+					destination[i] = right[i]
+				} else {
+					destination[i] = noData
+				}
+			}
+		case TERNARY_FALSE, COALESCE:
+			for i := range destination {
+				if left[i] == noData {
+					destination[i] = right[i]
+				} else {
+					destination[i] = left[i]
+				}
+			}
+		}
+	}
+}
+
+/*
+	Checks whether the left operand of the given short-circuiting [branch] decides every element of the block.
+	If so, writes the result of the operator for the block and returns true.
+*/
+func skipKernelOperand(branch *kernelInstruction, registers [][]float32, count int, noData float32) bool {
+
+	left := registers[branch.left][:count]
+	destination := registers[branch.destination][:count]
+
+	switch branch.symbol {
+
+	case AND, TERNARY_TRUE:
+		for _, value := range left {
+			if value != 0 {
+				return false
+			}
+		}
+
+	case OR:
+		for _, value := range left {
+			if value == 0 {
+				return false
+			}
+		}
+
+	case TERNARY_FALSE, COALESCE:
+		for _, value := range left {
+			if value == noData {
+				return false
+			}
+		}
+	}
+
+	if branch.symbol == TERNARY_TRUE {
+		for i := range destination {
+			destination[i] = noData
+		}
+		return true
+	}
+
+	copy(destination, left)
+	return true
+}
+
+func makeKernelBlock(size int, value float32) []float32 {
+
+	ret := make([]float32, size)
+	for i := range ret {
+		ret[i] = value
+	}
+	return ret
+}
+
+func kernelBoolValue(value bool) float32 {
+
+	if value {
+		return 1
+	}
+	return 0
+}
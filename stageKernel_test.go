@@ -0,0 +1,430 @@
+package govaluate
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+/*
+	Represents a test of an array expression, which is evaluated both with fused kernels and stage-by-stage.
+*/
+type KernelTest struct {
+	Name       string
+	Input      string
+	Functions  map[string]ExpressionFunction
+	Parameters map[string]interface{}
+	Expected   interface{}
+}
+
+func TestKernelEvaluation(test *testing.T) {
+
+	arrayFunctions := map[string]ExpressionFunction{
+		"double": func(arguments ...interface{}) (interface{}, error) {
+
+			values := arguments[0].([]float32)
+			ret := make([]float32, len(values))
+			for i, value := range values {
+				ret[i] = value * 2
+			}
+			return ret, nil
+		},
+	}
+
+	kernelTests := []KernelTest{
+
+		KernelTest{
+
+			Name:  "Normalized difference",
+			Input: "(nir - red) / (nir + red)",
+			Parameters: map[string]interface{}{
+				"nir": []float32{4, 6, 8},
+				"red": []float32{2, 2, 0},
+			},
+			Expected: []float32{1.0 / 3.0, 0.5, 1},
+		},
+		KernelTest{
+
+			Name:  "Scalar broadcast",
+			Input: "a * 2 + b ** 2 - 1",
+			Parameters: map[string]interface{}{
+				"a": []float32{1, 2, 3},
+				"b": float32(3),
+			},
+			Expected: []float32{10, 12, 14},
+		},
+		KernelTest{
+
+			Name:  "Integer parameters",
+			Input: "a % 3",
+			Parameters: map[string]interface{}{
+				"a": []int{4, 5, 6},
+			},
+			Expected: []float32{1, 2, 0},
+		},
+		KernelTest{
+
+			Name:  "Comparison and logic",
+			Input: "a > 1 && !(b == 0) || a == 0",
+			Parameters: map[string]interface{}{
+				"a": []float32{0, 1, 2, 3},
+				"b": []float32{1, 1, 1, 0},
+			},
+			Expected: []bool{true, false, true, false},
+		},
+		KernelTest{
+
+			Name:  "Bitwise",
+			Input: "~(a | 1) ^ (a & 6) << 1 >> 1",
+			Parameters: map[string]interface{}{
+				"a": []float32{0, 4, 7},
+			},
+			Expected: []float32{-2 ^ 0, -6 ^ 4, -8 ^ 6},
+		},
+		KernelTest{
+
+			Name:  "Ternary with nodata",
+			Input: "a > 1 ? a * 10 : -1",
+			Parameters: map[string]interface{}{
+				"a":      []float32{0, 2, 3},
+				"nodata": float32(-9999),
+			},
+			Expected: []float32{-1, 20, 30},
+		},
+		KernelTest{
+
+			Name:  "Coalesce",
+			Input: "a ?? b",
+			Parameters: map[string]interface{}{
+				"a":      []float32{-9999, 2},
+				"b":      []float32{5, 5},
+				"nodata": float32(-9999),
+			},
+			Expected: []float32{5, 2},
+		},
+		KernelTest{
+
+			Name:      "Function leaf",
+			Input:     "double(a) + a",
+			Functions: arrayFunctions,
+			Parameters: map[string]interface{}{
+				"a": []float32{1, 2},
+			},
+			Expected: []float32{3, 6},
+		},
+		KernelTest{
+
+			Name:      "Kernel inside function arguments",
+			Input:     "double(a + 1) - 1",
+			Functions: arrayFunctions,
+			Parameters: map[string]interface{}{
+				"a": []float32{1, 2},
+			},
+			Expected: []float32{3, 5},
+		},
+		KernelTest{
+
+			Name:  "Shared within kernel",
+			Input: "(a - b) / (a + b) > 0.3 ? (a - b) / (a + b) : 0",
+			Parameters: map[string]interface{}{
+				"a": []float32{4, 3, 8},
+				"b": []float32{2, 2, 0},
+			},
+			Expected: []float32{1.0 / 3.0, 0, 1},
+		},
+		KernelTest{
+
+			Name:      "Shared inside and outside kernel",
+			Input:     "double(a + 1) + (a + 1) * 2",
+			Functions: arrayFunctions,
+			Parameters: map[string]interface{}{
+				"a": []float32{1, 2},
+			},
+			Expected: []float32{8, 12},
+		},
+		KernelTest{
+
+			Name:  "Scalar only",
+			Input: "(a + 1) * 2",
+			Parameters: map[string]interface{}{
+				"a": float32(1),
+			},
+			Expected: float32(4),
+		},
+		KernelTest{
+
+			Name:  "String fallback",
+			Input: "a + 'b'",
+			Parameters: map[string]interface{}{
+				"a": "a",
+			},
+			Expected: "ab",
+		},
+	}
+
+	for _, kernelTest := range kernelTests {
+
+		expression, err := NewEvaluableExpressionWithFunctions(kernelTest.Input, kernelTest.Functions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: '%s'", kernelTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		fused, err := expression.Evaluate(kernelTest.Parameters)
+		if err != nil {
+			test.Logf("Test '%s' failed: %v", kernelTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		if !reflect.DeepEqual(fused, kernelTest.Expected) {
+			test.Logf("Test '%s' failed", kernelTest.Name)
+			test.Logf("Evaluation result '%v' does not match expected: '%v'", fused, kernelTest.Expected)
+			test.Fail()
+			continue
+		}
+
+		removeKernels(expression.evaluationStages)
+		expression.program = compileStages(expression.evaluationStages)
+
+		unfused, err := expression.Evaluate(kernelTest.Parameters)
+		if err != nil || !reflect.DeepEqual(fused, unfused) {
+			test.Logf("Test '%s' failed", kernelTest.Name)
+			test.Logf("Fused result '%v' does not match stage-by-stage result '%v' (%v)", fused, unfused, err)
+			test.Fail()
+		}
+	}
+}
+
+func TestKernelErrors(test *testing.T) {
+
+	expression, _ := NewEvaluableExpression("a + b * 2")
+
+	_, err := expression.Evaluate(map[string]interface{}{
+		"a": []float32{1, 2},
+		"b": []float32{1, 2, 3},
+	})
+
+	if err == nil || err.Error() != "different array sizes: 2, 3" {
+		test.Logf("Expected array size error, got: %v", err)
+		test.Fail()
+	}
+
+	expression, _ = NewEvaluableExpression("a > 0 ? a : 0")
+
+	_, err = expression.Evaluate(map[string]interface{}{
+		"a":      []float32{1, 2},
+		"nodata": "none",
+	})
+
+	if err == nil || err.Error() != "invalid nodata value: none" {
+		test.Logf("Expected nodata error, got: %v", err)
+		test.Fail()
+	}
+}
+
+/*
+	Tests that skipping the right operand of a short-circuiting operator for whole blocks gives the same results as computing it everywhere.
+	The first blocks of each array are decided by the left operand alone, the rest aren't.
+*/
+func TestKernelBranches(test *testing.T) {
+
+	inputs := []string{
+		"a > 0 ? a * 2 : -1",
+		"a > 0 && b * 2 > 1 || b < -1",
+		"a <= 0 || a - b > 1",
+		"(a - 1 > 0 ? a - 1 : b) ?? b * b",
+		"a > 0 ? (a + 1) * 2 : a + 1",
+
+		// identical operands are shared, so the left operand is the right one, and can't be skipped.
+		"a > 0 && a > 0",
+		"!(a > 0) || !(a > 0)",
+		"(!(b > 0) && !(b > 0)) ? 5 : -1",
+		"(a - 1) ?? (a - 1)",
+		"(1 % (b + 4)) ?? (1 % (b + 4))",
+		"(a > 0 ? a * 2) : (a > 0 ? a * 2)",
+	}
+
+	length := kernelBlockSize*3 + 7
+	a := make([]float32, length)
+	b := make([]float32, length)
+
+	for i := range a {
+		if i >= kernelBlockSize*2 {
+			a[i] = float32(i%5) - 2
+		} else {
+			a[i] = -1
+		}
+		b[i] = float32(i%7) - 3
+	}
+
+	parameters := map[string]interface{}{"a": a, "b": b, "nodata": float32(-1)}
+
+	for _, input := range inputs {
+
+		expression, _ := NewEvaluableExpression(input)
+
+		fused, err := expression.Evaluate(parameters)
+		if err != nil {
+			test.Logf("Expression '%s' failed: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		removeKernels(expression.evaluationStages)
+		expression.program = compileStages(expression.evaluationStages)
+
+		unfused, err := expression.Evaluate(parameters)
+		if err != nil || !reflect.DeepEqual(fused, unfused) {
+			test.Logf("Expression '%s' fused result does not match stage-by-stage result (%v)", input, err)
+			test.Fail()
+		}
+	}
+
+	expression, _ := NewEvaluableExpression(inputs[0])
+	if len(expression.evaluationStages.kernel.branches) != 1 {
+		test.Logf("Expected the right operand of the ternary to be skippable")
+		test.Fail()
+	}
+
+	expression, _ = NewEvaluableExpression(inputs[4])
+	if len(expression.evaluationStages.kernel.branches) != 0 {
+		test.Logf("Expected a right operand which is also used elsewhere not to be skippable")
+		test.Fail()
+	}
+}
+
+func removeKernels(stage *evaluationStage) {
+
+	if stage == nil {
+		return
+	}
+
+	stage.kernel = nil
+	removeKernels(stage.leftStage)
+	removeKernels(stage.rightStage)
+}
+
+/*
+	Tests that every operator which has its own arithmetic in fused kernels and in the typed program gives the same result
+	from those as from its stage operator, for every pair of values, including NaN, both zeroes and both infinities.
+	NaNs only need to be NaN, since their bits depend on how they were produced.
+*/
+func TestOperatorImplementationsAgree(test *testing.T) {
+
+	values := []float32{
+		0, float32(math.Copysign(0, -1)), 1, -2.5, 3, 1e30,
+		float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.NaN()),
+	}
+
+	inputs := []string{
+		"a + b", "a - b", "a * b", "a / b", "a % b", "a ** b",
+		"a & b", "a | b", "a ^ b", "a << b", "a >> b",
+		"a == b", "a != b", "a > b", "a < b", "a >= b", "a <= b",
+		"a ?? b", "-a + b", "~a + b",
+		"a > 0 && b > 0", "a > 0 || b > 0", "!(a > 0) && b > 0", "a > 0 ? b : a",
+	}
+
+	var lefts, rights []float32
+	for _, left := range values {
+		for _, right := range values {
+			lefts = append(lefts, left)
+			rights = append(rights, right)
+		}
+	}
+
+	for _, input := range inputs {
+
+		expression, err := NewEvaluableExpression(input)
+		if err != nil {
+			test.Logf("Expression '%s' failed to parse: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		fused, err := expression.Evaluate(map[string]interface{}{"a": lefts, "b": rights, "nodata": float32(-2.5)})
+		if err != nil {
+			test.Logf("Expression '%s' failed: %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		removeKernels(expression.evaluationStages)
+		expression.program = compileStages(expression.evaluationStages)
+
+		unfused, _ := expression.Evaluate(map[string]interface{}{"a": lefts, "b": rights, "nodata": float32(-2.5)})
+
+		for i := range lefts {
+
+			parameters := map[string]interface{}{"a": lefts[i], "b": rights[i], "nodata": float32(-2.5)}
+
+			typed, err := expression.Evaluate(parameters)
+			if err != nil {
+				test.Logf("Expression '%s' failed for %v and %v: %v", input, lefts[i], rights[i], err)
+				test.Fail()
+				continue
+			}
+
+			staged, _ := applyStageOperators(expression.evaluationStages, MapParameters(parameters))
+
+			for _, result := range []interface{}{staged, elementOf(fused, i), elementOf(unfused, i)} {
+
+				if !isSameResult(typed, result) {
+					test.Logf("Expression '%s' for %v and %v gives %v one way, and %v another", input, lefts[i], rights[i], typed, result)
+					test.Fail()
+				}
+			}
+		}
+	}
+}
+
+/*
+	Evaluates the given [stage] by calling the operator of every stage directly, without the typed program, or short-circuiting.
+*/
+func applyStageOperators(stage *evaluationStage, parameters Parameters) (interface{}, error) {
+
+	var left, right interface{}
+	var err error
+
+	if stage.leftStage != nil {
+		left, err = applyStageOperators(stage.leftStage, parameters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stage.rightStage != nil {
+		right, err = applyStageOperators(stage.rightStage, parameters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stage.operator(left, right, parameters)
+}
+
+func elementOf(values interface{}, index int) interface{} {
+
+	switch typed := values.(type) {
+	case []float32:
+		return typed[index]
+	case []bool:
+		return typed[index]
+	}
+	return nil
+}
+
+func isSameResult(left interface{}, right interface{}) bool {
+
+	leftNumber, isNumber := left.(float32)
+	rightNumber, _ := right.(float32)
+
+	if isNumber && math.IsNaN(float64(leftNumber)) {
+		return math.IsNaN(float64(rightNumber))
+	}
+	if isNumber {
+		return math.Float32bits(leftNumber) == math.Float32bits(rightNumber) && right != nil
+	}
+	return left == right
+}
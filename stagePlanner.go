@@ -1,7 +1,6 @@
 package govaluate
 
 import (
-	"errors"
 	"fmt"
 	"time"
 )
@@ -18,6 +17,8 @@ var stageSymbolMap = map[OperatorSymbol]evaluationOperator{
 	AND:            andStage,
 	OR:             orStage,
 	IN:             inStage,
+	IS:             isNullStage,
+	IS_NOT:         isNotNullStage,
 	BITWISE_OR:     bitwiseOrStage,
 	BITWISE_AND:    bitwiseAndStage,
 	BITWISE_XOR:    bitwiseXORStage,
@@ -191,7 +192,16 @@ func planStages(tokens []ExpressionToken) (*evaluationStage, error) {
 	// this could probably be avoided with a different planning method
 	reorderStages(stage)
 
-	stage = elideLiterals(stage)
+	// constants are folded, and operators which don't change their operand are removed.
+	stage = simplifyStages(stage)
+
+	markElseBranches(stage)
+
+	// identical subtrees are only evaluated once, which turns the tree into a DAG.
+	stage = eliminateCommonSubexpressions(stage)
+
+	// array operators are computed per-element in a single loop wherever possible.
+	fuseStages(stage)
 	return stage, nil
 }
 
@@ -282,6 +292,7 @@ func planPrecedenceLevel(
 			rightTypeCheck:  checks.right,
 			typeCheck:       checks.combined,
 			typeErrorFormat: typeErrorFormat,
+			token:           token,
 		}, nil
 	}
 
@@ -310,12 +321,20 @@ func planFunction(stream *tokenStream) (*evaluationStage, error) {
 		return nil, err
 	}
 
+	operator, found := makeCallStage(token.functionName, token.Value)
+	if !found {
+		return nil, newParseError(token.span, "Function '%s' has no function to call, only a %T", token.functionName, token.Value)
+	}
+
 	return &evaluationStage{
 
 		symbol:          FUNCTIONAL,
 		rightStage:      rightStage,
-		operator:        makeFunctionStage(token.Value.(ExpressionFunction)),
+		operator:        operator,
 		typeErrorFormat: "Unable to run function '%v': %v",
+		functionName:    token.functionName,
+		pure:            token.pure,
+		token:           token,
 	}, nil
 }
 
@@ -361,6 +380,8 @@ func planAccessor(stream *tokenStream) (*evaluationStage, error) {
 		rightStage:      rightStage,
 		operator:        makeAccessorStage(token.Value.([]string)),
 		typeErrorFormat: "Unable to access parameter field or method '%v': %v",
+		accessorPath:    token.Value.([]string),
+		token:           token,
 	}, nil
 }
 
@@ -374,6 +395,7 @@ func planValue(stream *tokenStream) (*evaluationStage, error) {
 	var symbol OperatorSymbol
 	var ret *evaluationStage
 	var operator evaluationOperator
+	var parameterName string
 	var err error
 
 	if !stream.hasNext() {
@@ -392,7 +414,7 @@ func planValue(stream *tokenStream) (*evaluationStage, error) {
 		}
 
 		// advance past the CLAUSE_CLOSE token. We know that it's a CLAUSE_CLOSE, because at parse-time we check for unbalanced parens.
-		stream.next()
+		token.span.End = stream.next().span.End
 
 		// the stage we got represents all of the logic contained within the parens
 		// but for technical reasons, we need to wrap this stage in a "noop" stage which breaks long chains of precedence.
@@ -401,6 +423,7 @@ func planValue(stream *tokenStream) (*evaluationStage, error) {
 			rightStage: ret,
 			operator:   noopStageRight,
 			symbol:     NOOP,
+			token:      token,
 		}
 
 		return ret, nil
@@ -413,7 +436,8 @@ func planValue(stream *tokenStream) (*evaluationStage, error) {
 		return nil, nil
 
 	case VARIABLE:
-		operator = makeParameterStage(token.Value.(string))
+		parameterName = token.Value.(string)
+		operator = makeParameterStage(parameterName)
 
 	case NUMERIC:
 		fallthrough
@@ -422,6 +446,8 @@ func planValue(stream *tokenStream) (*evaluationStage, error) {
 	case PATTERN:
 		fallthrough
 	case BOOLEAN:
+		fallthrough
+	case NULL:
 		symbol = LITERAL
 		operator = makeLiteralStage(token.Value)
 	case TIME:
@@ -434,13 +460,14 @@ func planValue(stream *tokenStream) (*evaluationStage, error) {
 	}
 
 	if operator == nil {
-		errorMsg := fmt.Sprintf("Unable to plan token kind: '%s', value: '%v'", token.Kind.String(), token.Value)
-		return nil, errors.New(errorMsg)
+		return nil, newParseError(token.span, "Unable to plan token kind: '%s', value: '%v'", token.Kind.String(), token.Value)
 	}
 
 	return &evaluationStage{
-		symbol:   symbol,
-		operator: operator,
+		symbol:        symbol,
+		operator:      operator,
+		parameterName: parameterName,
+		token:         token,
 	}, nil
 }
 
@@ -643,23 +670,7 @@ func mirrorStageSubtree(stages []*evaluationStage) {
 }
 
 /*
-	Recurses through all operators in the entire tree, eliding operators where both sides are literals.
-*/
-func elideLiterals(root *evaluationStage) *evaluationStage {
-
-	if root.leftStage != nil {
-		root.leftStage = elideLiterals(root.leftStage)
-	}
-
-	if root.rightStage != nil {
-		root.rightStage = elideLiterals(root.rightStage)
-	}
-
-	return elideStage(root)
-}
-
-/*
-	Elides a specific stage, if possible.
+	Elides a specific stage whose operands are all literals, if possible.
 	Returns the unmodified [root] stage if it cannot or should not be elided.
 	Otherwise, returns a new stage representing the condensed value from the elided stages.
 */
@@ -671,24 +682,43 @@ func elideStage(root *evaluationStage) *evaluationStage {
 	// right side must be a non-nil value. Left side must be nil or a value.
 	if root.rightStage == nil ||
 		root.rightStage.symbol != LITERAL ||
-		root.leftStage == nil ||
-		root.leftStage.symbol != LITERAL {
+		(root.leftStage != nil && root.leftStage.symbol != LITERAL) {
 		return root
 	}
 
-	// don't elide some operators
+	// don't elide some operators.
+	// ternaries and null tests depend on the "nodata" parameter, which isn't known until evaluation.
 	switch root.symbol {
 	case SEPARATE:
 		fallthrough
 	case IN:
+		fallthrough
+	case IS:
+		fallthrough
+	case IS_NOT:
+		fallthrough
+	case NOOP:
+		fallthrough
+	case FUNCTIONAL:
+		fallthrough
+	case ACCESS:
+		fallthrough
+	case TERNARY_TRUE:
+		fallthrough
+	case TERNARY_FALSE:
+		fallthrough
+	case COALESCE:
 		return root
 	}
 
 	// both sides are values, get their actual values.
 	// errors should be near-impossible here. If we encounter them, just abort this optimization.
-	leftValue, err = root.leftStage.operator(nil, nil, nil)
-	if err != nil {
-		return root
+	if root.leftStage != nil {
+
+		leftValue, err = root.leftStage.operator(nil, nil, nil)
+		if err != nil {
+			return root
+		}
 	}
 
 	rightValue, err = root.rightStage.operator(nil, nil, nil)
@@ -696,6 +726,20 @@ func elideStage(root *evaluationStage) *evaluationStage {
 		return root
 	}
 
+	// literals are never arrays, so an operator which propagates null just gives null.
+	// Other operators given null are left to evaluation, since some (like "==") depend on "nodata".
+	if hasNullOperand(root, leftValue, rightValue) {
+
+		if !propagatesNull(root.symbol) {
+			return root
+		}
+
+		return &evaluationStage{
+			symbol:   LITERAL,
+			operator: makeLiteralStage(nil),
+		}
+	}
+
 	// typcheck, since the grammar checker is a bit loose with which operator symbols go together.
 	err = typeCheck(root.leftTypeCheck, leftValue, root.symbol, root.typeErrorFormat)
 	if err != nil {
@@ -722,3 +766,124 @@ func elideStage(root *evaluationStage) *evaluationStage {
 		operator: makeLiteralStage(result),
 	}
 }
+
+/*
+	Marks every "?" whose result is given to a ":", so that a null which it selects is passed on as a branch which was taken,
+	instead of as "nodata" (which the ":" would replace).
+*/
+func markElseBranches(stage *evaluationStage) {
+
+	if stage == nil {
+		return
+	}
+
+	if stage.symbol == TERNARY_FALSE && stage.leftStage != nil && stage.leftStage.symbol == TERNARY_TRUE {
+		stage.leftStage.elseFollows = true
+	}
+
+	markElseBranches(stage.leftStage)
+	markElseBranches(stage.rightStage)
+}
+
+/*
+	Recurses through the entire tree, replacing every subtree which is identical to one seen earlier with that earlier subtree,
+	so that it's only evaluated once. Afterwards, a stage may have more than one parent.
+
+	Only subtrees without side effects are shared. Anything which uses an accessor (which may call a method),
+	or calls a function which isn't known to be pure, is left as-is.
+*/
+func eliminateCommonSubexpressions(root *evaluationStage) *evaluationStage {
+	return shareStage(root, make(map[string]*evaluationStage))
+}
+
+func shareStage(stage *evaluationStage, seen map[string]*evaluationStage) *evaluationStage {
+
+	if stage == nil {
+		return nil
+	}
+
+	stage.leftStage = shareStage(stage.leftStage, seen)
+	stage.rightStage = shareStage(stage.rightStage, seen)
+
+	key, shareable := findStageKey(stage)
+	if !shareable {
+		return stage
+	}
+
+	existing, found := seen[key]
+	if found {
+		return existing
+	}
+
+	seen[key] = stage
+	return stage
+}
+
+/*
+	Returns a key which is equal for any two stages which always compute the same value,
+	or false if the given [stage] can't be shared.
+	Since identical operands have already been shared by the time their parent is keyed, operands are compared by identity;
+	an operand which can't be shared is unique, and so is any parent of it.
+*/
+func findStageKey(stage *evaluationStage) (string, bool) {
+
+	var identity string
+
+	switch stage.symbol {
+
+	case LITERAL:
+		value, err := stage.operator(nil, nil, nil)
+		if err != nil {
+			return "", false
+		}
+		identity = fmt.Sprintf("%T:%v", value, value)
+
+	case VALUE:
+		if stage.parameterName == "" {
+			return "", false
+		}
+		identity = stage.parameterName
+
+	case FUNCTIONAL:
+		if !stage.pure || stage.functionName == "" {
+			return "", false
+		}
+		identity = stage.functionName
+
+	case ACCESS:
+		return "", false
+
+	default:
+		if stage.operator == nil {
+			return "", false
+		}
+		identity = fmt.Sprintf("%s:%v", stage.typeErrorFormat, stage.elseFollows)
+	}
+
+	return fmt.Sprintf("%d|%s|%p|%p", stage.symbol, identity, stage.leftStage, stage.rightStage), true
+}
+
+/*
+	Counts the parents of every stage in the given tree (or DAG, after `eliminateCommonSubexpressions`).
+*/
+func countStageReferences(root *evaluationStage) map[*evaluationStage]int {
+
+	references := make(map[*evaluationStage]int)
+	countChildReferences(root, references)
+	return references
+}
+
+func countChildReferences(stage *evaluationStage, references map[*evaluationStage]int) {
+
+	for _, child := range []*evaluationStage{stage.leftStage, stage.rightStage} {
+
+		if child == nil {
+			continue
+		}
+
+		references[child]++
+		if references[child] == 1 {
+			countChildReferences(child, references)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package govaluate
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+	Represents a test of common subexpression elimination, which checks how many times a function is actually called.
+*/
+type SharingTest struct {
+	Name          string
+	Input         string
+	Pure          bool
+	Parameters    map[string]interface{}
+	Expected      interface{}
+	ExpectedCalls int
+}
+
+func TestCommonSubexpressionElimination(test *testing.T) {
+
+	sharingTests := []SharingTest{
+
+		SharingTest{
+
+			Name:          "Pure function",
+			Input:         "(count(a) + 1) * (count(a) + 1) + count(a)",
+			Pure:          true,
+			Parameters:    map[string]interface{}{"a": 2},
+			Expected:      float32(11),
+			ExpectedCalls: 1,
+		},
+		SharingTest{
+
+			Name:          "Impure function",
+			Input:         "(count(a) + 1) * (count(a) + 1) + count(a)",
+			Parameters:    map[string]interface{}{"a": 2},
+			Expected:      float32(11),
+			ExpectedCalls: 3,
+		},
+		SharingTest{
+
+			Name:          "Different arguments",
+			Input:         "count(a) + count(b) + count(a)",
+			Pure:          true,
+			Parameters:    map[string]interface{}{"a": 1, "b": 2},
+			Expected:      float32(4),
+			ExpectedCalls: 2,
+		},
+		SharingTest{
+
+			Name:          "Different literals",
+			Input:         "count(1, a) + count(1.0, a) + count(2, a)",
+			Pure:          true,
+			Parameters:    map[string]interface{}{"a": 0},
+			Expected:      float32(4),
+			ExpectedCalls: 2,
+		},
+		SharingTest{
+
+			Name:  "Array arguments",
+			Input: "count(a) * 2 > 3 ? count(a) : 0",
+			Pure:  true,
+			Parameters: map[string]interface{}{
+				"a": []float32{1, 2},
+			},
+			Expected:      []float32{0, 2},
+			ExpectedCalls: 1,
+		},
+		SharingTest{
+
+			Name:          "Parenthesized",
+			Input:         "(count(a)) + count(a)",
+			Pure:          true,
+			Parameters:    map[string]interface{}{"a": 1},
+			Expected:      float32(2),
+			ExpectedCalls: 1,
+		},
+	}
+
+	for _, sharingTest := range sharingTests {
+
+		calls := 0
+		definitions := map[string]FunctionDefinition{
+			"count": FunctionDefinition{
+				Pure: sharingTest.Pure,
+				Function: func(arguments ...interface{}) (interface{}, error) {
+
+					calls++
+					switch argument := arguments[0].(type) {
+					case float32:
+						return argument, nil
+					case float64:
+						return float32(argument), nil
+					}
+					return arguments[0], nil
+				},
+			},
+		}
+
+		expression, err := NewEvaluableExpressionWithDefinitions(sharingTest.Input, definitions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: '%s'", sharingTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := expression.Evaluate(sharingTest.Parameters)
+		if err != nil {
+			test.Logf("Test '%s' failed: %v", sharingTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		if !reflect.DeepEqual(result, sharingTest.Expected) {
+			test.Logf("Test '%s' failed", sharingTest.Name)
+			test.Logf("Evaluation result '%v' does not match expected: '%v'", result, sharingTest.Expected)
+			test.Fail()
+		}
+
+		if calls != sharingTest.ExpectedCalls {
+			test.Logf("Test '%s' failed", sharingTest.Name)
+			test.Logf("Function was called %d times, expected %d", calls, sharingTest.ExpectedCalls)
+			test.Fail()
+		}
+	}
+}
+
+func TestSharedStagesAreReused(test *testing.T) {
+
+	expression, _ := NewEvaluableExpression("(a + b) * c + (a + b) * c")
+
+	root := expression.evaluationStages
+	if root.leftStage == nil || root.leftStage != root.rightStage {
+		test.Logf("Expected both operands of the root to be the same stage")
+		test.Fail()
+	}
+
+	result, err := expression.Evaluate(map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	if err != nil || result != float32(18) {
+		test.Logf("Expected '18', got '%v' (%v)", result, err)
+		test.Fail()
+	}
+}
+
+func TestSharedArgumentLists(test *testing.T) {
+
+	functions := map[string]ExpressionFunction{
+		"fourth": func(arguments ...interface{}) (interface{}, error) {
+			return arguments[3], nil
+		},
+	}
+
+	// both lists start with the same (shared) list of three arguments.
+	expression, _ := NewEvaluableExpressionWithFunctions("fourth((a, b, a, a), (a, b, a, b))", functions)
+
+	result, err := expression.Evaluate(map[string]interface{}{"a": 1, "b": 2})
+	if err != nil || result != float32(1) {
+		test.Logf("Expected '1', got '%v' (%v)", result, err)
+		test.Fail()
+	}
+}
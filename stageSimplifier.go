@@ -0,0 +1,398 @@
+package govaluate
+
+import (
+	"math"
+	"strings"
+)
+
+/*
+	The kind of value that a stage is known to produce (if it produces anything at all), before any parameters are known.
+	Numbers and bools include arrays of them, since every operator which accepts one also accepts the other.
+*/
+type stageKind int
+
+const (
+	unknownKind stageKind = iota
+	numberKind
+	boolKind
+	stringKind
+)
+
+/*
+	Recurses through the entire tree, simplifying every stage after its operands have been simplified.
+	Returns the new root of the tree.
+
+	Every simplification gives exactly the same result as the original stages, including the bits of any float
+	(such as the sign of a zero, or a NaN), and fails in the same way for operands of the wrong type.
+	Rewrites which would change either, like `x * 0` to `0` or `x + 1 + 2` to `x + 3`, are never made.
+*/
+func simplifyStages(root *evaluationStage) *evaluationStage {
+
+	if root.leftStage != nil {
+		root.leftStage = simplifyStages(root.leftStage)
+	}
+
+	if root.rightStage != nil {
+		root.rightStage = simplifyStages(root.rightStage)
+	}
+
+	return simplifyStage(root)
+}
+
+func simplifyStage(stage *evaluationStage) *evaluationStage {
+
+	// parenthesis only matter to the order of planning, and return exactly what they wrap.
+	if stage.symbol == NOOP && stage.rightStage != nil {
+		return stage.rightStage
+	}
+
+	folded := elideStage(stage)
+	if folded != stage {
+		return folded
+	}
+
+	folded = foldCall(stage)
+	if folded != stage {
+		return folded
+	}
+
+	reduced := reduceIdentity(stage)
+	if reduced != stage {
+		return reduced
+	}
+
+	stage = reassociateStage(stage)
+	reduceStrength(stage)
+	return stage
+}
+
+/*
+	Calls a pure function whose arguments are all literals, and returns a literal stage holding its result.
+	Returns the unmodified [stage] if it isn't such a call, or if the call fails or returns anything but a number, bool or string,
+	so that it's made (and fails) when the expression is evaluated instead.
+
+	Declared functions and evaluation functions aren't folded, since they can depend on the parameters of the expression that calls them,
+	such as "nodata".
+*/
+func foldCall(stage *evaluationStage) *evaluationStage {
+
+	if stage.symbol != FUNCTIONAL || !stage.pure || readsEvaluation(stage.token.Value) {
+		return stage
+	}
+
+	arguments, ok := findLiteralArguments(stage.rightStage)
+	if !ok {
+		return stage
+	}
+
+	result, err := stage.operator(nil, arguments, nil)
+	if err != nil {
+		return stage
+	}
+
+	switch result.(type) {
+	case float32, bool, string:
+	default:
+		return stage
+	}
+
+	return &evaluationStage{
+		symbol:   LITERAL,
+		operator: makeLiteralStage(result),
+	}
+}
+
+/*
+	Returns the arguments given by the [stage] which follows a function name, if they're all literals.
+*/
+func findLiteralArguments(stage *evaluationStage) (interface{}, bool) {
+
+	if stage == nil {
+		return nil, true
+	}
+
+	switch stage.symbol {
+
+	case LITERAL:
+		return literalStageValue(stage), true
+
+	// functions called with empty parenthesis.
+	case NOOP:
+		return nil, stage.rightStage == nil
+
+	case SEPARATE:
+
+		left, ok := findLiteralArguments(stage.leftStage)
+		if !ok || stage.leftStage == nil {
+			return nil, false
+		}
+
+		right, ok := findLiteralArguments(stage.rightStage)
+		if !ok || stage.rightStage == nil {
+			return nil, false
+		}
+
+		value, err := stage.operator(left, right, nil)
+		return value, err == nil
+	}
+	return nil, false
+}
+
+/*
+	Removes operators which return their other operand unchanged, like `x * 1` or `b && true`.
+	This only happens when the other operand is known to be of a type the operator accepts,
+	since otherwise the operator would have returned a type error.
+*/
+func reduceIdentity(stage *evaluationStage) *evaluationStage {
+
+	var operand *evaluationStage
+	var constant interface{}
+
+	switch {
+	case isLiteralStage(stage.rightStage) && stage.leftStage != nil:
+		operand = stage.leftStage
+		constant = literalStageValue(stage.rightStage)
+	case isLiteralStage(stage.leftStage) && stage.rightStage != nil && isCommutative(stage.symbol):
+		operand = stage.rightStage
+		constant = literalStageValue(stage.leftStage)
+	default:
+		return stage
+	}
+
+	switch stage.symbol {
+
+	case MULTIPLY, DIVIDE, EXPONENT:
+		if constant == float32(1) && findStageKind(operand) == numberKind {
+			return operand
+		}
+
+	// -0 + x and x - 0 are always x. x + 0 is not, since -0 + 0 is 0.
+	case PLUS:
+		if isNegativeZero(constant) && findStageKind(operand) == numberKind {
+			return operand
+		}
+	case MINUS:
+		if isPositiveZero(constant) && findStageKind(operand) == numberKind {
+			return operand
+		}
+
+	case AND:
+		if constant == true && findStageKind(operand) == boolKind {
+			return operand
+		}
+	case OR:
+		if constant == false && findStageKind(operand) == boolKind {
+			return operand
+		}
+	}
+
+	return stage
+}
+
+/*
+	Folds the constants of two nested multiplications together, like `x * 2 * 3` to `x * 6`.
+	Float multiplication isn't associative, so this is only done when the inner constant is a power of two no smaller than one
+	(which makes the inner multiplication exact) and the outer constant is no smaller than one (so that an overflow is still an overflow).
+*/
+func reassociateStage(stage *evaluationStage) *evaluationStage {
+
+	var inner *evaluationStage
+	var outer, constant float32
+	var ok bool
+
+	if stage.symbol != MULTIPLY {
+		return stage
+	}
+
+	switch {
+	case isLiteralStage(stage.rightStage):
+		inner = stage.leftStage
+		outer, ok = literalStageValue(stage.rightStage).(float32)
+	case isLiteralStage(stage.leftStage):
+		inner = stage.rightStage
+		outer, ok = literalStageValue(stage.leftStage).(float32)
+	}
+
+	if !ok || inner.symbol != MULTIPLY {
+		return stage
+	}
+
+	constantStage := inner.rightStage
+	if !isLiteralStage(constantStage) {
+		constantStage = inner.leftStage
+	}
+
+	if !isLiteralStage(constantStage) {
+		return stage
+	}
+
+	constant, ok = literalStageValue(constantStage).(float32)
+	if !ok {
+		return stage
+	}
+
+	mantissa, exponent := math.Frexp(float64(constant))
+	product := constant * outer
+
+	if math.Abs(mantissa) != 0.5 || exponent < 1 ||
+		math.Abs(float64(outer)) < 1 ||
+		math.IsInf(float64(product), 0) || math.IsNaN(float64(product)) {
+		return stage
+	}
+
+	constantStage.operator = makeLiteralStage(product)
+	return inner
+}
+
+/*
+	Replaces expensive operators with cheaper ones that give exactly the same result.
+	`x ** 2` becomes `x * x`, and `x ** -1` becomes `1 / x`. Both are exact, since the float64 result of math.Pow is correctly rounded
+	for these exponents, and rounding it to float32 gives the same result as the float32 operator would have.
+	The new stage still reports type errors the same way that the exponent did, and at the same place.
+*/
+func reduceStrength(stage *evaluationStage) {
+
+	if stage.symbol != EXPONENT || !isLiteralStage(stage.rightStage) || stage.leftStage == nil {
+		return
+	}
+
+	var replacement *evaluationStage
+
+	switch literalStageValue(stage.rightStage) {
+	case float32(2):
+		replacement = &evaluationStage{
+			symbol:     MULTIPLY,
+			leftStage:  stage.leftStage,
+			rightStage: stage.leftStage,
+		}
+	case float32(-1):
+		replacement = &evaluationStage{
+			symbol: DIVIDE,
+			leftStage: &evaluationStage{
+				symbol:   LITERAL,
+				operator: makeLiteralStage(float32(1)),
+			},
+			rightStage: stage.leftStage,
+		}
+	default:
+		return
+	}
+
+	checks := findTypeChecks(replacement.symbol)
+
+	replacement.operator = stageSymbolMap[replacement.symbol]
+	replacement.leftTypeCheck = checks.left
+	replacement.rightTypeCheck = checks.right
+	replacement.typeCheck = checks.combined
+	replacement.typeErrorFormat = nameErrorSymbol(stage.typeErrorFormat, stage.symbol)
+	replacement.token = stage.token
+
+	*stage = *replacement
+}
+
+/*
+	Type error formats take the offending value, followed by the symbol of the stage that rejected it.
+	This returns a format which always names the given [symbol] instead, for stages which replace an operator that the user wrote.
+	Explicit argument indexes stop fmt from complaining about the symbol argument which is no longer used.
+*/
+func nameErrorSymbol(format string, symbol OperatorSymbol) string {
+
+	parts := strings.SplitN(format, "%v", 3)
+	if len(parts) != 3 {
+		return format
+	}
+
+	return parts[0] + "%[1]v" + parts[1] + strings.Replace(symbol.String(), "%", "%%", -1) + parts[2]
+}
+
+/*
+	Determines what kind of value the given [stage] produces, if it succeeds.
+	A stage of any kind may produce null instead, which every operator with an identity gives back unchanged too.
+*/
+func findStageKind(stage *evaluationStage) stageKind {
+
+	switch stage.symbol {
+
+	case LITERAL:
+		switch literalStageValue(stage).(type) {
+		case float32:
+			return numberKind
+		case bool:
+			return boolKind
+		case string:
+			return stringKind
+		}
+		return unknownKind
+
+	case NOOP:
+		if stage.rightStage == nil {
+			return unknownKind
+		}
+		return findStageKind(stage.rightStage)
+
+	case PLUS:
+		left := findStageKind(stage.leftStage)
+		right := findStageKind(stage.rightStage)
+
+		if left == stringKind || right == stringKind {
+			return stringKind
+		}
+		if left == numberKind && right == numberKind {
+			return numberKind
+		}
+		return unknownKind
+
+	case MINUS, MULTIPLY, DIVIDE, MODULUS, EXPONENT,
+		BITWISE_AND, BITWISE_OR, BITWISE_XOR, BITWISE_LSHIFT, BITWISE_RSHIFT,
+		NEGATE, BITWISE_NOT,
+		TERNARY_TRUE:
+		return numberKind
+
+	// values other than numbers are never replaced, and a null one is replaced by whatever is on the right.
+	case TERNARY_FALSE, COALESCE:
+		if findStageKind(stage.leftStage) == numberKind && findStageKind(stage.rightStage) == numberKind {
+			return numberKind
+		}
+		return unknownKind
+
+	case EQ, NEQ, GT, LT, GTE, LTE, REQ, NREQ, IN, IS, IS_NOT,
+		AND, OR, INVERT:
+		return boolKind
+	}
+
+	return unknownKind
+}
+
+func isLiteralStage(stage *evaluationStage) bool {
+	return stage != nil && stage.symbol == LITERAL
+}
+
+/*
+	Literal stages never look at their operands or parameters, and never fail.
+*/
+func literalStageValue(stage *evaluationStage) interface{} {
+
+	value, _ := stage.operator(nil, nil, nil)
+	return value
+}
+
+func isCommutative(symbol OperatorSymbol) bool {
+
+	switch symbol {
+	case PLUS, MULTIPLY, AND, OR:
+		return true
+	}
+	return false
+}
+
+func isNegativeZero(value interface{}) bool {
+
+	number, ok := value.(float32)
+	return ok && number == 0 && math.Signbit(float64(number))
+}
+
+func isPositiveZero(value interface{}) bool {
+
+	number, ok := value.(float32)
+	return ok && number == 0 && !math.Signbit(float64(number))
+}
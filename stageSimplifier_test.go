@@ -0,0 +1,253 @@
+package govaluate
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+/*
+	Represents a test of the stage simplifier, which checks the symbol of the planned root stage
+	(and the value of that stage, if it's been folded into a literal).
+*/
+type SimplificationTest struct {
+	Name     string
+	Input    string
+	Symbol   OperatorSymbol
+	Expected interface{}
+}
+
+func TestStageSimplification(test *testing.T) {
+
+	simplificationTests := []SimplificationTest{
+
+		SimplificationTest{
+			Name:     "Parenthesized constant",
+			Input:    "(2 + 3)",
+			Symbol:   LITERAL,
+			Expected: float32(5),
+		},
+		SimplificationTest{
+			Name:     "Prefixed constant",
+			Input:    "-(2 * 3)",
+			Symbol:   LITERAL,
+			Expected: float32(-6),
+		},
+		SimplificationTest{
+			Name:   "Parenthesized variable",
+			Input:  "((x))",
+			Symbol: VALUE,
+		},
+		SimplificationTest{
+			Name:   "Folded through parenthesis",
+			Input:  "x * (2 + 3)",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Multiplicative identity",
+			Input:  "(x - y) * 1",
+			Symbol: MINUS,
+		},
+		SimplificationTest{
+			Name:   "Left multiplicative identity",
+			Input:  "1 * (x - y)",
+			Symbol: MINUS,
+		},
+		SimplificationTest{
+			Name:   "Division identity",
+			Input:  "(x - y) / 1",
+			Symbol: MINUS,
+		},
+		SimplificationTest{
+			Name:   "Subtractive identity",
+			Input:  "(x * y) - 0",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Exponent identity",
+			Input:  "-x ** 1",
+			Symbol: NEGATE,
+		},
+		SimplificationTest{
+			Name:   "Logical identities",
+			Input:  "(x > y && true) || false",
+			Symbol: GT,
+		},
+		SimplificationTest{
+			Name:   "Identity of unknown type",
+			Input:  "x * 1",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Addition of zero",
+			Input:  "(x - y) + 0",
+			Symbol: PLUS,
+		},
+		SimplificationTest{
+			Name:   "Multiplication by zero",
+			Input:  "(x - y) * 0",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Subtraction from zero",
+			Input:  "0 - (x - y)",
+			Symbol: MINUS,
+		},
+		SimplificationTest{
+			Name:   "Square",
+			Input:  "x ** 2",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Reciprocal",
+			Input:  "x ** -1",
+			Symbol: DIVIDE,
+		},
+		SimplificationTest{
+			Name:   "Other exponents",
+			Input:  "x ** 3",
+			Symbol: EXPONENT,
+		},
+		SimplificationTest{
+			Name:   "Product of variables by a constant",
+			Input:  "a * x * 2.5",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Constant by a product of variables",
+			Input:  "2.5 * (a * x)",
+			Symbol: MULTIPLY,
+		},
+		SimplificationTest{
+			Name:   "Ternary constants",
+			Input:  "true ? 1 : 2",
+			Symbol: TERNARY_FALSE,
+		},
+	}
+
+	for _, simplificationTest := range simplificationTests {
+
+		expression, err := NewEvaluableExpression(simplificationTest.Input)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: '%s'", simplificationTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		root := expression.evaluationStages
+		if root.symbol != simplificationTest.Symbol {
+			test.Logf("Test '%s' failed", simplificationTest.Name)
+			test.Logf("Planned root '%v' does not match expected: '%v'", root.symbol.String(), simplificationTest.Symbol.String())
+			test.Fail()
+			continue
+		}
+
+		if simplificationTest.Expected != nil {
+
+			value, _ := root.operator(nil, nil, nil)
+			if value != simplificationTest.Expected {
+				test.Logf("Test '%s' failed", simplificationTest.Name)
+				test.Logf("Folded value '%v' does not match expected: '%v'", value, simplificationTest.Expected)
+				test.Fail()
+			}
+		}
+	}
+}
+
+func TestReassociation(test *testing.T) {
+
+	expression, _ := NewEvaluableExpression("x * 2 * 3")
+
+	root := expression.evaluationStages
+	if root.symbol != MULTIPLY || root.leftStage.symbol != VALUE || literalStageValue(root.rightStage) != float32(6) {
+		test.Logf("Expected 'x * 2 * 3' to be planned as 'x * 6'")
+		test.Fail()
+	}
+
+	// none of these can be folded without changing the result for some x.
+	for _, input := range []string{"x * 3 * 2", "x * 2 * 0.5", "x + 1 + 2"} {
+
+		expression, _ = NewEvaluableExpression(input)
+
+		root = expression.evaluationStages
+		if root.leftStage.symbol == VALUE {
+			test.Logf("Expected '%s' not to be reassociated", input)
+			test.Fail()
+		}
+	}
+}
+
+/*
+	Compares every simplified expression against the same arithmetic done directly, bit-for-bit, over many floats.
+	The bits of a NaN aren't compared, only that it's a NaN.
+*/
+func TestSimplificationIsExact(test *testing.T) {
+
+	inputs := map[string]func(x float32) float32{
+		"x ** 2":        func(x float32) float32 { return float32(math.Pow(float64(x), 2)) },
+		"x ** -1":       func(x float32) float32 { return float32(math.Pow(float64(x), -1)) },
+		"x * 2 * 3":     func(x float32) float32 { return x * 2 * 3 },
+		"x * -4 * 1.5":  func(x float32) float32 { return x * -4 * 1.5 },
+		"(x - 0) * 1":   func(x float32) float32 { return (x - 0) * 1 },
+		"(x / 1) + -0":  func(x float32) float32 { return (x / 1) + float32(math.Copysign(0, -1)) },
+		"(x ** 1) ** 1": func(x float32) float32 { return float32(math.Pow(float64(float32(math.Pow(float64(x), 1))), 1)) },
+	}
+
+	values := []float32{
+		0, float32(math.Copysign(0, -1)), 1, -1, 3, 0.1, -7.5,
+		math.MaxFloat32, -math.MaxFloat32, math.SmallestNonzeroFloat32, -math.SmallestNonzeroFloat32,
+		float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.NaN()),
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		values = append(values, math.Float32frombits(random.Uint32()))
+	}
+
+	for input, reference := range inputs {
+
+		expression, _ := NewEvaluableExpression(input)
+
+		for _, value := range values {
+
+			result, err := expression.Evaluate(map[string]interface{}{"x": value})
+			if err != nil {
+				test.Logf("Expression '%s' failed: %v", input, err)
+				test.Fail()
+				break
+			}
+
+			expected := reference(value)
+			if math.Float32bits(result.(float32)) != math.Float32bits(expected) && !(isNaN32(expected) && isNaN32(result.(float32))) {
+				test.Logf("Expression '%s' with x = %v returned '%v', expected '%v'", input, value, result, expected)
+				test.Fail()
+				break
+			}
+		}
+	}
+}
+
+func TestSimplifiedTypeErrors(test *testing.T) {
+
+	expected := map[string]string{
+		"x ** 2":    "Value 'foo' cannot be used with the modifier '**', it is not a number",
+		"x ** -1":   "Value 'foo' cannot be used with the modifier '**', it is not a number",
+		"x * 1":     "Value 'foo' cannot be used with the modifier '*', it is not a number",
+		"x * 2 * 3": "Value 'foo' cannot be used with the modifier '*', it is not a number",
+	}
+
+	for input, message := range expected {
+
+		expression, _ := NewEvaluableExpression(input)
+
+		_, err := expression.Evaluate(map[string]interface{}{"x": "foo"})
+		if err == nil || err.Error() != message {
+			test.Logf("Expression '%s' returned error '%v', expected '%s'", input, err, message)
+			test.Fail()
+		}
+	}
+}
+
+func isNaN32(value float32) bool {
+	return value != value
+}
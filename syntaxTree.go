@@ -0,0 +1,773 @@
+package govaluate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+/*
+	A range of characters in an expression, from [Start] up to (but not including) [End].
+	Offsets count characters (runes), not bytes.
+*/
+type Span struct {
+	Start int
+	End   int
+}
+
+/*
+	Returns false for the empty span given to anything which wasn't parsed from an expression string.
+*/
+func (this Span) IsValid() bool {
+	return this.End > this.Start
+}
+
+/*
+	Returns the smallest span which covers both this span and the [other].
+	Invalid spans are ignored.
+*/
+func (this Span) union(other Span) Span {
+
+	if !this.IsValid() {
+		return other
+	}
+	if !other.IsValid() {
+		return this
+	}
+
+	if other.Start < this.Start {
+		this.Start = other.Start
+	}
+	if other.End > this.End {
+		this.End = other.End
+	}
+	return this
+}
+
+/*
+	A single node of an expression's syntax tree.
+	Nodes are immutable; a changed tree is built from new nodes, with the constructors below or with `Transform`.
+
+	The concrete types are *VariableNode, *LiteralNode, *UnaryNode, *BinaryNode, *TernaryNode, *CallNode, *AccessorNode and *ListNode.
+*/
+type Node interface {
+
+	/*
+		The part of the expression that this node was parsed from, not including any parenthesis around it.
+		Empty for nodes which were built rather than parsed.
+	*/
+	Span() Span
+
+	/*
+		The nodes directly beneath this one, in the order they appear in the expression.
+	*/
+	Children() []Node
+
+	// returns a node which is the same as this one, except that its children are replaced with [children].
+	withChildren(children []Node) Node
+}
+
+/*
+	Reads the parameter with the given name.
+*/
+type VariableNode struct {
+	name string
+	span Span
+}
+
+func NewVariableNode(name string) *VariableNode {
+	return &VariableNode{name: name}
+}
+
+func (this *VariableNode) Name() string {
+	return this.name
+}
+
+func (this *VariableNode) Span() Span {
+	return this.span
+}
+
+func (this *VariableNode) Children() []Node {
+	return nil
+}
+
+func (this *VariableNode) withChildren(children []Node) Node {
+	return this
+}
+
+/*
+	A constant value, which is a float32, bool, string, *regexp.Regexp (for the right side of a regex comparator) or time.Time.
+*/
+type LiteralNode struct {
+	value interface{}
+	span  Span
+}
+
+func NewLiteralNode(value interface{}) *LiteralNode {
+	return &LiteralNode{value: value}
+}
+
+func (this *LiteralNode) Value() interface{} {
+	return this.value
+}
+
+func (this *LiteralNode) Span() Span {
+	return this.span
+}
+
+func (this *LiteralNode) Children() []Node {
+	return nil
+}
+
+func (this *LiteralNode) withChildren(children []Node) Node {
+	return this
+}
+
+/*
+	A prefix operator (NEGATE, INVERT or BITWISE_NOT) applied to a single operand.
+*/
+type UnaryNode struct {
+	operator OperatorSymbol
+	operand  Node
+	span     Span
+}
+
+func NewUnaryNode(operator OperatorSymbol, operand Node) *UnaryNode {
+	return &UnaryNode{operator: operator, operand: operand}
+}
+
+func (this *UnaryNode) Operator() OperatorSymbol {
+	return this.operator
+}
+
+func (this *UnaryNode) Operand() Node {
+	return this.operand
+}
+
+func (this *UnaryNode) Span() Span {
+	return this.span
+}
+
+func (this *UnaryNode) Children() []Node {
+	return []Node{this.operand}
+}
+
+func (this *UnaryNode) withChildren(children []Node) Node {
+	return &UnaryNode{operator: this.operator, operand: children[0], span: this.span}
+}
+
+/*
+	An operator applied to two operands, including comparators, logical operators, `??`,
+	and a `:` which isn't part of a complete ternary.
+*/
+type BinaryNode struct {
+	operator    OperatorSymbol
+	left, right Node
+	span        Span
+}
+
+func NewBinaryNode(operator OperatorSymbol, left Node, right Node) *BinaryNode {
+	return &BinaryNode{operator: operator, left: left, right: right}
+}
+
+func (this *BinaryNode) Operator() OperatorSymbol {
+	return this.operator
+}
+
+func (this *BinaryNode) Left() Node {
+	return this.left
+}
+
+func (this *BinaryNode) Right() Node {
+	return this.right
+}
+
+func (this *BinaryNode) Span() Span {
+	return this.span
+}
+
+func (this *BinaryNode) Children() []Node {
+	return []Node{this.left, this.right}
+}
+
+func (this *BinaryNode) withChildren(children []Node) Node {
+	return &BinaryNode{operator: this.operator, left: children[0], right: children[1], span: this.span}
+}
+
+/*
+	A ternary, `condition ? whenTrue : whenFalse`. The false branch is nil if the ternary doesn't have one.
+*/
+type TernaryNode struct {
+	condition, whenTrue, whenFalse Node
+	span                           Span
+}
+
+func NewTernaryNode(condition Node, whenTrue Node, whenFalse Node) *TernaryNode {
+	return &TernaryNode{condition: condition, whenTrue: whenTrue, whenFalse: whenFalse}
+}
+
+func (this *TernaryNode) Condition() Node {
+	return this.condition
+}
+
+func (this *TernaryNode) True() Node {
+	return this.whenTrue
+}
+
+func (this *TernaryNode) False() Node {
+	return this.whenFalse
+}
+
+func (this *TernaryNode) Span() Span {
+	return this.span
+}
+
+func (this *TernaryNode) Children() []Node {
+
+	if this.whenFalse == nil {
+		return []Node{this.condition, this.whenTrue}
+	}
+	return []Node{this.condition, this.whenTrue, this.whenFalse}
+}
+
+func (this *TernaryNode) withChildren(children []Node) Node {
+
+	ret := &TernaryNode{condition: children[0], whenTrue: children[1], span: this.span}
+	if len(children) > 2 {
+		ret.whenFalse = children[2]
+	}
+	return ret
+}
+
+/*
+	A call to a user-defined function.
+*/
+type CallNode struct {
+	name      string
+	function  FunctionDefinition
+	arguments []Node
+	span      Span
+}
+
+func NewCallNode(name string, function FunctionDefinition, arguments ...Node) *CallNode {
+	return &CallNode{name: name, function: function, arguments: copyNodes(arguments)}
+}
+
+func (this *CallNode) Name() string {
+	return this.name
+}
+
+func (this *CallNode) Function() FunctionDefinition {
+	return this.function
+}
+
+func (this *CallNode) Arguments() []Node {
+	return copyNodes(this.arguments)
+}
+
+func (this *CallNode) Span() Span {
+	return this.span
+}
+
+func (this *CallNode) Children() []Node {
+	return copyNodes(this.arguments)
+}
+
+func (this *CallNode) withChildren(children []Node) Node {
+	return &CallNode{name: this.name, function: this.function, arguments: children, span: this.span}
+}
+
+/*
+	Accesses the fields or methods of a parameter, such as `foo.Bar.Baz()`.
+	Any arguments are given to every method along the path.
+*/
+type AccessorNode struct {
+	variable  string
+	path      []string
+	arguments []Node
+	span      Span
+}
+
+func NewAccessorNode(variable string, path []string, arguments ...Node) *AccessorNode {
+
+	return &AccessorNode{
+		variable:  variable,
+		path:      append([]string(nil), path...),
+		arguments: copyNodes(arguments),
+	}
+}
+
+/*
+	The name of the parameter being accessed.
+*/
+func (this *AccessorNode) Variable() string {
+	return this.variable
+}
+
+/*
+	The names of each field or method after the parameter.
+*/
+func (this *AccessorNode) Path() []string {
+	return append([]string(nil), this.path...)
+}
+
+func (this *AccessorNode) Arguments() []Node {
+	return copyNodes(this.arguments)
+}
+
+func (this *AccessorNode) Span() Span {
+	return this.span
+}
+
+func (this *AccessorNode) Children() []Node {
+	return copyNodes(this.arguments)
+}
+
+func (this *AccessorNode) withChildren(children []Node) Node {
+	return &AccessorNode{variable: this.variable, path: this.path, arguments: children, span: this.span}
+}
+
+/*
+	A comma-separated list, such as the right side of `in`.
+*/
+type ListNode struct {
+	elements []Node
+	span     Span
+}
+
+func NewListNode(elements ...Node) *ListNode {
+	return &ListNode{elements: copyNodes(elements)}
+}
+
+func (this *ListNode) Elements() []Node {
+	return copyNodes(this.elements)
+}
+
+func (this *ListNode) Span() Span {
+	return this.span
+}
+
+func (this *ListNode) Children() []Node {
+	return copyNodes(this.elements)
+}
+
+func (this *ListNode) withChildren(children []Node) Node {
+	return &ListNode{elements: children, span: this.span}
+}
+
+func copyNodes(nodes []Node) []Node {
+
+	if len(nodes) == 0 {
+		return nil
+	}
+	return append([]Node(nil), nodes...)
+}
+
+/*
+	Visits nodes during a `Walk`. If `Visit` returns a non-nil visitor, that visitor visits each of the node's children,
+	and is then called with nil.
+*/
+type Visitor interface {
+	Visit(node Node) Visitor
+}
+
+/*
+	Traverses a syntax tree in depth-first order, starting with [node].
+*/
+func Walk(visitor Visitor, node Node) {
+
+	visitor = visitor.Visit(node)
+	if visitor == nil {
+		return
+	}
+
+	for _, child := range node.Children() {
+		Walk(visitor, child)
+	}
+	visitor.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (this inspector) Visit(node Node) Visitor {
+
+	if this(node) {
+		return this
+	}
+	return nil
+}
+
+/*
+	Traverses a syntax tree in depth-first order, calling [visit] for each node.
+	If [visit] returns true, the node's children are visited next, followed by a call with nil.
+*/
+func Inspect(node Node, visit func(Node) bool) {
+	Walk(inspector(visit), node)
+}
+
+/*
+	Builds a new syntax tree by calling [transform] on every node, children first.
+	Each node is given to [transform] with its children already transformed, and is replaced by whatever it returns.
+	Nodes which aren't changed are reused.
+*/
+func Transform(node Node, transform func(Node) Node) Node {
+
+	children := node.Children()
+	changed := false
+
+	for i, child := range children {
+
+		transformed := Transform(child, transform)
+		if transformed != child {
+			children[i] = transformed
+			changed = true
+		}
+	}
+
+	if changed {
+		node = node.withChildren(children)
+	}
+	return transform(node)
+}
+
+/*
+	Returns the syntax tree of this expression, or nil if it's empty.
+	The tree follows the expression as written, before it's simplified for evaluation, except that parenthesis aren't kept
+	(the tree's structure already shows what they grouped).
+*/
+func (this EvaluableExpression) AST() Node {
+
+	if len(this.tokens) == 0 {
+		return nil
+	}
+
+	// the stages used for evaluation have been simplified, so the tokens are planned again.
+	stage, err := planTokens(newTokenStream(this.tokens))
+	if err != nil || stage == nil {
+		return nil
+	}
+	reorderStages(stage)
+
+	node, _ := buildNode(stage)
+	return node
+}
+
+/*
+	Builds the node for the given [stage].
+	Also returns the span of the whole stage, which (unlike the node) includes any parenthesis around it.
+*/
+func buildNode(stage *evaluationStage) (Node, Span) {
+
+	var left, right Node
+	var leftSpan, rightSpan Span
+
+	if stage.leftStage != nil {
+		left, leftSpan = buildNode(stage.leftStage)
+	}
+	if stage.rightStage != nil {
+		right, rightSpan = buildNode(stage.rightStage)
+	}
+
+	span := stage.token.span.union(leftSpan).union(rightSpan)
+
+	switch stage.symbol {
+
+	case NOOP:
+		return right, span
+
+	case VALUE:
+		return &VariableNode{name: stage.parameterName, span: span}, span
+
+	case LITERAL:
+		// time literals are planned as numbers, so the original value comes from the token.
+		value := stage.token.Value
+		if stage.token.Kind == UNKNOWN {
+			value = literalStageValue(stage)
+		}
+		return &LiteralNode{value: value, span: span}, span
+
+	case FUNCTIONAL:
+
+		function := FunctionDefinition{Pure: stage.pure, signature: stage.token.signature}
+		if stage.token.signature != nil {
+			function.Signature = stage.token.signature.declared
+		}
+
+		switch typed := stage.token.Value.(type) {
+		case ContextExpressionFunction:
+			function.ContextFunction = typed
+		case EvaluationExpressionFunction:
+			function.EvaluationFunction = typed
+		case *declaredFunction:
+			function.declared = typed
+		case ExpressionFunction:
+			function.Function = typed
+		}
+
+		return &CallNode{
+			name:      stage.functionName,
+			function:  function,
+			arguments: findArgumentNodes(right),
+			span:      span,
+		}, span
+
+	case ACCESS:
+		return &AccessorNode{
+			variable:  stage.accessorPath[0],
+			path:      stage.accessorPath[1:],
+			arguments: findArgumentNodes(right),
+			span:      span,
+		}, span
+
+	case SEPARATE:
+		// lists are built from left to right, so a list on the left is extended, exactly like the separator does.
+		list, isList := left.(*ListNode)
+		if isList {
+			return &ListNode{elements: append(copyNodes(list.elements), right), span: span}, span
+		}
+		return &ListNode{elements: []Node{left, right}, span: span}, span
+
+	case NEGATE, INVERT, BITWISE_NOT:
+		return &UnaryNode{operator: stage.symbol, operand: right, span: span}, span
+
+	case TERNARY_TRUE:
+		return &TernaryNode{condition: left, whenTrue: right, span: span}, span
+
+	case TERNARY_FALSE:
+		ternary, isTernary := left.(*TernaryNode)
+		if isTernary && ternary.whenFalse == nil {
+			return &TernaryNode{condition: ternary.condition, whenTrue: ternary.whenTrue, whenFalse: right, span: span}, span
+		}
+	}
+
+	return &BinaryNode{operator: stage.symbol, left: left, right: right, span: span}, span
+}
+
+/*
+	Function and method arguments are given as a list, which is spread into separate arguments.
+*/
+func findArgumentNodes(node Node) []Node {
+
+	switch typed := node.(type) {
+	case nil:
+		return nil
+	case *ListNode:
+		return copyNodes(typed.elements)
+	}
+	return []Node{node}
+}
+
+/*
+	Builds an expression from the given syntax tree, which may have come from `AST`, been changed with `Transform`,
+	or been built from scratch.
+	Returns an error if the tree isn't a valid expression.
+*/
+func NewEvaluableExpressionFromAST(root Node) (*EvaluableExpression, error) {
+
+	if root == nil {
+		return nil, errors.New("Syntax tree is empty")
+	}
+
+	tokens, err := appendNodeTokens(nil, root)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEvaluableExpressionFromTokens(tokens)
+}
+
+/*
+	Appends the tokens for the given [node] to [tokens].
+	Every operand which is itself an operator is wrapped in parenthesis, so that precedence never has to be considered.
+*/
+func appendNodeTokens(tokens []ExpressionToken, node Node) ([]ExpressionToken, error) {
+
+	var err error
+
+	switch typed := node.(type) {
+
+	case nil:
+		return nil, errors.New("Syntax tree is missing a node")
+
+	case *VariableNode:
+		return append(tokens, ExpressionToken{Kind: VARIABLE, Value: typed.name}), nil
+
+	case *LiteralNode:
+		return appendLiteralToken(tokens, typed.value)
+
+	case *UnaryNode:
+		operator, found := prefixSymbolStrings[typed.operator]
+		if !found {
+			return nil, fmt.Errorf("Operator '%v' can't be used as a prefix", typed.operator)
+		}
+
+		tokens = append(tokens, ExpressionToken{Kind: PREFIX, Value: operator})
+		if isPrefixOperand(typed.operand) {
+			return appendNodeTokens(tokens, typed.operand)
+		}
+		return appendClauseTokens(tokens, typed.operand)
+
+	case *BinaryNode:
+		operator, found := binarySymbolTokens[typed.operator]
+		if !found {
+			return nil, fmt.Errorf("Operator '%v' can't be used between two operands", typed.operator)
+		}
+
+		tokens, err = appendOperandTokens(tokens, typed.left)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, operator)
+		return appendOperandTokens(tokens, typed.right)
+
+	case *TernaryNode:
+		tokens, err = appendOperandTokens(tokens, typed.condition)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, ExpressionToken{Kind: TERNARY, Value: "?"})
+		tokens, err = appendOperandTokens(tokens, typed.whenTrue)
+		if err != nil || typed.whenFalse == nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, ExpressionToken{Kind: TERNARY, Value: ":"})
+		return appendOperandTokens(tokens, typed.whenFalse)
+
+	case *CallNode:
+		function := findDefinedFunction(typed.function)
+		if function == nil {
+			return nil, fmt.Errorf("No function given for call to '%s'", typed.name)
+		}
+
+		tokens = append(tokens, ExpressionToken{
+			Kind:         FUNCTION,
+			Value:        function,
+			functionName: typed.name,
+			pure:         typed.function.Pure,
+			signature:    findDefinedSignature(typed.function),
+		})
+		return appendListTokens(tokens, typed.arguments)
+
+	case *AccessorNode:
+		if len(typed.path) == 0 {
+			return nil, fmt.Errorf("Accessor on '%s' has no fields or methods", typed.variable)
+		}
+
+		path := append([]string{typed.variable}, typed.path...)
+		tokens = append(tokens, ExpressionToken{Kind: ACCESSOR, Value: path})
+
+		if len(typed.arguments) == 0 {
+			return tokens, nil
+		}
+		return appendListTokens(tokens, typed.arguments)
+
+	case *ListNode:
+		return appendListTokens(tokens, typed.elements)
+	}
+
+	return nil, fmt.Errorf("Unknown syntax tree node %T", node)
+}
+
+/*
+	Operands which are operators themselves are parenthesized, everything else already stands on its own.
+*/
+func appendOperandTokens(tokens []ExpressionToken, node Node) ([]ExpressionToken, error) {
+
+	switch node.(type) {
+	case *UnaryNode, *BinaryNode, *TernaryNode:
+		return appendClauseTokens(tokens, node)
+	}
+	return appendNodeTokens(tokens, node)
+}
+
+func appendClauseTokens(tokens []ExpressionToken, node Node) ([]ExpressionToken, error) {
+
+	var err error
+
+	tokens = append(tokens, ExpressionToken{Kind: CLAUSE, Value: '('})
+
+	tokens, err = appendNodeTokens(tokens, node)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(tokens, ExpressionToken{Kind: CLAUSE_CLOSE, Value: ')'}), nil
+}
+
+/*
+	Appends the given [nodes] as a parenthesized, comma-separated list.
+*/
+func appendListTokens(tokens []ExpressionToken, nodes []Node) ([]ExpressionToken, error) {
+
+	var err error
+
+	tokens = append(tokens, ExpressionToken{Kind: CLAUSE, Value: '('})
+
+	for i, node := range nodes {
+
+		if i > 0 {
+			tokens = append(tokens, ExpressionToken{Kind: SEPARATOR, Value: ","})
+		}
+
+		tokens, err = appendNodeTokens(tokens, node)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append(tokens, ExpressionToken{Kind: CLAUSE_CLOSE, Value: ')'}), nil
+}
+
+func appendLiteralToken(tokens []ExpressionToken, value interface{}) ([]ExpressionToken, error) {
+
+	var kind TokenKind
+
+	switch value.(type) {
+	case float32:
+		kind = NUMERIC
+	case bool:
+		kind = BOOLEAN
+	case nil:
+		kind = NULL
+	case string:
+		kind = STRING
+	case *regexp.Regexp:
+		kind = PATTERN
+	case time.Time:
+		kind = TIME
+	default:
+		return nil, fmt.Errorf("Literal '%v' has unsupported type %T", value, value)
+	}
+
+	return append(tokens, ExpressionToken{Kind: kind, Value: value}), nil
+}
+
+/*
+	The tokens which stand for each operator, the reverse of the symbol maps used when parsing.
+*/
+var prefixSymbolStrings = map[OperatorSymbol]string{}
+var binarySymbolTokens = map[OperatorSymbol]ExpressionToken{}
+
+func init() {
+
+	for text, symbol := range prefixSymbols {
+		prefixSymbolStrings[symbol] = text
+	}
+
+	symbolKinds := map[TokenKind]map[string]OperatorSymbol{
+		MODIFIER:   modifierSymbols,
+		COMPARATOR: comparatorSymbols,
+		LOGICALOP:  logicalSymbols,
+		TERNARY:    ternarySymbols,
+	}
+
+	for kind, symbols := range symbolKinds {
+		for text, symbol := range symbols {
+			binarySymbolTokens[symbol] = ExpressionToken{Kind: kind, Value: text}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package govaluate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/*
+	Represents a test of the syntax tree of an expression, which is compared in a compact prefix notation.
+*/
+type SyntaxTreeTest struct {
+	Name     string
+	Input    string
+	Expected string
+}
+
+func TestSyntaxTree(test *testing.T) {
+
+	functions := map[string]ExpressionFunction{
+		"max": func(arguments ...interface{}) (interface{}, error) {
+			return arguments[0], nil
+		},
+	}
+
+	syntaxTreeTests := []SyntaxTreeTest{
+
+		SyntaxTreeTest{
+			Name:     "Precedence",
+			Input:    "a + b * 2",
+			Expected: "(+ a (* b 2))",
+		},
+		SyntaxTreeTest{
+			Name:     "Left associative",
+			Input:    "a - b - c",
+			Expected: "(- (- a b) c)",
+		},
+		SyntaxTreeTest{
+			Name:     "Parenthesis",
+			Input:    "(a - (b - c))",
+			Expected: "(- a (- b c))",
+		},
+		SyntaxTreeTest{
+			Name:     "Not simplified",
+			Input:    "x ** 2 * 1",
+			Expected: "(* (** x 2) 1)",
+		},
+		SyntaxTreeTest{
+			Name:     "Prefix",
+			Input:    "!(a && -b > 0)",
+			Expected: "(! (&& a (> (- b) 0)))",
+		},
+		SyntaxTreeTest{
+			Name:     "Ternary",
+			Input:    "a > 0 ? b : c",
+			Expected: "(?: (> a 0) b c)",
+		},
+		SyntaxTreeTest{
+			Name:     "Ternary without false",
+			Input:    "a ? b",
+			Expected: "(?: a b)",
+		},
+		SyntaxTreeTest{
+			Name:     "Coalesce",
+			Input:    "a ?? 1",
+			Expected: "(?? a 1)",
+		},
+		SyntaxTreeTest{
+			Name:     "Function",
+			Input:    "max(a, b + 1, 'c')",
+			Expected: "(call max a (+ b 1) \"c\")",
+		},
+		SyntaxTreeTest{
+			Name:     "Function without arguments",
+			Input:    "max() + 1",
+			Expected: "(+ (call max) 1)",
+		},
+		SyntaxTreeTest{
+			Name:     "Accessor",
+			Input:    "foo.Int + foo.Nested.Dunk('a')",
+			Expected: "(+ (access foo Int) (access foo Nested Dunk \"a\"))",
+		},
+		SyntaxTreeTest{
+			Name:     "Membership",
+			Input:    "a in (1, 2, 3)",
+			Expected: "(in a (list 1 2 3))",
+		},
+		SyntaxTreeTest{
+			Name:     "Regex",
+			Input:    "a =~ '^b'",
+			Expected: "(=~ a /^b/)",
+		},
+	}
+
+	for _, syntaxTreeTest := range syntaxTreeTests {
+
+		expression, err := NewEvaluableExpressionWithFunctions(syntaxTreeTest.Input, functions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", syntaxTreeTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		actual := describeNode(expression.AST())
+		if actual != syntaxTreeTest.Expected {
+			test.Logf("Test '%s' failed", syntaxTreeTest.Name)
+			test.Logf("Expected '%s', got '%s'", syntaxTreeTest.Expected, actual)
+			test.Fail()
+		}
+	}
+}
+
+func TestSyntaxTreeSpans(test *testing.T) {
+
+	input := "max(a,  b) * (c - 1)"
+
+	expression, err := NewEvaluableExpressionWithFunctions(input, map[string]ExpressionFunction{
+		"max": func(arguments ...interface{}) (interface{}, error) {
+			return arguments[0], nil
+		},
+	})
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	var spans []string
+
+	Inspect(expression.AST(), func(node Node) bool {
+
+		if node != nil {
+			span := node.Span()
+			spans = append(spans, input[span.Start:span.End])
+		}
+		return true
+	})
+
+	expected := []string{input, "max(a,  b)", "a", "b", "c - 1", "c", "1"}
+
+	if strings.Join(spans, "|") != strings.Join(expected, "|") {
+		test.Logf("Expected spans %q, got %q", expected, spans)
+		test.Fail()
+	}
+}
+
+func TestSyntaxTreeRebuild(test *testing.T) {
+
+	expression, err := NewEvaluableExpression("(a + b) * -c > 2 ? a : b")
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	// swap every variable named 'a' for a constant.
+	root := Transform(expression.AST(), func(node Node) Node {
+
+		variable, ok := node.(*VariableNode)
+		if ok && variable.Name() == "a" {
+			return NewLiteralNode(float32(10))
+		}
+		return node
+	})
+
+	rebuilt, err := NewEvaluableExpressionFromAST(root)
+	if err != nil {
+		test.Fatalf("Failed to rebuild: %v", err)
+	}
+
+	result, err := rebuilt.Evaluate(map[string]interface{}{"b": 2, "c": -1})
+	if err != nil || result != float32(10) {
+		test.Logf("Expected 10, got %v (%v)", result, err)
+		test.Fail()
+	}
+
+	if describeNode(rebuilt.AST()) != "(?: (> (* (+ 10 b) (- c)) 2) 10 b)" {
+		test.Logf("Unexpected rebuilt tree: %s", describeNode(rebuilt.AST()))
+		test.Fail()
+	}
+
+	// the original tree is unchanged.
+	if describeNode(expression.AST()) != "(?: (> (* (+ a b) (- c)) 2) a b)" {
+		test.Logf("Original tree was modified: %s", describeNode(expression.AST()))
+		test.Fail()
+	}
+}
+
+func TestSyntaxTreeBuildErrors(test *testing.T) {
+
+	roots := []Node{
+		nil,
+		NewBinaryNode(NEGATE, NewVariableNode("a"), NewVariableNode("b")),
+		NewUnaryNode(PLUS, NewVariableNode("a")),
+		NewLiteralNode(1),
+		NewCallNode("f", FunctionDefinition{}),
+		NewBinaryNode(PLUS, NewVariableNode("a"), nil),
+	}
+
+	for _, root := range roots {
+
+		_, err := NewEvaluableExpressionFromAST(root)
+		if err == nil {
+			test.Logf("Expected an error when building %s", describeNode(root))
+			test.Fail()
+		}
+	}
+}
+
+/*
+	Renders a syntax tree in prefix notation, such as `(+ a 1)`.
+*/
+func describeNode(node Node) string {
+
+	var children []string
+
+	for _, child := range nodeChildren(node) {
+		children = append(children, describeNode(child))
+	}
+
+	switch typed := node.(type) {
+
+	case nil:
+		return "nil"
+	case *VariableNode:
+		return typed.Name()
+	case *LiteralNode:
+		switch value := typed.Value().(type) {
+		case string:
+			return fmt.Sprintf("%q", value)
+		case fmt.Stringer:
+			return "/" + value.String() + "/"
+		}
+		return fmt.Sprintf("%v", typed.Value())
+	case *UnaryNode:
+		return fmt.Sprintf("(%v %s)", typed.Operator(), children[0])
+	case *BinaryNode:
+		operator := typed.Operator().String()
+		if typed.Operator() == EQ {
+			operator = "=="
+		}
+		return fmt.Sprintf("(%s %s)", operator, strings.Join(children, " "))
+	case *TernaryNode:
+		return fmt.Sprintf("(?: %s)", strings.Join(children, " "))
+	case *CallNode:
+		return fmt.Sprintf("(call %s)", strings.Join(append([]string{typed.Name()}, children...), " "))
+	case *AccessorNode:
+		path := append([]string{typed.Variable()}, typed.Path()...)
+		return fmt.Sprintf("(access %s)", strings.Join(append(path, children...), " "))
+	case *ListNode:
+		return fmt.Sprintf("(list %s)", strings.Join(children, " "))
+	}
+	return "?"
+}
+
+func nodeChildren(node Node) []Node {
+
+	if node == nil {
+		return nil
+	}
+	return node.Children()
+}
@@ -28,6 +28,7 @@ func TestTokenKindStrings(test *testing.T) {
 		CLAUSE,
 		CLAUSE_CLOSE,
 		TERNARY,
+		NULL,
 	}
 
 	for _, kind := range kinds {
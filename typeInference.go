@@ -0,0 +1,757 @@
+package govaluate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+/*
+	The kind of element that a value holds, whether it's a single value or an array.
+*/
+type ValueKind int
+
+const (
+	NumberValue ValueKind = iota
+	BoolValue
+	StringValue
+	StructValue
+)
+
+/*
+	Whether a value is a single element, or an array of them.
+*/
+type ValueShape int
+
+const (
+	ScalarShape ValueShape = iota
+	ArrayShape
+
+	// either a single value or an array, depending on the values of the parameters.
+	// This happens when a short-circuiting operator might be decided by a single value on its left (see `EvalContext`),
+	// and otherwise returns an array.
+	EitherShape
+)
+
+/*
+	Describes the type of a value, either one given to an expression or one that an expression computes.
+	Numbers are float32 and []float32, bools are bool and []bool.
+*/
+type ValueType struct {
+	Kind  ValueKind
+	Shape ValueShape
+
+	// for structs, the Go type of the struct (or a pointer to it), which gives the types of its fields and methods.
+	Struct reflect.Type
+}
+
+var (
+	NumberType      = ValueType{Kind: NumberValue}
+	NumberArrayType = ValueType{Kind: NumberValue, Shape: ArrayShape}
+	BoolType        = ValueType{Kind: BoolValue}
+	BoolArrayType   = ValueType{Kind: BoolValue, Shape: ArrayShape}
+	StringType      = ValueType{Kind: StringValue}
+)
+
+/*
+	Returns the type of a struct parameter, given an example [value] of it (or a pointer to it).
+*/
+func StructTypeOf(value interface{}) ValueType {
+	return ValueType{Kind: StructValue, Struct: reflect.TypeOf(value)}
+}
+
+func (this ValueType) String() string {
+
+	var ret string
+
+	switch this.Kind {
+	case NumberValue:
+		ret = "number"
+	case BoolValue:
+		ret = "bool"
+	case StringValue:
+		ret = "string"
+	case StructValue:
+		ret = fmt.Sprintf("struct '%v'", this.Struct)
+	}
+
+	switch this.Shape {
+	case ArrayShape:
+		return ret + " array"
+	case EitherShape:
+		return ret + " or " + ret + " array"
+	}
+	return ret
+}
+
+/*
+	Declares the types of everything that an expression may use, so that it can be checked before it's evaluated.
+*/
+type Schema struct {
+	Variables map[string]ValueType
+	Functions map[string]FunctionSignature
+}
+
+/*
+	Declares the types of the arguments that a function takes, and of the value it returns.
+*/
+type FunctionSignature struct {
+	Arguments []ValueType
+
+	/*
+		Whether or not the last argument may be repeated any number of times, including none at all.
+	*/
+	Variadic bool
+
+	/*
+		The number of arguments at the end of [Arguments] which may be left out, not counting a variadic one.
+	*/
+	Optional int
+
+	Result ValueType
+}
+
+/*
+	Returns the fewest arguments that a function with this signature may be called with.
+*/
+func (this FunctionSignature) MinArguments() int {
+
+	ret := len(this.Arguments) - this.Optional
+	if this.Variadic {
+		ret--
+	}
+
+	if ret < 0 {
+		return 0
+	}
+	return ret
+}
+
+/*
+	Returns the most arguments that a function with this signature may be called with, or -1 if it's variadic.
+*/
+func (this FunctionSignature) MaxArguments() int {
+
+	if this.Variadic {
+		return -1
+	}
+	return len(this.Arguments)
+}
+
+/*
+	Returns the declared type of the argument at the given [index], which is the type of the last argument for any beyond it.
+	Returns false if no arguments are declared at all.
+*/
+func (this FunctionSignature) argumentType(index int) (ValueType, bool) {
+
+	if len(this.Arguments) == 0 {
+		return ValueType{}, false
+	}
+
+	if index >= len(this.Arguments) {
+		return this.Arguments[len(this.Arguments)-1], true
+	}
+	return this.Arguments[index], true
+}
+
+/*
+	Checks every operator, function call and accessor in this expression against the types declared by the given [schema],
+	and returns the type of the value that the expression evaluates to.
+
+	If this succeeds, evaluating the expression with parameters of the declared types can't fail a type check,
+	so `ChecksTypes` can be turned off. It can still fail for other reasons, such as arrays of different lengths,
+	or a function which returns an error.
+*/
+func (this EvaluableExpression) InferType(schema Schema) (ValueType, error) {
+
+	if this.evaluationStages == nil {
+		return ValueType{}, errors.New("Empty expressions have no type")
+	}
+
+	inference := typeInference{
+		schema: schema,
+		types:  make(map[*evaluationStage]inferredType),
+	}
+
+	inferred, err := inference.inferStage(this.evaluationStages)
+	if err != nil {
+		return ValueType{}, err
+	}
+
+	if inferred.isList || inferred.isPattern {
+		return ValueType{}, errors.New("Expression does not evaluate to a single value")
+	}
+	if inferred.isNull {
+		return ValueType{}, errors.New("Expression always evaluates to null, which has no type")
+	}
+	return inferred.value, nil
+}
+
+type typeInference struct {
+	schema Schema
+
+	// stages may be shared, but only need to be inferred once.
+	types map[*evaluationStage]inferredType
+}
+
+/*
+	The type of a single stage. Besides ordinary values, stages can produce a list of function arguments (from a separator),
+	a constant regex pattern, or null.
+*/
+type inferredType struct {
+	value ValueType
+
+	isList   bool
+	elements []ValueType
+
+	isPattern bool
+	isNull    bool
+}
+
+func (this *typeInference) inferStage(stage *evaluationStage) (inferredType, error) {
+
+	ret, found := this.types[stage]
+	if found {
+		return ret, nil
+	}
+
+	ret, err := this.inferUnsharedStage(stage)
+	if err != nil {
+		return ret, err
+	}
+
+	this.types[stage] = ret
+	return ret, nil
+}
+
+func (this *typeInference) inferUnsharedStage(stage *evaluationStage) (inferredType, error) {
+
+	var left, right inferredType
+	var err error
+
+	switch stage.symbol {
+
+	case VALUE:
+		declared, found := this.schema.Variables[stage.parameterName]
+		if !found {
+			return inferredType{}, fmt.Errorf("No type declared for variable '%s'", stage.parameterName)
+		}
+		return inferredType{value: declared}, nil
+
+	case LITERAL:
+		return inferLiteral(literalStageValue(stage))
+
+	case ACCESS, FUNCTIONAL:
+		arguments, err := this.inferArguments(stage.rightStage)
+		if err != nil {
+			return inferredType{}, err
+		}
+
+		if stage.symbol == ACCESS {
+			return this.inferAccessor(stage.accessorPath, arguments)
+		}
+		return this.inferFunction(stage.functionName, stage.token.signature, arguments)
+	}
+
+	if stage.leftStage != nil {
+		left, err = this.inferStage(stage.leftStage)
+		if err != nil {
+			return inferredType{}, err
+		}
+	}
+
+	if stage.rightStage != nil {
+		right, err = this.inferStage(stage.rightStage)
+		if err != nil {
+			return inferredType{}, err
+		}
+	}
+
+	switch stage.symbol {
+
+	case NOOP:
+		if stage.rightStage == nil {
+			return inferredType{}, errors.New("Empty parenthesis have no type")
+		}
+		return right, nil
+
+	case SEPARATE:
+		if right.isList || right.isPattern || left.isPattern {
+			return inferredType{}, errors.New("Lists can only hold single values or arrays")
+		}
+
+		if left.isList {
+			elements := make([]ValueType, len(left.elements), len(left.elements)+1)
+			copy(elements, left.elements)
+			return inferredType{isList: true, elements: append(elements, right.value)}, nil
+		}
+		return inferredType{isList: true, elements: []ValueType{left.value, right.value}}, nil
+
+	case IN:
+		if !right.isList || left.isList || left.isPattern || left.value.Shape != ScalarShape {
+			return inferredType{}, fmt.Errorf("Operator '%v' needs a single value on its left, and a list on its right", stage.symbol)
+		}
+		return inferredType{value: BoolType}, nil
+
+	case IS, IS_NOT:
+		if left.isList || left.isPattern {
+			return inferredType{}, operatorTypeError(stage, left, right)
+		}
+		return inferredType{value: inferNullTest(left)}, nil
+	}
+
+	if left.isNull || right.isNull {
+		return inferNullOperator(stage, left, right)
+	}
+
+	switch stage.symbol {
+
+	case REQ, NREQ:
+		if isPlainType(left, StringValue) && left.value.Shape == ScalarShape &&
+			(right.isPattern || isPlainType(right, StringValue) && right.value.Shape == ScalarShape) {
+			return inferredType{value: BoolType}, nil
+		}
+		return inferredType{}, operatorTypeError(stage, left, right)
+	}
+
+	if left.isList || left.isPattern || right.isList || right.isPattern {
+		return inferredType{}, operatorTypeError(stage, left, right)
+	}
+
+	result, ok := inferOperator(stage.symbol, left.value, right.value)
+	if !ok {
+		return inferredType{}, operatorTypeError(stage, left, right)
+	}
+	return inferredType{value: result}, nil
+}
+
+/*
+	Determines the type computed by the operator for [symbol] from operands of the given types.
+	Returns false if the operator would refuse them.
+*/
+func inferOperator(symbol OperatorSymbol, left ValueType, right ValueType) (ValueType, bool) {
+
+	switch symbol {
+
+	case PLUS:
+		if left.Kind == StringValue && left.Shape == ScalarShape || right.Kind == StringValue && right.Shape == ScalarShape {
+			return StringType, true
+		}
+		return inferElementWise(NumberValue, NumberValue, left, right)
+
+	case MINUS, MULTIPLY, DIVIDE, MODULUS, EXPONENT,
+		BITWISE_AND, BITWISE_OR, BITWISE_XOR, BITWISE_LSHIFT, BITWISE_RSHIFT:
+		return inferElementWise(NumberValue, NumberValue, left, right)
+
+	case EQ, NEQ, GT, LT, GTE, LTE:
+		if left == StringType && right == StringType {
+			return BoolType, true
+		}
+		return inferElementWise(NumberValue, BoolValue, left, right)
+
+	case AND, OR:
+		return inferShortCircuit(BoolValue, BoolValue, BoolValue, left, right)
+
+	case TERNARY_TRUE:
+		return inferShortCircuit(BoolValue, NumberValue, NumberValue, left, right)
+
+	case TERNARY_FALSE, COALESCE:
+		// values other than numbers are never replaced.
+		if left.Kind != NumberValue {
+			return left, true
+		}
+		return inferShortCircuit(NumberValue, NumberValue, NumberValue, left, right)
+
+	case NEGATE, BITWISE_NOT:
+		return right, right.Kind == NumberValue
+
+	case INVERT:
+		return right, right.Kind == BoolValue
+	}
+
+	return ValueType{}, false
+}
+
+/*
+	Determines the type computed by the operator of the given [stage], when one of its operands is null.
+	Null stands in for a value of whichever type the operator accepts on its side (trying a number, then a bool, then a string),
+	so that the result has the type it would have with a value there instead.
+*/
+func inferNullOperator(stage *evaluationStage, left inferredType, right inferredType) (inferredType, error) {
+
+	switch {
+	case stage.symbol == EQ || stage.symbol == NEQ:
+		if left.isNull {
+			return inferredType{value: inferNullTest(right)}, nil
+		}
+		return inferredType{value: inferNullTest(left)}, nil
+
+	case stage.leftStage == nil || left.isNull && right.isNull:
+		return inferredType{isNull: true}, nil
+
+	case (stage.symbol == TERNARY_FALSE || stage.symbol == COALESCE) && left.isNull:
+		return right, nil
+
+	case left.isList || left.isPattern || right.isList || right.isPattern:
+		return inferredType{}, operatorTypeError(stage, left, right)
+	}
+
+	for _, candidate := range []ValueType{NumberType, BoolType, StringType} {
+
+		leftType, rightType := left.value, right.value
+		if left.isNull {
+			leftType = candidate
+		} else {
+			rightType = candidate
+		}
+
+		result, ok := inferOperator(stage.symbol, leftType, rightType)
+		if ok {
+			return inferredType{value: result}, nil
+		}
+	}
+	return inferredType{}, operatorTypeError(stage, left, right)
+}
+
+/*
+	Returns the type of a test for whether a value of the [tested] type is null. Arrays of numbers are tested element by element.
+*/
+func inferNullTest(tested inferredType) ValueType {
+
+	if tested.isNull || tested.value.Kind != NumberValue {
+		return BoolType
+	}
+	return ValueType{Kind: BoolValue, Shape: tested.value.Shape}
+}
+
+/*
+	Element-wise operators take two operands of the [operand] kind, and return an array if either operand is an array.
+*/
+func inferElementWise(operand ValueKind, result ValueKind, left ValueType, right ValueType) (ValueType, bool) {
+
+	if left.Kind != operand || right.Kind != operand {
+		return ValueType{}, false
+	}
+
+	shape := ScalarShape
+	switch {
+	case left.Shape == ArrayShape || right.Shape == ArrayShape:
+		shape = ArrayShape
+	case left.Shape == EitherShape || right.Shape == EitherShape:
+		shape = EitherShape
+	}
+
+	return ValueType{Kind: result, Shape: shape}, true
+}
+
+/*
+	Short-circuiting operators are element-wise, except that a single value on the left may decide the result on its own,
+	in which case the result is a single value even if the right operand would have been an array.
+*/
+func inferShortCircuit(leftKind ValueKind, rightKind ValueKind, result ValueKind, left ValueType, right ValueType) (ValueType, bool) {
+
+	if left.Kind != leftKind || right.Kind != rightKind {
+		return ValueType{}, false
+	}
+
+	shape := EitherShape
+	switch {
+	case left.Shape == ArrayShape:
+		shape = ArrayShape
+	case left.Shape == ScalarShape && right.Shape == ScalarShape:
+		shape = ScalarShape
+	}
+
+	return ValueType{Kind: result, Shape: shape}, true
+}
+
+func inferLiteral(value interface{}) (inferredType, error) {
+
+	switch value.(type) {
+	case nil:
+		return inferredType{isNull: true}, nil
+	case float32:
+		return inferredType{value: NumberType}, nil
+	case bool:
+		return inferredType{value: BoolType}, nil
+	case string:
+		return inferredType{value: StringType}, nil
+	case *regexp.Regexp:
+		return inferredType{isPattern: true}, nil
+	}
+
+	return inferredType{}, fmt.Errorf("Literal '%v' has unsupported type %T", value, value)
+}
+
+/*
+	Returns the types of the arguments given by the [stage] which follows a function or method name.
+*/
+func (this *typeInference) inferArguments(stage *evaluationStage) ([]ValueType, error) {
+
+	// functions called with empty parenthesis.
+	if stage == nil || stage.symbol == NOOP && stage.rightStage == nil {
+		return nil, nil
+	}
+
+	arguments, err := this.inferStage(stage)
+	if err != nil {
+		return nil, err
+	}
+
+	if arguments.isPattern {
+		return nil, errors.New("Patterns can only be used with regex comparators")
+	}
+	if arguments.isList {
+		return arguments.elements, nil
+	}
+	return []ValueType{arguments.value}, nil
+}
+
+/*
+	Infers the result of calling the function with the given [name], using the signature declared for it by the schema,
+	or else the one it was [defined] with, if any.
+*/
+func (this *typeInference) inferFunction(name string, defined *functionSignature, arguments []ValueType) (inferredType, error) {
+
+	signature, found := this.schema.Functions[name]
+	if !found {
+
+		// functions defined with a signature don't need to be declared again.
+		if defined == nil || defined.declared == nil {
+			return inferredType{}, fmt.Errorf("No signature declared for function '%s'", name)
+		}
+		signature = *defined.declared
+	}
+
+	minimum := signature.MinArguments()
+	maximum := signature.MaxArguments()
+
+	switch {
+	case maximum < 0:
+		if len(arguments) < minimum {
+			return inferredType{}, fmt.Errorf("Function '%s' takes at least %d arguments, got %d", name, minimum, len(arguments))
+		}
+	case minimum == maximum:
+		if len(arguments) != maximum {
+			return inferredType{}, fmt.Errorf("Function '%s' takes %d arguments, got %d", name, maximum, len(arguments))
+		}
+	default:
+		if len(arguments) < minimum || len(arguments) > maximum {
+			return inferredType{}, fmt.Errorf("Function '%s' takes between %d and %d arguments, got %d", name, minimum, maximum, len(arguments))
+		}
+	}
+
+	for i, argument := range arguments {
+
+		declared, found := signature.argumentType(i)
+
+		if found && !acceptsType(declared, argument) {
+			return inferredType{}, fmt.Errorf("Argument %d of function '%s' must be a %v, not a %v", i+1, name, declared, argument)
+		}
+	}
+
+	return inferredType{value: signature.Result}, nil
+}
+
+/*
+	Returns true if a value of the [actual] type can be given where the [declared] type is expected.
+*/
+func acceptsType(declared ValueType, actual ValueType) bool {
+
+	if declared.Kind != actual.Kind {
+		return false
+	}
+	if declared.Kind == StructValue && declared.Struct != nil && declared.Struct != actual.Struct {
+		return false
+	}
+	return declared.Shape == EitherShape || declared.Shape == actual.Shape
+}
+
+/*
+	Follows the fields and methods of an accessor the same way that its stage does, using the declared struct type of its parameter.
+	Every method along the way is given the same [arguments].
+*/
+func (this *typeInference) inferAccessor(path []string, arguments []ValueType) (inferredType, error) {
+
+	declared, found := this.schema.Variables[path[0]]
+	if !found {
+		return inferredType{}, fmt.Errorf("No type declared for variable '%s'", path[0])
+	}
+
+	if declared.Kind != StructValue || declared.Struct == nil || declared.Shape != ScalarShape {
+		return inferredType{}, fmt.Errorf("Unable to access '%s', '%s' is not a struct", path[1], path[0])
+	}
+
+	current := declared.Struct
+
+	for i := 1; i < len(path); i++ {
+
+		structType := current
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+
+		if structType.Kind() != reflect.Struct {
+			return inferredType{}, fmt.Errorf("Unable to access '%s', '%s' is not a struct", path[i], path[i-1])
+		}
+
+		field, found := structType.FieldByName(path[i])
+		if found {
+
+			if field.PkgPath != "" {
+				return inferredType{}, fmt.Errorf("Unable to access '%s', it is not exported", path[i])
+			}
+
+			current = field.Type
+			continue
+		}
+
+		// the methods of a pointer include the methods of the value it points to.
+		method, found := current.MethodByName(path[i])
+		if !found {
+			return inferredType{}, fmt.Errorf("No method or field '%s' present on parameter '%s'", path[i], path[i-1])
+		}
+
+		result, err := inferMethod(path, i, method.Type, arguments)
+		if err != nil {
+			return inferredType{}, err
+		}
+		current = result
+	}
+
+	return goValueType(current, path)
+}
+
+/*
+	Checks a call to the method at position [index] of the accessor [path], whose function type (including the receiver) is [methodType].
+	Returns the type of the value that the method returns.
+*/
+func inferMethod(path []string, index int, methodType reflect.Type, arguments []ValueType) (reflect.Type, error) {
+
+	if methodType.NumIn()-1 != len(arguments) {
+		return nil, fmt.Errorf("Method '%s' takes %d arguments, got %d", path[index], methodType.NumIn()-1, len(arguments))
+	}
+
+	for i, argument := range arguments {
+
+		goType := argument.goType()
+		if goType == nil || !goType.ConvertibleTo(methodType.In(i+1)) {
+			return nil, fmt.Errorf("Argument %d of method '%s' can't be a %v", i+1, path[index], argument)
+		}
+	}
+
+	switch methodType.NumOut() {
+	case 1:
+		return methodType.Out(0), nil
+	case 2:
+		if methodType.Out(1) == reflect.TypeOf((*error)(nil)).Elem() {
+			return methodType.Out(0), nil
+		}
+	}
+
+	return nil, fmt.Errorf("Method '%s' must return either one value, or a value and an error", path[index])
+}
+
+/*
+	Returns the Go type of the values of this type, or nil if it could be more than one.
+*/
+func (this ValueType) goType() reflect.Type {
+
+	switch {
+	case this.Kind == NumberValue && this.Shape == ScalarShape:
+		return reflect.TypeOf(float32(0))
+	case this.Kind == NumberValue && this.Shape == ArrayShape:
+		return reflect.TypeOf([]float32(nil))
+	case this.Kind == BoolValue && this.Shape == ScalarShape:
+		return reflect.TypeOf(false)
+	case this.Kind == BoolValue && this.Shape == ArrayShape:
+		return reflect.TypeOf([]bool(nil))
+	case this.Kind == StringValue && this.Shape == ScalarShape:
+		return reflect.TypeOf("")
+	case this.Kind == StructValue && this.Shape == ScalarShape:
+		return this.Struct
+	}
+	return nil
+}
+
+/*
+	The Go types which accessors turn into numbers (see `castToFloat32`), and the arrays of them which become number arrays.
+*/
+var numberGoTypes = map[reflect.Type]ValueType{}
+
+func init() {
+
+	examples := []interface{}{
+		uint8(0), uint16(0), uint32(0), uint64(0),
+		int8(0), int16(0), int32(0), int64(0), int(0),
+		float32(0), float64(0),
+	}
+
+	for _, example := range examples {
+
+		goType := reflect.TypeOf(example)
+		numberGoTypes[goType] = NumberType
+		numberGoTypes[reflect.SliceOf(goType)] = NumberArrayType
+	}
+}
+
+/*
+	Returns the type of the value that an accessor returns, given the Go type of the field or method at the end of its [path].
+*/
+func goValueType(goType reflect.Type, path []string) (inferredType, error) {
+
+	valueType, found := numberGoTypes[goType]
+	if found {
+		return inferredType{value: valueType}, nil
+	}
+
+	switch goType {
+	case reflect.TypeOf(false):
+		return inferredType{value: BoolType}, nil
+	case reflect.TypeOf([]bool(nil)):
+		return inferredType{value: BoolArrayType}, nil
+	case reflect.TypeOf(""):
+		return inferredType{value: StringType}, nil
+	}
+
+	if goType.Kind() == reflect.Struct || goType.Kind() == reflect.Ptr && goType.Elem().Kind() == reflect.Struct {
+		return inferredType{value: ValueType{Kind: StructValue, Struct: goType}}, nil
+	}
+
+	return inferredType{}, fmt.Errorf("Accessor '%s' returns unsupported type %v", joinAccessorPath(path), goType)
+}
+
+func joinAccessorPath(path []string) string {
+
+	ret := path[0]
+	for _, name := range path[1:] {
+		ret += "." + name
+	}
+	return ret
+}
+
+func isPlainType(inferred inferredType, kind ValueKind) bool {
+	return !inferred.isList && !inferred.isPattern && inferred.value.Kind == kind
+}
+
+func operatorTypeError(stage *evaluationStage, left inferredType, right inferredType) error {
+
+	if stage.leftStage == nil {
+		return fmt.Errorf("Operator '%v' cannot be used with a %v", stage.symbol, describeInferredType(right))
+	}
+	return fmt.Errorf("Operator '%v' cannot be used with a %v and a %v", stage.symbol, describeInferredType(left), describeInferredType(right))
+}
+
+func describeInferredType(inferred inferredType) string {
+
+	switch {
+	case inferred.isList:
+		return "list"
+	case inferred.isPattern:
+		return "pattern"
+	case inferred.isNull:
+		return "null"
+	}
+	return inferred.value.String()
+}
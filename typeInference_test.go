@@ -0,0 +1,308 @@
+package govaluate
+
+import (
+	"testing"
+)
+
+/*
+	Represents a test of type inference, which either expects the expression to have the [Expected] type,
+	or to fail with the [Error] message.
+*/
+type TypeInferenceTest struct {
+	Name     string
+	Input    string
+	Expected ValueType
+	Error    string
+}
+
+func TestTypeInference(test *testing.T) {
+
+	definitions := map[string]FunctionDefinition{
+		"sum": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return float32(0), nil
+			},
+		},
+		"first": FunctionDefinition{
+			Function: func(arguments ...interface{}) (interface{}, error) {
+				return arguments[0], nil
+			},
+		},
+	}
+
+	schema := Schema{
+		Variables: map[string]ValueType{
+			"x":      NumberType,
+			"y":      NumberType,
+			"xs":     NumberArrayType,
+			"ys":     NumberArrayType,
+			"flag":   BoolType,
+			"flags":  BoolArrayType,
+			"name":   StringType,
+			"foo":    StructTypeOf(dummyParameter{}),
+			"fooPtr": StructTypeOf(&dummyParameter{}),
+		},
+		Functions: map[string]FunctionSignature{
+			"sum": FunctionSignature{
+				Arguments: []ValueType{ValueType{Kind: NumberValue, Shape: EitherShape}},
+				Variadic:  true,
+				Result:    NumberType,
+			},
+			"first": FunctionSignature{
+				Arguments: []ValueType{NumberArrayType},
+				Result:    NumberType,
+			},
+		},
+	}
+
+	inferenceTests := []TypeInferenceTest{
+
+		TypeInferenceTest{
+			Name:     "Scalar arithmetic",
+			Input:    "x * 2 + y",
+			Expected: NumberType,
+		},
+		TypeInferenceTest{
+			Name:     "Array arithmetic",
+			Input:    "xs * 2 + y",
+			Expected: NumberArrayType,
+		},
+		TypeInferenceTest{
+			Name:     "Array comparison",
+			Input:    "xs > ys",
+			Expected: BoolArrayType,
+		},
+		TypeInferenceTest{
+			Name:     "String comparison",
+			Input:    "name == 'foo'",
+			Expected: BoolType,
+		},
+		TypeInferenceTest{
+			Name:     "String concatenation",
+			Input:    "name + x",
+			Expected: StringType,
+		},
+		TypeInferenceTest{
+			Name:     "Regex",
+			Input:    "name =~ '^f'",
+			Expected: BoolType,
+		},
+		TypeInferenceTest{
+			Name:     "Membership",
+			Input:    "x in (1, 2, 3)",
+			Expected: BoolType,
+		},
+		TypeInferenceTest{
+			Name:     "Short circuit on scalar",
+			Input:    "flag && flags",
+			Expected: ValueType{Kind: BoolValue, Shape: EitherShape},
+		},
+		TypeInferenceTest{
+			Name:     "Short circuit on array",
+			Input:    "flags || flag",
+			Expected: BoolArrayType,
+		},
+		TypeInferenceTest{
+			Name:     "Ternary",
+			Input:    "flag ? x : y",
+			Expected: NumberType,
+		},
+		TypeInferenceTest{
+			Name:     "Array ternary",
+			Input:    "xs > 0 ? xs : 0",
+			Expected: NumberArrayType,
+		},
+		TypeInferenceTest{
+			Name:     "Variadic function",
+			Input:    "sum(x, xs, 1) + 1",
+			Expected: NumberType,
+		},
+		TypeInferenceTest{
+			Name:     "Function",
+			Input:    "first(xs * 2)",
+			Expected: NumberType,
+		},
+		TypeInferenceTest{
+			Name:     "Field",
+			Input:    "foo.Int + 1",
+			Expected: NumberType,
+		},
+		TypeInferenceTest{
+			Name:     "Nested method",
+			Input:    "foo.Nested.Dunk('a')",
+			Expected: StringType,
+		},
+		TypeInferenceTest{
+			Name:     "Method with error",
+			Input:    "foo.Func2()",
+			Expected: StringType,
+		},
+		TypeInferenceTest{
+			Name:     "Pointer method",
+			Input:    "fooPtr.Func3()",
+			Expected: StringType,
+		},
+		TypeInferenceTest{
+			Name:  "Undeclared variable",
+			Input: "x + z",
+			Error: "No type declared for variable 'z'",
+		},
+		TypeInferenceTest{
+			Name:  "Mismatched operands",
+			Input: "x + flag",
+			Error: "Operator '+' cannot be used with a number and a bool",
+		},
+		TypeInferenceTest{
+			Name:  "String array comparison",
+			Input: "name > xs",
+			Error: "Operator '>' cannot be used with a string and a number array",
+		},
+		TypeInferenceTest{
+			Name:  "Numeric logic",
+			Input: "x && flag",
+			Error: "Operator '&&' cannot be used with a number and a bool",
+		},
+		TypeInferenceTest{
+			Name:  "Prefix",
+			Input: "!xs",
+			Error: "Operator '!' cannot be used with a number array",
+		},
+		TypeInferenceTest{
+			Name:  "Argument count",
+			Input: "first(xs, ys)",
+			Error: "Function 'first' takes 1 arguments, got 2",
+		},
+		TypeInferenceTest{
+			Name:  "Argument type",
+			Input: "first(x)",
+			Error: "Argument 1 of function 'first' must be a number array, not a number",
+		},
+		TypeInferenceTest{
+			Name:  "Value method on pointer receiver",
+			Input: "foo.Func3()",
+			Error: "No method or field 'Func3' present on parameter 'foo'",
+		},
+		TypeInferenceTest{
+			Name:  "Method argument",
+			Input: "foo.FuncArgStr(flag)",
+			Error: "Argument 1 of method 'FuncArgStr' can't be a bool",
+		},
+		TypeInferenceTest{
+			Name:  "Unsupported field",
+			Input: "foo.Nil",
+			Error: "Accessor 'foo.Nil' returns unsupported type interface {}",
+		},
+		TypeInferenceTest{
+			Name:     "Null test",
+			Input:    "xs is null",
+			Expected: BoolArrayType,
+		},
+		TypeInferenceTest{
+			Name:     "Equal to null",
+			Input:    "null == name",
+			Expected: BoolType,
+		},
+		TypeInferenceTest{
+			Name:     "Null arithmetic",
+			Input:    "xs * null + y",
+			Expected: NumberArrayType,
+		},
+		TypeInferenceTest{
+			Name:     "Null condition",
+			Input:    "null ? x : y",
+			Expected: NumberType,
+		},
+		TypeInferenceTest{
+			Name:     "Coalesce null",
+			Input:    "null ?? name",
+			Expected: StringType,
+		},
+		TypeInferenceTest{
+			Name:     "Coalesce string",
+			Input:    "name ?? 'none'",
+			Expected: StringType,
+		},
+		TypeInferenceTest{
+			Name:  "Only null",
+			Input: "-(null)",
+			Error: "Expression always evaluates to null, which has no type",
+		},
+		TypeInferenceTest{
+			Name:  "Not a struct",
+			Input: "x.Int",
+			Error: "Unable to access 'Int', 'x' is not a struct",
+		},
+	}
+
+	for _, inferenceTest := range inferenceTests {
+
+		expression, err := NewEvaluableExpressionWithDefinitions(inferenceTest.Input, definitions)
+		if err != nil {
+			test.Logf("Test '%s' failed to parse: %v", inferenceTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		inferred, err := expression.InferType(schema)
+
+		if inferenceTest.Error != "" {
+			if err == nil || err.Error() != inferenceTest.Error {
+				test.Logf("Test '%s' failed", inferenceTest.Name)
+				test.Logf("Expected error '%s', got: %v", inferenceTest.Error, err)
+				test.Fail()
+			}
+			continue
+		}
+
+		if err != nil {
+			test.Logf("Test '%s' failed: %v", inferenceTest.Name, err)
+			test.Fail()
+			continue
+		}
+
+		if inferred != inferenceTest.Expected {
+			test.Logf("Test '%s' failed", inferenceTest.Name)
+			test.Logf("Expected type %v, got %v", inferenceTest.Expected, inferred)
+			test.Fail()
+		}
+	}
+}
+
+func TestInferredTypesEvaluateUnchecked(test *testing.T) {
+
+	schema := Schema{
+		Variables: map[string]ValueType{
+			"xs":   NumberArrayType,
+			"flag": BoolType,
+			"name": StringType,
+		},
+	}
+
+	expression, err := NewEvaluableExpression("flag && name == 'foo' ? xs * 2 : xs - 1")
+	if err != nil {
+		test.Fatalf("Failed to parse: %v", err)
+	}
+
+	_, err = expression.InferType(schema)
+	if err != nil {
+		test.Fatalf("Failed to infer type: %v", err)
+	}
+
+	expression.ChecksTypes = false
+
+	result, err := expression.Evaluate(map[string]interface{}{
+		"xs":   []float32{1, 2},
+		"flag": true,
+		"name": "foo",
+	})
+
+	if err != nil {
+		test.Fatalf("Failed to evaluate: %v", err)
+	}
+
+	values, ok := result.([]float32)
+	if !ok || len(values) != 2 || values[0] != 2 || values[1] != 4 {
+		test.Logf("Expected [2 4], got %v", result)
+		test.Fail()
+	}
+}
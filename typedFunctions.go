@@ -0,0 +1,526 @@
+package govaluate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+/*
+	The arguments that a function accepts, so that calls to it can be checked when they're parsed.
+*/
+type functionSignature struct {
+
+	// the fewest arguments the function takes, and the most, or -1 if there's no limit.
+	minimum, maximum int
+
+	// returns an error if the given literal can't be given as the argument at [index]. Nil if any value is accepted.
+	checkLiteral func(index int, value interface{}) error
+
+	// the signature that the function was defined with, if any.
+	declared *FunctionSignature
+}
+
+/*
+	An ordinary Go function, called through reflection.
+*/
+type typedFunction struct {
+	function     reflect.Value
+	signature    *functionSignature
+	result       reflect.Type
+	returnsError bool
+
+	// the type of each argument. An argument of the empty interface type accepts anything.
+	arguments []reflect.Type
+
+	// whether or not the last argument may be given any number of times, including none.
+	variadic bool
+}
+
+var (
+	anyType     = reflect.TypeOf((*interface{})(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	float32Type = reflect.TypeOf(float32(0))
+)
+
+/*
+	Creates the definition of a function from an ordinary Go [function], like `func(x, y float32) float32`,
+	which returns a single value, optionally followed by an error.
+
+	Arguments are converted to the types that the function takes, so numbers may be given to any numeric argument,
+	and number arrays to any slice of numbers. When an array is given for a single number or bool, the function is applied
+	to each element in turn (along with the same element of any other such array, which must be the same length),
+	and the results are returned as an array. This only works for functions which return a number or a bool.
+
+	The number of arguments in each call is checked when an expression is parsed, as is the type of any argument which is a literal.
+	Numbers are returned as float32, like every other number. Set [Pure] on the result if the function is pure.
+*/
+func NewTypedFunction(function interface{}) (FunctionDefinition, error) {
+
+	value := reflect.ValueOf(function)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return FunctionDefinition{}, fmt.Errorf("Typed functions must be Go funcs, not %T", function)
+	}
+
+	functionType := value.Type()
+
+	switch {
+	case functionType.NumOut() == 1:
+	case functionType.NumOut() == 2 && functionType.Out(1) == errorType:
+	default:
+		return FunctionDefinition{}, errors.New("Typed functions must return a single value, optionally followed by an error")
+	}
+
+	typed := &typedFunction{
+		function:     value,
+		result:       functionType.Out(0),
+		returnsError: functionType.NumOut() == 2,
+		variadic:     functionType.IsVariadic(),
+	}
+
+	for i := 0; i < functionType.NumIn(); i++ {
+
+		argumentType := functionType.In(i)
+		if typed.variadic && i == functionType.NumIn()-1 {
+			argumentType = argumentType.Elem()
+		}
+		typed.arguments = append(typed.arguments, argumentType)
+	}
+
+	typed.signature = &functionSignature{
+		minimum:      len(typed.arguments),
+		maximum:      len(typed.arguments),
+		checkLiteral: typed.checkLiteral,
+	}
+
+	if typed.variadic {
+		typed.signature.minimum--
+		typed.signature.maximum = -1
+	}
+
+	return FunctionDefinition{
+		Function:  typed.call,
+		signature: typed.signature,
+	}, nil
+}
+
+func (this *typedFunction) call(arguments ...interface{}) (interface{}, error) {
+
+	err := this.signature.checkCount("Function", len(arguments))
+	if err != nil {
+		return nil, err
+	}
+
+	length := -1
+
+	for i, argument := range arguments {
+
+		if !isLiftedArgument(this.argumentType(i), argument) {
+			continue
+		}
+
+		argumentLength := reflect.ValueOf(argument).Len()
+		if length >= 0 && argumentLength != length {
+			return nil, &ArrayShapeError{Left: length, Right: argumentLength}
+		}
+		length = argumentLength
+	}
+
+	if length < 0 {
+		return this.apply(arguments)
+	}
+
+	return this.applyElements(arguments, length)
+}
+
+/*
+	Calls the function once for each element of the arrays in [arguments], which are all [length] long.
+*/
+func (this *typedFunction) applyElements(arguments []interface{}, length int) (interface{}, error) {
+
+	var numbers []float32
+	var bools []bool
+
+	switch {
+	case isNumberKind(this.result.Kind()):
+		numbers = make([]float32, length)
+	case this.result.Kind() == reflect.Bool:
+		bools = make([]bool, length)
+	default:
+		return nil, fmt.Errorf("Function can't be applied to each element of an array, since it returns %s", this.result)
+	}
+
+	elementArguments := make([]interface{}, len(arguments))
+
+	for element := 0; element < length; element++ {
+
+		for i, argument := range arguments {
+
+			elementArguments[i] = argument
+			if isLiftedArgument(this.argumentType(i), argument) {
+				elementArguments[i] = reflect.ValueOf(argument).Index(element).Interface()
+			}
+		}
+
+		result, err := this.apply(elementArguments)
+		if err != nil {
+			return nil, err
+		}
+
+		if numbers != nil {
+			numbers[element] = result.(float32)
+		} else {
+			bools[element] = result.(bool)
+		}
+	}
+
+	if numbers != nil {
+		return numbers, nil
+	}
+	return bools, nil
+}
+
+/*
+	Calls the function once with the given [arguments], converting each to the type the function takes.
+*/
+func (this *typedFunction) apply(arguments []interface{}) (interface{}, error) {
+
+	values := make([]reflect.Value, len(arguments))
+
+	for i, argument := range arguments {
+
+		value, err := convertTypedArgument(argument, this.argumentType(i), i)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	results := this.function.Call(values)
+
+	if this.returnsError && !results[1].IsNil() {
+		return nil, results[1].Interface().(error)
+	}
+
+	result := results[0]
+
+	switch {
+	case isNumberKind(result.Kind()):
+		return float32(result.Convert(float32Type).Float()), nil
+
+	case result.Kind() == reflect.Bool:
+		return result.Bool(), nil
+
+	case result.Kind() == reflect.String:
+		return result.String(), nil
+
+	case result.Kind() == reflect.Slice && isNumberKind(result.Type().Elem().Kind()) && result.Type().Elem() != float32Type:
+
+		numbers := make([]float32, result.Len())
+		for i := range numbers {
+			numbers[i] = float32(result.Index(i).Convert(float32Type).Float())
+		}
+		return numbers, nil
+	}
+
+	return result.Interface(), nil
+}
+
+/*
+	Converts the given [argument] to the [target] type that a typed function takes at position [index].
+*/
+func convertTypedArgument(argument interface{}, target reflect.Type, index int) (reflect.Value, error) {
+
+	if argument == nil {
+
+		switch target.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+			return reflect.Zero(target), nil
+		}
+		return reflect.Value{}, fmt.Errorf("Argument %d can't be nil, since it must be %s", index+1, target)
+	}
+
+	value := reflect.ValueOf(argument)
+
+	switch {
+	case value.Type().AssignableTo(target):
+		return value, nil
+
+	case isNumberKind(value.Kind()) && isNumberKind(target.Kind()):
+		return convertNumber(value, target, index)
+
+	case value.Kind() == reflect.Slice && isNumberKind(value.Type().Elem().Kind()) &&
+		target.Kind() == reflect.Slice && isNumberKind(target.Elem().Kind()):
+
+		converted := reflect.MakeSlice(target, value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+
+			element, err := convertNumber(value.Index(i), target.Elem(), index)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			converted.Index(i).Set(element)
+		}
+		return converted, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("Argument %d must be %s, not %T", index+1, target, argument)
+}
+
+/*
+	Converts the given number [value] to the [target] number type, for the argument at position [index].
+	Integer types are only given whole numbers which fit in them, rather than having the rest cut off.
+*/
+func convertNumber(value reflect.Value, target reflect.Type, index int) (reflect.Value, error) {
+
+	var fits bool
+
+	switch {
+	case isFloatKind(target.Kind()):
+		return value.Convert(target), nil
+
+	case isFloatKind(value.Kind()):
+		number := value.Float()
+
+		// NaN isn't equal to itself, so it isn't a whole number either.
+		if number != math.Trunc(number) {
+			return reflect.Value{}, fmt.Errorf("Argument %d must be a whole number to be %s, not %v", index+1, target, value.Interface())
+		}
+
+		if isUnsignedKind(target.Kind()) {
+			fits = number >= 0 && number < math.Ldexp(1, target.Bits())
+		} else {
+			fits = number >= -math.Ldexp(1, target.Bits()-1) && number < math.Ldexp(1, target.Bits()-1)
+		}
+
+	case isUnsignedKind(value.Kind()):
+		if isUnsignedKind(target.Kind()) {
+			fits = !reflect.Zero(target).OverflowUint(value.Uint())
+		} else {
+			fits = value.Uint() <= math.MaxInt64 && !reflect.Zero(target).OverflowInt(int64(value.Uint()))
+		}
+
+	default:
+		if isUnsignedKind(target.Kind()) {
+			fits = value.Int() >= 0 && !reflect.Zero(target).OverflowUint(uint64(value.Int()))
+		} else {
+			fits = !reflect.Zero(target).OverflowInt(value.Int())
+		}
+	}
+
+	if !fits {
+		return reflect.Value{}, fmt.Errorf("Argument %d is out of range for %s: %v", index+1, target, value.Interface())
+	}
+	return value.Convert(target), nil
+}
+
+/*
+	Returns whether or not the given [argument] is an array given for a single number or bool of the [target] type,
+	so that the function must be applied to each of its elements.
+*/
+func isLiftedArgument(target reflect.Type, argument interface{}) bool {
+
+	switch argument.(type) {
+	case []float32:
+		return isNumberKind(target.Kind())
+	case []bool:
+		return target.Kind() == reflect.Bool
+	}
+	return false
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func isUnsignedKind(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+/*
+	Returns the type of the argument at the given [index]. Any argument after the last is the same type as the last, if it's variadic.
+*/
+func (this *typedFunction) argumentType(index int) reflect.Type {
+
+	if index >= len(this.arguments) {
+		if !this.variadic {
+			return anyType
+		}
+		return this.arguments[len(this.arguments)-1]
+	}
+	return this.arguments[index]
+}
+
+func (this *typedFunction) checkLiteral(index int, value interface{}) error {
+
+	_, err := convertTypedArgument(value, this.argumentType(index), index)
+	return err
+}
+
+/*
+	Returns the signature which calls to a function defined with the given [declared] signature are checked against.
+*/
+func newDeclaredSignature(declared *FunctionSignature) *functionSignature {
+
+	return &functionSignature{
+		minimum:  declared.MinArguments(),
+		maximum:  declared.MaxArguments(),
+		declared: declared,
+
+		checkLiteral: func(index int, value interface{}) error {
+
+			expected, found := declared.argumentType(index)
+			if !found {
+				return nil
+			}
+
+			actual, err := inferLiteral(value)
+			if err != nil || !acceptsType(expected, actual.value) {
+				return fmt.Errorf("Argument %d must be %v, not %T", index+1, expected, value)
+			}
+			return nil
+		},
+	}
+}
+
+/*
+	Returns an error if the function can't be called with [count] arguments. The error begins with the given [subject].
+*/
+func (this *functionSignature) checkCount(subject string, count int) error {
+
+	switch {
+	case this.maximum < 0:
+		if count < this.minimum {
+			return fmt.Errorf("%s takes at least %d arguments, but was given %d", subject, this.minimum, count)
+		}
+
+	case this.minimum == this.maximum:
+		if count != this.minimum {
+			return fmt.Errorf("%s takes %d arguments, but was given %d", subject, this.minimum, count)
+		}
+
+	default:
+		if count < this.minimum || count > this.maximum {
+			return fmt.Errorf("%s takes between %d and %d arguments, but was given %d", subject, this.minimum, this.maximum, count)
+		}
+	}
+	return nil
+}
+
+/*
+	Checks the number of arguments given to every function with a signature in [tokens],
+	and the type of each argument which is a single literal. Errors point at the function's name, or at the literal.
+*/
+func checkFunctionCalls(tokens []ExpressionToken) error {
+
+	for index := range tokens {
+
+		err := checkFunctionCall(tokens, index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	Checks the call whose function token is at [index] in [tokens], if it is one, and has a signature. See `checkFunctionCalls`.
+*/
+func checkFunctionCall(tokens []ExpressionToken, index int) error {
+
+	token := tokens[index]
+	if token.Kind != FUNCTION || token.signature == nil {
+		return nil
+	}
+
+	subject := fmt.Sprintf("Function '%s'", token.functionName)
+	arguments := findCallArguments(tokens, index)
+
+	err := token.signature.checkCount(subject, len(arguments))
+	if err != nil {
+		return newParseError(token.span, "%v", err)
+	}
+
+	for i, argument := range arguments {
+
+		if len(argument) != 1 {
+			continue
+		}
+
+		switch argument[0].Kind {
+		case NUMERIC, STRING, BOOLEAN:
+		default:
+			continue
+		}
+
+		if token.signature.checkLiteral == nil {
+			continue
+		}
+
+		err = token.signature.checkLiteral(i, argument[0].Value)
+		if err != nil {
+			return newParseError(argument[0].span, "%s: %v", subject, err)
+		}
+	}
+	return nil
+}
+
+/*
+	Returns the tokens of each argument given to the function whose token is at [index].
+*/
+func findCallArguments(tokens []ExpressionToken, index int) [][]ExpressionToken {
+
+	var ret [][]ExpressionToken
+	var current []ExpressionToken
+
+	if index+1 >= len(tokens) || tokens[index+1].Kind != CLAUSE {
+		return nil
+	}
+
+	depth := 0
+
+	for _, token := range tokens[index+2:] {
+
+		switch token.Kind {
+
+		case CLAUSE:
+			depth++
+
+		case CLAUSE_CLOSE:
+			if depth == 0 {
+				if len(current) > 0 || len(ret) > 0 {
+					ret = append(ret, current)
+				}
+				return ret
+			}
+			depth--
+
+		case SEPARATOR:
+			if depth == 0 {
+				ret = append(ret, current)
+				current = nil
+				continue
+			}
+		}
+
+		current = append(current, token)
+	}
+	return ret
+}
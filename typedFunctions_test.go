@@ -0,0 +1,171 @@
+package govaluate
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTypedFunctions(test *testing.T) {
+
+	functions := map[string]interface{}{
+		"hypot": func(x, y float32) float32 {
+			return float32(math.Hypot(float64(x), float64(y)))
+		},
+		"clamp": func(x float64, lo, hi int) float64 {
+			return math.Max(float64(lo), math.Min(float64(hi), x))
+		},
+		"positive": func(x float32) bool {
+			return x > 0
+		},
+		"sum": func(values ...float32) float32 {
+			var total float32
+			for _, value := range values {
+				total += value
+			}
+			return total
+		},
+		"mean": func(values []float64) float64 {
+			var total float64
+			for _, value := range values {
+				total += value
+			}
+			return total / float64(len(values))
+		},
+		"repeat": func(text string, count int) string {
+			return strings.Repeat(text, count)
+		},
+		"inverse": func(x float32) (float32, error) {
+			if x == 0 {
+				return 0, errors.New("Cannot invert zero")
+			}
+			return 1 / x, nil
+		},
+		"either": func(a, b bool) bool {
+			return a || b
+		},
+		"small": func(x int8) int8 {
+			return x
+		},
+	}
+
+	definitions := make(map[string]FunctionDefinition)
+	for name, function := range functions {
+
+		definition, err := NewTypedFunction(function)
+		if err != nil {
+			test.Fatalf("Failed to create '%s': %v", name, err)
+		}
+		definitions[name] = definition
+	}
+
+	evaluationTests := []struct {
+		Input    string
+		Expected interface{}
+	}{
+		{"hypot(3, 4)", float32(5)},
+		{"clamp(x, 0, 10)", float32(10)},
+		{"sum() + sum(1) + sum(1, 2, 3)", float32(7)},
+		{"mean(xs)", float32(2)},
+		{"repeat('ab', 2)", "abab"},
+		{"inverse(4)", float32(0.25)},
+		{"hypot(xs, 4)", []float32{4.1231055, 4.472136, 5}},
+		{"hypot(xs, xs * 0)", []float32{1, 2, 3}},
+		{"positive(xs - 2)", []bool{false, false, true}},
+		{"either(xs > 2, false)", []bool{false, false, true}},
+		{"clamp(xs * 5, 6, 12)", []float32{6, 10, 12}},
+		{"small(-128) + small(127)", float32(-1)},
+	}
+
+	parameters := map[string]interface{}{
+		"x":  float32(12),
+		"xs": []float32{1, 2, 3},
+	}
+
+	for _, evaluationTest := range evaluationTests {
+
+		expression, err := NewEvaluableExpressionWithDefinitions(evaluationTest.Input, definitions)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", evaluationTest.Input, err)
+			test.Fail()
+			continue
+		}
+
+		result, err := expression.Evaluate(parameters)
+		if err != nil || !reflect.DeepEqual(result, evaluationTest.Expected) {
+			test.Logf("Expected '%s' to be %v, got %v (%v)", evaluationTest.Input, evaluationTest.Expected, result, err)
+			test.Fail()
+		}
+	}
+
+	parseFailures := map[string]string{
+		"hypot(1)":              "Function 'hypot' takes 2 arguments, but was given 1",
+		"hypot(1, 2, 3)":        "takes 2 arguments",
+		"repeat(1, 2)":          "Argument 1 must be string",
+		"positive('yes')":       "Argument 1 must be float32",
+		"either(true, 'no')":    "Argument 2 must be bool",
+		"clamp(hypot(1), 1, 2)": "Function 'hypot'",
+		"repeat('x', 2.5)":      "Argument 2 must be a whole number to be int, not 2.5",
+		"small(128)":            "Argument 1 is out of range for int8: 128",
+		"small(Inf)":            "Argument 1 is out of range for int8",
+		"small(NaN)":            "Argument 1 must be a whole number",
+	}
+
+	for input, expected := range parseFailures {
+
+		_, err := NewEvaluableExpressionWithDefinitions(input, definitions)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			test.Logf("Expected an error containing '%s' parsing '%s', got %v", expected, input, err)
+			test.Fail()
+		}
+	}
+
+	evaluationFailures := map[string]string{
+		"inverse(x - 12)":      "Cannot invert zero",
+		"hypot(xs, ys)":        "different array sizes",
+		"repeat(name, xs)":     "can't be applied to each element",
+		"positive(name)":       "Argument 1 must be float32",
+		"repeat('x', x / 5)":   "Argument 2 must be a whole number to be int, not 2.4",
+		"clamp(x, xs / 2, 10)": "Argument 2 must be a whole number to be int, not 0.5",
+	}
+
+	parameters["ys"] = []float32{1, 2}
+	parameters["name"] = "a"
+
+	for input, expected := range evaluationFailures {
+
+		expression, err := NewEvaluableExpressionWithDefinitions(input, definitions)
+		if err != nil {
+			test.Logf("Failed to parse '%s': %v", input, err)
+			test.Fail()
+			continue
+		}
+
+		_, err = expression.Evaluate(parameters)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			test.Logf("Expected an error containing '%s' evaluating '%s', got %v", expected, input, err)
+			test.Fail()
+		}
+	}
+}
+
+func TestTypedFunctionCreation(test *testing.T) {
+
+	invalid := []interface{}{
+		nil,
+		42,
+		func() {},
+		func() (float32, float32) { return 0, 0 },
+	}
+
+	for _, function := range invalid {
+
+		_, err := NewTypedFunction(function)
+		if err == nil {
+			test.Logf("Expected an error creating a typed function from %T", function)
+			test.Fail()
+		}
+	}
+}